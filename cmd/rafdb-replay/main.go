@@ -0,0 +1,60 @@
+// Command rafdb-replay rebuilds a database by applying an operations log
+// recorded with rafdb -record-ops, for reproducing bugs outside production.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"rafdb/pkg/storage"
+)
+
+func main() {
+	opsFile := flag.String("ops", "", "operations log to replay (required)")
+	dataFile := flag.String("data", "rafdb_replay.json", "data file to write the resulting database to")
+	base := flag.String("base", "", "optional data file to load before replaying, instead of starting empty")
+	flag.Parse()
+
+	if *opsFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db := storage.NewDatabaseWithPath(*dataFile)
+	if *base != "" {
+		// Start from a copy so the base snapshot is never modified
+		data, err := os.ReadFile(*base)
+		if err != nil {
+			log.Fatalf("Could not read base data file: %v", err)
+		}
+		if err := os.WriteFile(*dataFile, data, 0644); err != nil {
+			log.Fatalf("Could not copy base data file: %v", err)
+		}
+		if err := db.LoadFromDisk(); err != nil {
+			log.Fatalf("Could not load base data file: %v", err)
+		}
+	}
+
+	f, err := os.Open(*opsFile)
+	if err != nil {
+		log.Fatalf("Could not open operations log: %v", err)
+	}
+	defer f.Close()
+
+	applied, err := db.ReplayOperations(f)
+	if err != nil {
+		log.Printf("Replay stopped after %d operations: %v", applied, err)
+	} else {
+		log.Printf("Replayed %d operations", applied)
+	}
+
+	if saveErr := db.SaveToDisk(); saveErr != nil {
+		log.Fatalf("Could not save replayed database: %v", saveErr)
+	}
+	log.Printf("Wrote replayed database to %s", db.DataFile())
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,8 @@ module rafdb
 go 1.21
 
 require (
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/rs/cors v1.10.1
 )
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// contextKey namespaces values stored in request contexts
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// API key roles. Keys without a configured role are read-write.
+const (
+	RoleRead      = "read"
+	RoleReadWrite = "readwrite"
+)
+
+// LoadAPIKeys reads a JSON file mapping API keys to the principal (user or
+// service name) they authenticate as, e.g. {"s3cr3t": "alice"}
+func LoadAPIKeys(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys map[string]string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	return keys, nil
+}
+
+// LoadAPIKeyRoles reads a JSON file mapping API keys to their role, "read" or
+// "readwrite", e.g. {"s3cr3t": "read"}
+func LoadAPIKeyRoles(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key roles file: %w", err)
+	}
+
+	var roles map[string]string
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("failed to parse API key roles file: %w", err)
+	}
+
+	for _, role := range roles {
+		if role != RoleRead && role != RoleReadWrite {
+			return nil, fmt.Errorf("unknown API key role '%s'", role)
+		}
+	}
+
+	return roles, nil
+}
+
+// apiKeyFromRequest extracts an API key from the X-API-Key header or an
+// Authorization: Bearer header
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return ""
+}
+
+// authenticate rejects requests without a valid API key when keys are
+// configured and records the authenticated principal in the request
+// context. Rejected requests count against the client IP's rate limit so
+// keys cannot be guessed at full speed. The health check is always
+// reachable so orchestrators can probe the server without credentials.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.opts.APIKeys) == 0 || r.URL.Path == "/api/v1/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := apiKeyFromRequest(r)
+		principal, ok := s.opts.APIKeys[key]
+		if !ok {
+			if s.throttle(w, r) {
+				return
+			}
+			s.sendError(w, http.StatusUnauthorized, "A valid API key is required")
+			return
+		}
+
+		if s.opts.APIKeyRoles[key] == RoleRead && isWriteRequest(r) {
+			s.sendError(w, http.StatusForbidden, "This API key is read-only")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isWriteRequest reports whether a request may modify data. Queries and
+// aggregations are sent as POST but only read.
+func isWriteRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		for _, suffix := range []string{"/query", "/aggregate", "/groupby"} {
+			if strings.HasSuffix(r.URL.Path, suffix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// principal returns the authenticated principal for a request, or "" when
+// authentication is disabled
+func principal(r *http.Request) string {
+	p, _ := r.Context().Value(principalKey).(string)
+	return p
+}
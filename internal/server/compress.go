@@ -0,0 +1,137 @@
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// compress gzip-encodes responses of at least Options.GzipMinSize bytes for
+// clients that accept gzip. Smaller responses are sent as is, and responses
+// the handler already encoded are never compressed again.
+func (s *Server) compress(next http.Handler) http.Handler {
+	if s.opts.GzipMinSize <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, minSize: s.opts.GzipMinSize}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipWriter buffers a response until it reaches minSize bytes, then
+// streams the rest through gzip. A response that finishes or is flushed
+// while still smaller is sent uncompressed.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	started bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	if gw.started {
+		return
+	}
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if gw.started {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start writes the header, switching to gzip if compress is set and the
+// handler has not encoded the body itself, followed by the buffered body
+func (gw *gzipWriter) start(compress bool) error {
+	gw.started = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+
+	header := gw.Header()
+	if compress && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if gw.gz != nil {
+		_, err := gw.gz.Write(buf)
+		return err
+	}
+	_, err := gw.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sends a response that stayed below minSize and flushes gzip
+func (gw *gzipWriter) finish() {
+	if !gw.started {
+		if gw.status == 0 && len(gw.buf) == 0 {
+			return
+		}
+		gw.start(false)
+		return
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+// Flush sends what has been written so far, committing to an uncompressed
+// response if it is still below minSize
+func (gw *gzipWriter) Flush() {
+	if !gw.started {
+		gw.start(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
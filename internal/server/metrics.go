@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies a request counter
+type requestKey struct {
+	method string
+	route  string
+	status int
+}
+
+// latencyHistogram is a cumulative Prometheus-style histogram
+type latencyHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *latencyHistogram) observe(seconds float64) {
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// metrics collects request counts and latencies for the /metrics endpoint
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[string]*latencyHistogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[string]*latencyHistogram),
+	}
+}
+
+func (m *metrics) record(method, route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, route: route, status: status}]++
+
+	h, exists := m.latency[route]
+	if !exists {
+		h = &latencyHistogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[route] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// collectMetrics records the count and latency of every request, labelled
+// by the route template it matched so that IDs do not explode cardinality
+func (s *Server) collectMetrics(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.metrics.record(r.Method, route, status, time.Since(start))
+	})
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	s.metrics.mu.Lock()
+	keys := make([]requestKey, 0, len(s.metrics.requests))
+	for key := range s.metrics.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	b.WriteString("# HELP rafdb_http_requests_total Total HTTP requests by method, route and status.\n")
+	b.WriteString("# TYPE rafdb_http_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "rafdb_http_requests_total{method=%q,route=%q,status=\"%d\"} %d\n",
+			key.method, key.route, key.status, s.metrics.requests[key])
+	}
+
+	routes := make([]string, 0, len(s.metrics.latency))
+	for route := range s.metrics.latency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	b.WriteString("# HELP rafdb_http_request_duration_seconds HTTP request latency by route.\n")
+	b.WriteString("# TYPE rafdb_http_request_duration_seconds histogram\n")
+	for _, route := range routes {
+		h := s.metrics.latency[route]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&b, "rafdb_http_request_duration_seconds_bucket{route=%q,le=%q} %d\n",
+				route, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(&b, "rafdb_http_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, h.count)
+		fmt.Fprintf(&b, "rafdb_http_request_duration_seconds_sum{route=%q} %g\n", route, h.sum)
+		fmt.Fprintf(&b, "rafdb_http_request_duration_seconds_count{route=%q} %d\n", route, h.count)
+	}
+	s.metrics.mu.Unlock()
+
+	stats := s.db.StatsStruct()
+	names := make([]string, 0, len(stats.CollectionStats))
+	for name := range stats.CollectionStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("# HELP rafdb_collections Number of collections.\n")
+	b.WriteString("# TYPE rafdb_collections gauge\n")
+	fmt.Fprintf(&b, "rafdb_collections %d\n", stats.Collections)
+	b.WriteString("# HELP rafdb_documents Total number of documents.\n")
+	b.WriteString("# TYPE rafdb_documents gauge\n")
+	fmt.Fprintf(&b, "rafdb_documents %d\n", stats.TotalDocuments)
+	b.WriteString("# HELP rafdb_collection_documents Number of documents per collection.\n")
+	b.WriteString("# TYPE rafdb_collection_documents gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "rafdb_collection_documents{collection=%q} %d\n", name, stats.CollectionStats[name])
+	}
+	b.WriteString("# HELP rafdb_collection_size_bytes Approximate JSON-encoded size of each collection.\n")
+	b.WriteString("# TYPE rafdb_collection_size_bytes gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "rafdb_collection_size_bytes{collection=%q} %d\n", name, stats.CollectionDetails[name].SizeBytes)
+	}
+	b.WriteString("# HELP rafdb_save_errors_total Failed saves of the data file.\n")
+	b.WriteString("# TYPE rafdb_save_errors_total counter\n")
+	fmt.Fprintf(&b, "rafdb_save_errors_total %d\n", stats.SaveErrors)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripTrailingSlash removes a trailing slash from the request path before
+// routing so that "/collections/" and "/collections" reach the same handler
+func stripTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.Path; len(path) > 1 && strings.HasSuffix(path, "/") {
+			r.URL.Path = strings.TrimRight(path, "/")
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTimeout applies Options.RequestTimeout as a deadline on the request
+// context so context-aware storage operations stop when a request runs too
+// long. If the deadline passes before the handler has responded, the client
+// gets Options.TimeoutStatus instead. Long-lived streaming endpoints manage
+// their own lifetimes and are exempt.
+func (s *Server) withTimeout(next http.Handler) http.Handler {
+	if s.opts.RequestTimeout <= 0 {
+		return next
+	}
+
+	status := s.opts.TimeoutStatus
+	if status == 0 {
+		status = http.StatusGatewayTimeout
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.opts.RequestTimeout)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+
+		if !tw.wroteHeader && ctx.Err() == context.DeadlineExceeded {
+			s.sendError(w, status, "Request timed out")
+		}
+	})
+}
+
+// liftDeadlines removes the server's read and write timeouts for bulk
+// requests, whose bodies may take a long time to upload and apply, and the
+// write timeout for streamed responses, which may take a long time to send.
+// Body size limits and RequestTimeout still apply to them.
+func liftDeadlines(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bulk := isBulkPath(r.URL.Path)
+		if bulk || isStreamingPath(r.URL.Path) {
+			rc := http.NewResponseController(w)
+			rc.SetWriteDeadline(time.Time{})
+			if bulk {
+				rc.SetReadDeadline(time.Time{})
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isStreamingPath reports whether a request path serves a long-lived or
+// streamed response
+func isStreamingPath(path string) bool {
+	return strings.HasSuffix(path, "/poll") || strings.HasSuffix(path, "/dump") || strings.HasSuffix(path, "/export") || strings.HasSuffix(path, "/backup") || strings.HasSuffix(path, "/watch") || strings.HasSuffix(path, "/ws")
+}
+
+// limitBody caps request bodies at Options.MaxBodyBytes, or at
+// Options.MaxBulkBodyBytes for bulk, batch, import, restore and transaction
+// requests. Requests declaring a larger Content-Length are rejected with 413
+// up front; otherwise reading past the limit fails and the handler reports
+// 413.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(s.opts.MaxBodyBytes)
+		if isBulkPath(r.URL.Path) {
+			limit = int64(s.opts.MaxBulkBodyBytes)
+		}
+		if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			s.sendBodyTooLarge(w, limit)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBulkPath reports whether a request path accepts many documents at once
+func isBulkPath(path string) bool {
+	return strings.HasSuffix(path, "/bulk") || strings.HasSuffix(path, "/batch") || strings.HasSuffix(path, "/import") || strings.HasSuffix(path, "/restore") || strings.HasSuffix(path, "/transaction")
+}
+
+// isBodyTooLarge reports whether err came from reading past limitBody's cap
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// sendBodyTooLarge reports a request body over limit bytes
+func (s *Server) sendBodyTooLarge(w http.ResponseWriter, limit int64) {
+	s.sendError(w, http.StatusRequestEntityTooLarge, "Request body exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+}
+
+// timeoutWriter discards a handler's response once the request deadline has
+// passed, leaving withTimeout to report the timeout
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.wroteHeader || tw.ctx.Err() != nil {
+		return
+	}
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if !tw.wroteHeader {
+		return 0, tw.ctx.Err()
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Request log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// responseWriter records the status code written by a handler
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack hands the connection over for WebSocket upgrades, which do not use
+// http.ResponseController
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// requestLogEntry is one JSON request log line
+type requestLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// logRequests logs the method, path, status and duration of every request
+// in Options.RequestLogFormat. Logging is disabled when no format is set.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	var logger *log.Logger
+	switch s.opts.RequestLogFormat {
+	case LogFormatText:
+		logger = log.New(s.requestLogOutput(), "", log.LstdFlags)
+	case LogFormatJSON:
+		logger = log.New(s.requestLogOutput(), "", 0)
+	default:
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		duration := time.Since(start)
+
+		if s.opts.RequestLogFormat == LogFormatJSON {
+			line, _ := json.Marshal(requestLogEntry{
+				Time:       start,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     status,
+				DurationMS: float64(duration.Microseconds()) / 1000,
+			})
+			logger.Print(string(line))
+			return
+		}
+
+		logger.Printf("%s %s %d %s", r.Method, r.URL.Path, status, duration)
+	})
+}
+
+func (s *Server) requestLogOutput() io.Writer {
+	if s.opts.RequestLogOutput != nil {
+		return s.opts.RequestLogOutput
+	}
+	return log.Writer()
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// PprofHandler serves the net/http/pprof profiles under /debug/pprof/. It is
+// meant for a separate listener bound to a trusted address: it bypasses the
+// API's authentication, rate limiting and timeouts so `go tool pprof` can
+// fetch profiles directly.
+//
+// The index at /debug/pprof/ lists every runtime profile: allocs, block,
+// goroutine, heap, mutex and threadcreate. /debug/pprof/profile records a
+// CPU profile (?seconds=30 by default), /debug/pprof/trace an execution
+// trace, and cmdline and symbol support the pprof tool. Block and mutex
+// profiles stay empty unless their sampling rates are enabled.
+func PprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitIdleTTL is how long a client's bucket is kept after its last
+// request. An idle bucket has refilled completely, so dropping it loses
+// nothing.
+const rateLimitIdleTTL = 10 * time.Minute
+
+// tokenBucket holds a client's available requests
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket limiter keyed by client. Idle buckets are
+// removed periodically as requests come in so memory stays bounded by the
+// number of recently active clients.
+type rateLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	rate        float64
+	burst       float64
+	lastCleanup time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	return &rateLimiter{
+		buckets:     make(map[string]*tokenBucket),
+		rate:        rate,
+		burst:       float64(burst),
+		lastCleanup: time.Now(),
+	}
+}
+
+// allow takes a token from key's bucket. When none is available it returns
+// false and how long until one will be.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastCleanup) >= rateLimitIdleTTL {
+		l.cleanupLocked(now)
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// cleanupLocked drops buckets idle for longer than rateLimitIdleTTL
+func (l *rateLimiter) cleanupLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= rateLimitIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// clientKey identifies the client a request is rate limited as: its
+// authenticated principal, or its IP address without one. The API key header
+// itself is never used, since a client could send a new made-up key with
+// each request to get a fresh bucket.
+func clientKey(r *http.Request) string {
+	if p := principal(r); p != "" {
+		return "principal:" + p
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit rejects requests from clients that exceed the configured rate
+// with 429 Too Many Requests. The health check is exempt. Requests with an
+// invalid API key never reach it; authenticate charges them to the client's
+// IP instead.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.throttle(w, r) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// throttle takes a token from the request's client bucket. When none is
+// available it writes a 429 response and returns true.
+func (s *Server) throttle(w http.ResponseWriter, r *http.Request) bool {
+	if s.limiter == nil {
+		return false
+	}
+
+	ok, wait := s.limiter.allow(clientKey(r), time.Now())
+	if ok {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	s.sendError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+	return true
+}
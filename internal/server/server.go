@@ -2,21 +2,131 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 
-	"rafdb/internal/storage"
+	"rafdb/internal/version"
+	"rafdb/pkg/storage"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	db     *storage.Database
-	server *http.Server
+	db        storage.Store
+	metrics   *metrics
+	limiter   *rateLimiter
+	mu        sync.Mutex
+	server    *http.Server
+	tlsServer *http.Server
+	cert      atomic.Pointer[tls.Certificate]
+	opts      Options
+	started   time.Time
+}
+
+// Options configures optional server behavior
+type Options struct {
+	// AllowReset enables the destructive POST /admin/reset endpoint
+	AllowReset bool
+	// AllowRestore enables POST /restore, which replaces the whole
+	// database, on a server without API keys. With API keys it is always
+	// enabled for keys that may write.
+	AllowRestore bool
+	// APIKeys maps API keys to the principal they authenticate as. When
+	// empty, authentication is disabled.
+	APIKeys map[string]string
+	// APIKeyRoles maps API keys to RoleRead or RoleReadWrite. Keys not
+	// listed are read-write.
+	APIKeyRoles map[string]string
+	// MaxQueryResults caps how many documents a query returns at once. Larger
+	// result sets are paginated with a cursor. Zero disables the cap.
+	MaxQueryResults int
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSAddr serves HTTPS on its own address while the address passed to
+	// Start keeps serving plain HTTP. When empty, Start serves only HTTPS.
+	TLSAddr string
+	// RedirectHTTP redirects plain HTTP requests other than the health check
+	// to HTTPS. Only used with TLSAddr.
+	RedirectHTTP bool
+	// RequestTimeout bounds how long a request may run. Its deadline is
+	// applied to the request context. Zero disables the limit.
+	RequestTimeout time.Duration
+	// TimeoutStatus is the status returned when RequestTimeout is exceeded.
+	// Defaults to 504 Gateway Timeout.
+	TimeoutStatus int
+	// RequestLogFormat is LogFormatText or LogFormatJSON to log every
+	// request, or empty to disable request logging
+	RequestLogFormat string
+	// RequestLogOutput receives request logs. Defaults to the standard
+	// logger's output.
+	RequestLogOutput io.Writer
+	// RateLimit is the sustained requests per second allowed per
+	// authenticated principal, or per client IP for requests without one.
+	// Zero disables limiting.
+	RateLimit float64
+	// RateBurst is how many requests a client may make at once before
+	// RateLimit applies. Defaults to RateLimit rounded up.
+	RateBurst int
+	// GzipMinSize is the smallest response, in bytes, that is gzip-encoded
+	// for clients sending Accept-Encoding: gzip. Zero disables compression.
+	GzipMinSize int
+	// MaxBodyBytes caps the size of request bodies; larger requests get 413
+	// Request Entity Too Large. Zero disables the limit.
+	MaxBodyBytes int
+	// MaxBulkBodyBytes replaces MaxBodyBytes for bulk inserts and upserts,
+	// batches, imports, restores and transactions. Zero disables the limit for them.
+	MaxBulkBodyBytes int
+	// ReadTimeout and WriteTimeout bound how long the server spends reading
+	// a request and writing its response. Bulk requests are exempt from
+	// both, and streamed responses from WriteTimeout. They default to 15
+	// seconds; a negative value disables them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection may wait for its next
+	// request. Defaults to 60 seconds; a negative value disables it.
+	IdleTimeout time.Duration
+	// MaxSaveFailures is how many saves in a row may fail before the health
+	// check reports unhealthy. Defaults to 3; a negative value never reports
+	// failed saves as unhealthy.
+	MaxSaveFailures int
+}
+
+// Default HTTP server timeouts, used when the corresponding Options field is
+// zero
+const (
+	DefaultReadTimeout  = 15 * time.Second
+	DefaultWriteTimeout = 15 * time.Second
+	DefaultIdleTimeout  = 60 * time.Second
+)
+
+// DefaultMaxSaveFailures is used when Options.MaxSaveFailures is zero
+const DefaultMaxSaveFailures = 3
+
+// QueryPage is returned instead of a plain document list when a query matches
+// more than Options.MaxQueryResults documents. Pass NextCursor as the cursor
+// query parameter to fetch the next page.
+type QueryPage struct {
+	Documents  []*storage.Document `json:"documents"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	Total      int                 `json:"total"`
 }
 
 // Response represents a standard API response
@@ -27,14 +137,96 @@ type Response struct {
 }
 
 // NewServer creates a new server instance
-func NewServer(db *storage.Database) *Server {
-	return &Server{
-		db: db,
+func NewServer(db storage.Store) *Server {
+	return NewServerWithOptions(db, Options{})
+}
+
+// NewServerWithOptions creates a new server instance with the given options
+func NewServerWithOptions(db storage.Store, opts Options) *Server {
+	s := &Server{
+		db:      db,
+		metrics: newMetrics(),
+		opts:    opts,
+		started: time.Now(),
+	}
+	if opts.RateLimit > 0 {
+		s.limiter = newRateLimiter(opts.RateLimit, opts.RateBurst)
+	}
+	return s
+}
+
+// Start listens on addr and serves until the server stops. It serves HTTPS
+// when a TLS certificate is configured. It returns http.ErrServerClosed after
+// a graceful Shutdown.
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener until the server stops, like Start.
+// It lets callers choose the listener, for example one on an ephemeral port.
+func (s *Server) Serve(listener net.Listener) error {
+	handler := s.Handler()
+	if s.tlsEnabled() {
+		return s.serveTLS(listener, handler)
+	}
+
+	server := s.setServers(s.newHTTPServer(listener.Addr().String(), handler), nil)
+	return server.Serve(listener)
+}
+
+// setServers records the running servers so Shutdown can find them, and
+// returns the plain server for convenience
+func (s *Server) setServers(server, tlsServer *http.Server) *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.server = server
+	s.tlsServer = tlsServer
+	return server
+}
+
+func (s *Server) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	read, write, idle := s.Timeouts()
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  read,
+		WriteTimeout: write,
+		IdleTimeout:  idle,
+	}
+}
+
+// Timeouts returns the effective read, write and idle timeouts of the HTTP
+// server, with defaults applied. A negative value means no timeout.
+func (s *Server) Timeouts() (read, write, idle time.Duration) {
+	read, write, idle = s.opts.ReadTimeout, s.opts.WriteTimeout, s.opts.IdleTimeout
+	if read == 0 {
+		read = DefaultReadTimeout
+	}
+	if write == 0 {
+		write = DefaultWriteTimeout
+	}
+	if idle == 0 {
+		idle = DefaultIdleTimeout
 	}
+	return read, write, idle
 }
 
-// Start starts the HTTP server
-func (s *Server) Start(addr string) {
+// maxSaveFailures returns Options.MaxSaveFailures with its default applied
+func (s *Server) maxSaveFailures() int {
+	if s.opts.MaxSaveFailures == 0 {
+		return DefaultMaxSaveFailures
+	}
+	return s.opts.MaxSaveFailures
+}
+
+// Handler builds the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
 	router := mux.NewRouter()
 
 	// API routes
@@ -43,83 +235,215 @@ func (s *Server) Start(addr string) {
 	// Collection routes
 	api.HandleFunc("/collections", s.handleListCollections).Methods("GET")
 	api.HandleFunc("/collections", s.handleCreateCollection).Methods("POST")
+	api.HandleFunc("/collections/{collection}", s.handleHeadCollection).Methods("HEAD")
 	api.HandleFunc("/collections/{collection}", s.handleDeleteCollection).Methods("DELETE")
+	api.HandleFunc("/collections/{collection}/truncate", s.handleTruncateCollection).Methods("POST")
+	api.HandleFunc("/collections/{collection}/copy", s.handleCopyCollection).Methods("POST")
+	api.HandleFunc("/collections/{collection}/rename", s.handleRenameCollection).Methods("POST")
+	api.HandleFunc("/collections/{collection}/metadata", s.handleSetCollectionMetadata).Methods("PUT")
+	api.HandleFunc("/collections/{collection}/save-interval", s.handleSetSaveInterval).Methods("PUT")
 
 	// Document routes
 	api.HandleFunc("/collections/{collection}/documents", s.handleListDocuments).Methods("GET")
 	api.HandleFunc("/collections/{collection}/documents", s.handleInsertDocument).Methods("POST")
+	api.HandleFunc("/collections/{collection}/documents/bulk", s.handleBulkInsert).Methods("POST")
+	api.HandleFunc("/collections/{collection}/documents/import", s.handleImportDocument).Methods("POST")
+	api.HandleFunc("/collections/{collection}/documents/delete-query", s.handleDeleteQuery).Methods("POST")
+	api.HandleFunc("/collections/{collection}/bulk", s.handleBulkUpsert).Methods("PUT")
+	api.HandleFunc("/collections/{collection}/batch", s.handleBatch).Methods("POST")
 	api.HandleFunc("/collections/{collection}/documents/{id}", s.handleGetDocument).Methods("GET")
+	api.HandleFunc("/collections/{collection}/documents/{id}", headOnly(s.handleGetDocument)).Methods("HEAD")
+	api.HandleFunc("/collections/{collection}/watch", s.handleWatchCollection).Methods("GET")
+	api.HandleFunc("/collections/{collection}/documents/{id}/poll", s.handlePollDocument).Methods("GET")
+	api.HandleFunc("/collections/{collection}/documents/{id}/sync", s.handleSyncDocument).Methods("POST")
+	api.HandleFunc("/collections/{collection}/documents/{id}/export", s.handleExportDocument).Methods("GET")
 	api.HandleFunc("/collections/{collection}/documents/{id}", s.handleUpdateDocument).Methods("PUT")
+	api.HandleFunc("/collections/{collection}/documents/{id}", s.handlePatchDocument).Methods("PATCH")
 	api.HandleFunc("/collections/{collection}/documents/{id}", s.handleDeleteDocument).Methods("DELETE")
+	api.HandleFunc("/collections/{collection}/documents/{id}/fields/{field}", s.handleDeleteField).Methods("DELETE")
+
+	// Dump route
+	api.HandleFunc("/collections/{collection}/dump", s.handleDump).Methods("GET")
+	api.HandleFunc("/collections/{collection}/export", s.handleExportCollection).Methods("GET")
+	api.HandleFunc("/collections/{collection}/import", s.handleImportCollection).Methods("POST")
 
 	// Query route
 	api.HandleFunc("/collections/{collection}/query", s.handleQuery).Methods("POST")
+	api.HandleFunc("/collections/{collection}/search", s.handleSearch).Methods("GET")
+	api.HandleFunc("/collections/{collection}/aggregate", s.handleAggregate).Methods("POST")
+	api.HandleFunc("/collections/{collection}/distinct", s.handleDistinct).Methods("GET")
+	api.HandleFunc("/collections/{collection}/groupby", s.handleGroupBy).Methods("POST")
+	api.HandleFunc("/collections/{collection}/histogram", s.handleHistogram).Methods("GET")
+
+	// Index routes
+	api.HandleFunc("/collections/{collection}/indexes", s.handleListIndexes).Methods("GET")
+	api.HandleFunc("/collections/{collection}/indexes", s.handleCreateIndex).Methods("POST")
+	api.HandleFunc("/collections/{collection}/indexes/{field}", s.handleDropIndex).Methods("DELETE")
+
+	// Label routes
+	api.HandleFunc("/collections/{collection}/label-where", s.handleLabelWhere).Methods("POST")
+
+	// Admin routes
+	api.HandleFunc("/admin/verify", s.handleVerifyChecksums).Methods("GET")
+	api.HandleFunc("/admin/reset", s.handleReset).Methods("POST")
+	api.HandleFunc("/admin/diagnostics", s.handleDiagnostics).Methods("GET")
+
+	// Backup routes
+	api.HandleFunc("/backup", s.handleBackup).Methods("GET")
+	api.HandleFunc("/restore", s.handleRestore).Methods("POST")
+	api.HandleFunc("/transaction", s.handleTransaction).Methods("POST")
+	api.HandleFunc("/ws", s.handleWebSocket).Methods("GET")
 
 	// Stats route
 	api.HandleFunc("/stats", s.handleStats).Methods("GET")
 
 	// Health check
 	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	api.HandleFunc("/version", s.handleVersion).Methods("GET")
+
+	// Prometheus metrics
+	router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
 
 	// Setup CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
 	})
 
-	handler := c.Handler(router)
+	return liftDeadlines(c.Handler(s.compress(s.logRequests(stripTrailingSlash(s.collectMetrics(router, s.authenticate(s.rateLimit(s.limitBody(s.withTimeout(router))))))))))
+}
 
-	s.server = &http.Server{
-		Addr:         addr,
-		Handler:      handler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+// Shutdown gracefully shuts down the server, waiting for in-flight requests
+// to finish until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	servers := []*http.Server{s.server, s.tlsServer}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	log.Fatal(s.server.ListenAndServe())
+	return errors.Join(errs...)
 }
 
-// Shutdown gracefully shuts down the server
-func (s *Server) Shutdown() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := s.server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+// Helper function to send JSON response
+func (s *Server) sendResponse(w http.ResponseWriter, success bool, data interface{}, errorMsg string) {
+	if !success {
+		s.sendError(w, http.StatusBadRequest, errorMsg)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Data:    data,
+	})
 }
 
-// Helper function to send JSON response
-func (s *Server) sendResponse(w http.ResponseWriter, success bool, data interface{}, errorMsg string) {
+// Helper function to send a JSON error response with a specific status code
+func (s *Server) sendError(w http.ResponseWriter, status int, errorMsg string) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 
-	response := Response{
-		Success: success,
-		Data:    data,
+	json.NewEncoder(w).Encode(Response{
+		Success: false,
 		Error:   errorMsg,
-	}
+	})
+}
 
-	if !success {
-		w.WriteHeader(http.StatusBadRequest)
+// decodeJSON decodes the request body into v, rejecting fields v does not
+// have so that typos are not silently ignored. On failure it reports the
+// error, 413 when the body is over the size limit, and returns false.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		if isBodyTooLarge(err) {
+			s.sendError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return false
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			s.sendResponse(w, false, nil, "Unknown field "+field)
+			return false
+		}
+		s.sendResponse(w, false, nil, "Invalid JSON")
+		return false
 	}
+	return true
+}
 
-	json.NewEncoder(w).Encode(response)
+// sendStorageError reports a failed storage operation, using 404 Not Found
+// for missing collections, documents, fields and indexes, 409 Conflict for existing
+// ones, version mismatches and unique index violations, and 400 Bad Request
+// otherwise
+func (s *Server) sendStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrCollectionNotFound),
+		errors.Is(err, storage.ErrDocumentNotFound),
+		errors.Is(err, storage.ErrFieldNotFound),
+		errors.Is(err, storage.ErrIndexNotFound):
+		s.sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, storage.ErrCollectionExists),
+		errors.Is(err, storage.ErrDocumentExists),
+		errors.Is(err, storage.ErrDuplicateID),
+		errors.Is(err, storage.ErrUniqueViolation),
+		errors.Is(err, storage.ErrVersionConflict):
+		s.sendError(w, http.StatusConflict, err.Error())
+	case isBodyTooLarge(err):
+		s.sendError(w, http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		s.sendResponse(w, false, nil, err.Error())
+	}
 }
 
 // Collection handlers
 func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("detailed") == "true" {
+		s.sendResponse(w, true, s.db.ListCollectionInfo(), "")
+		return
+	}
+
 	collections := s.db.ListCollections()
 	s.sendResponse(w, true, collections, "")
 }
 
+func (s *Server) handleSetCollectionMetadata(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	collection.SetMetadata(req.Metadata)
+	s.sendResponse(w, true, map[string]interface{}{"metadata": collection.GetMetadata()}, "")
+}
+
 func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"name"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendResponse(w, false, nil, "Invalid JSON")
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -129,25 +453,112 @@ func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := s.db.CreateCollection(req.Name); err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		s.sendStorageError(w, err)
 		return
 	}
 
 	s.sendResponse(w, true, map[string]string{"message": "Collection created successfully"}, "")
 }
 
+func (s *Server) handleCopyCollection(w http.ResponseWriter, r *http.Request) {
+	s.moveCollection(w, r, s.db.CopyCollection, "Collection copied successfully")
+}
+
+func (s *Server) handleRenameCollection(w http.ResponseWriter, r *http.Request) {
+	s.moveCollection(w, r, s.db.RenameCollection, "Collection renamed successfully")
+}
+
+// moveCollection applies a copy or rename of the collection in the path to
+// the name in the request body
+func (s *Server) moveCollection(w http.ResponseWriter, r *http.Request, move func(src, dst string) error, message string) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Name == "" {
+		s.sendResponse(w, false, nil, "Collection name is required")
+		return
+	}
+
+	if err := move(collectionName, req.Name); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": message, "name": req.Name}, "")
+}
+
 func (s *Server) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionName := vars["collection"]
 
 	if err := s.db.DeleteCollection(collectionName); err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		s.sendStorageError(w, err)
 		return
 	}
 
 	s.sendResponse(w, true, map[string]string{"message": "Collection deleted successfully"}, "")
 }
 
+func (s *Server) handleTruncateCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	if err := collection.Truncate(); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Collection truncated successfully"}, "")
+}
+
+// handleSetSaveInterval gives a collection its own save interval, or with
+// "0" saves it with the data file again
+func (s *Server) handleSetSaveInterval(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Interval string `json:"interval"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		s.sendResponse(w, false, nil, "Invalid interval")
+		return
+	}
+
+	if err := collection.SetSaveInterval(interval); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"interval": collection.GetSaveInterval().String()}, "")
+}
+
 // Document handlers
 func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -155,12 +566,67 @@ func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
 
 	collection, err := s.db.GetCollection(collectionName)
 	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		s.sendStorageError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if sortField := query.Get("sort"); sortField != "" {
+		if storage.IsReservedField(sortField) {
+			s.sendResponse(w, false, nil, "Cannot sort on '"+sortField+"', which is document metadata")
+			return
+		}
+		order := query.Get("order")
+		if order != "" && order != "asc" && order != "desc" {
+			s.sendResponse(w, false, nil, "Order must be 'asc' or 'desc'")
+			return
+		}
+		documents := collection.ListSorted(sortField, order == "desc")
+		sendDocumentStream(w, func(fn func(*storage.Document) bool) {
+			for _, doc := range documents {
+				if !fn(doc) {
+					return
+				}
+			}
+		})
+		return
+	}
+
+	sendDocumentStream(w, collection.Each)
+}
+
+// sendDocumentStream writes a successful response whose data is a JSON array
+// of the documents each visits, encoding them one at a time instead of
+// building the whole response in memory. It stops early if a write fails.
+func sendDocumentStream(w http.ResponseWriter, each func(func(*storage.Document) bool)) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.WriteString(w, `{"success":true,"data":[`); err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	first := true
+	failed := false
+	each(func(doc *storage.Document) bool {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				failed = true
+				return false
+			}
+		}
+		first = false
+		if err := encoder.Encode(doc); err != nil {
+			failed = true
+			return false
+		}
+		return true
+	})
+	if failed {
 		return
 	}
 
-	documents := collection.List()
-	s.sendResponse(w, true, documents, "")
+	io.WriteString(w, "]}\n")
 }
 
 func (s *Server) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
@@ -171,7 +637,7 @@ func (s *Server) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// Try to create the collection if it doesn't exist
 		if err := s.db.CreateCollection(collectionName); err != nil {
-			s.sendResponse(w, false, nil, err.Error())
+			s.sendStorageError(w, err)
 			return
 		}
 		collection, _ = s.db.GetCollection(collectionName)
@@ -180,131 +646,1438 @@ func (s *Server) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ID   string                 `json:"id"`
 		Data map[string]interface{} `json:"data"`
+		TTL  string                 `json:"ttl"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendResponse(w, false, nil, "Invalid JSON")
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			s.sendResponse(w, false, nil, "Invalid ttl")
+			return
+		}
+
+		if req.ID == "" {
+			s.sendResponse(w, false, nil, "Document ID is required with ttl")
+			return
+		}
+
+		if err := collection.InsertWithTTLAs(principal(r), req.ID, req.Data, ttl); err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+
+		s.sendResponse(w, true, map[string]string{"message": "Document inserted successfully"}, "")
 		return
 	}
 
 	if req.ID == "" {
-		s.sendResponse(w, false, nil, "Document ID is required")
+		id, err := collection.InsertAutoAs(principal(r), req.Data)
+		if err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+
+		s.sendResponse(w, true, map[string]string{
+			"message": "Document inserted successfully",
+			"id":      id,
+		}, "")
 		return
 	}
 
-	if err := collection.Insert(req.ID, req.Data); err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+	if err := collection.InsertAs(principal(r), req.ID, req.Data); err != nil {
+		s.sendStorageError(w, err)
 		return
 	}
 
 	s.sendResponse(w, true, map[string]string{"message": "Document inserted successfully"}, "")
 }
 
-func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleBulkInsert(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionName := vars["collection"]
-	documentID := vars["id"]
 
 	collection, err := s.db.GetCollection(collectionName)
 	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		// Try to create the collection if it doesn't exist
+		if err := s.db.CreateCollection(collectionName); err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+		collection, _ = s.db.GetCollection(collectionName)
+	}
+
+	var req struct {
+		Documents []storage.DocumentInput `json:"documents"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	document, err := collection.Get(documentID)
-	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+	if len(req.Documents) == 0 {
+		s.sendResponse(w, false, nil, "At least one document is required")
 		return
 	}
 
-	s.sendResponse(w, true, document, "")
+	inserted, errs := collection.InsertManyAs(principal(r), req.Documents)
+
+	s.sendResponse(w, true, map[string]interface{}{
+		"inserted": inserted,
+		"failed":   batchFailures(errs),
+	}, "")
 }
 
-func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleBulkUpsert(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionName := vars["collection"]
-	documentID := vars["id"]
 
 	collection, err := s.db.GetCollection(collectionName)
 	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		s.sendStorageError(w, err)
 		return
 	}
 
 	var req struct {
-		Data map[string]interface{} `json:"data"`
+		Documents map[string]map[string]interface{} `json:"documents"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendResponse(w, false, nil, "Invalid JSON")
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	if err := collection.Update(documentID, req.Data); err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+	if len(req.Documents) == 0 {
+		s.sendResponse(w, false, nil, "At least one document is required")
 		return
 	}
 
-	s.sendResponse(w, true, map[string]string{"message": "Document updated successfully"}, "")
+	created, updated, errs := collection.UpsertManyAs(principal(r), req.Documents)
+
+	s.sendResponse(w, true, map[string]interface{}{
+		"created": created,
+		"updated": updated,
+		"failed":  batchFailures(errs),
+	}, "")
 }
 
-func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+// batchFailure describes a document that could not be written in a batch
+type batchFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// batchFailures converts errors from a batch write into per-document failures
+func batchFailures(errs []error) []batchFailure {
+	failed := make([]batchFailure, 0, len(errs))
+	for _, err := range errs {
+		var docErr *storage.DocumentError
+		if errors.As(err, &docErr) {
+			failed = append(failed, batchFailure{ID: docErr.ID, Error: docErr.Err.Error()})
+		} else {
+			failed = append(failed, batchFailure{Error: err.Error()})
+		}
+	}
+	return failed
+}
+
+func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionName := vars["collection"]
 	documentID := vars["id"]
 
 	collection, err := s.db.GetCollection(collectionName)
 	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		s.sendStorageError(w, err)
 		return
 	}
 
-	if err := collection.Delete(documentID); err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+	if r.URL.Query().Get("raw") == "true" {
+		raw, err := collection.GetRaw(documentID)
+		if err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+
+		s.sendResponse(w, true, raw, "")
 		return
 	}
 
-	s.sendResponse(w, true, map[string]string{"message": "Document deleted successfully"}, "")
+	document, err := collection.Get(documentID)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(document.Version)))
+	s.sendResponse(w, true, document, "")
 }
 
-func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+// headOnly answers HEAD requests with the status and headers, including the
+// ETag and Content-Length, that next would send for GET, without the body
+func headOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hw := &headWriter{header: w.Header()}
+		next(hw, r)
+
+		if hw.status == 0 {
+			hw.status = http.StatusOK
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(hw.size))
+		w.WriteHeader(hw.status)
+	}
+}
+
+// headWriter records the status and headers a handler writes and counts
+// its body instead of sending it
+type headWriter struct {
+	header http.Header
+	status int
+	size   int
+}
+
+func (hw *headWriter) Header() http.Header {
+	return hw.header
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
+
+func (hw *headWriter) Write(b []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.size += len(b)
+	return len(b), nil
+}
+
+// handleHeadCollection reports whether a collection exists, with its
+// document count in X-Document-Count
+func (s *Server) handleHeadCollection(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionName := vars["collection"]
 
 	collection, err := s.db.GetCollection(collectionName)
 	if err != nil {
-		s.sendResponse(w, false, nil, err.Error())
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	var req struct {
-		Field string      `json:"field"`
-		Value interface{} `json:"value"`
+	w.Header().Set("X-Document-Count", strconv.Itoa(collection.Count()))
+	w.WriteHeader(http.StatusOK)
+}
+
+// ifMatchVersion parses the document version from an If-Match header. The
+// boolean is false when the header is absent.
+func ifMatchVersion(r *http.Request) (int, bool, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, false, nil
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendResponse(w, false, nil, "Invalid JSON")
-		return
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, false, errors.New("Invalid If-Match version")
+	}
+
+	return version, true, nil
+}
+
+// Long-polling limits for handlePollDocument
+const (
+	defaultPollWait = 30 * time.Second
+	maxPollWait     = 60 * time.Second
+)
+
+func (s *Server) handlePollDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	wait := defaultPollWait
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		wait, err = time.ParseDuration(raw)
+		if err != nil || wait <= 0 {
+			s.sendResponse(w, false, nil, "Invalid wait duration")
+			return
+		}
+		if wait > maxPollWait {
+			wait = maxPollWait
+		}
+	}
+
+	// The poll may outlast the server's write timeout, so extend it for this
+	// request only
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second))
+
+	events, unsubscribe, err := s.db.Subscribe(collectionName, 16)
+	if errors.Is(err, storage.ErrTooManySubscribers) {
+		s.sendError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+	defer unsubscribe()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.ID != documentID && event.Type != storage.ChangeTruncate {
+				continue
+			}
+
+			if event.Type == storage.ChangeDelete || event.Type == storage.ChangeTruncate {
+				s.sendError(w, http.StatusNotFound, "document with id '"+documentID+"' was deleted")
+				return
+			}
+
+			document, err := collection.Get(documentID)
+			if err != nil {
+				s.sendError(w, http.StatusNotFound, err.Error())
+				return
+			}
+
+			s.sendResponse(w, true, document, "")
+			return
+		case <-timer.C:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Change feed settings for handleWatchCollection
+const (
+	// Events buffered per watcher; a watcher that falls further behind
+	// misses events rather than slowing down writers
+	watchBuffer = 256
+	// Interval between keepalive comments on an idle feed
+	watchHeartbeat = 15 * time.Second
+)
+
+// handleWatchCollection streams the collection's change events as
+// Server-Sent Events until the client disconnects
+func (s *Server) handleWatchCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	if _, err := s.db.GetCollection(collectionName); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	events, unsubscribe, err := s.db.Subscribe(collectionName, watchBuffer)
+	if errors.Is(err, storage.ErrTooManySubscribers) {
+		s.sendError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+	defer unsubscribe()
+
+	// The feed is open-ended, so lift the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := w.Write([]byte("event: " + event.Type + "\ndata: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		rc.Flush()
+	}
+}
+
+func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if r.URL.Query().Get("upsert") == "true" {
+		created, err := collection.UpsertAs(principal(r), documentID, req.Data)
+		if err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+
+		s.sendResponse(w, true, map[string]interface{}{
+			"message": "Document upserted successfully",
+			"created": created,
+		}, "")
+		return
+	}
+
+	expectedVersion, conditional, err := ifMatchVersion(r)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	if conditional {
+		err = collection.UpdateIfVersionAs(principal(r), documentID, req.Data, expectedVersion)
+	} else {
+		err = collection.UpdateAs(principal(r), documentID, req.Data)
+	}
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Document updated successfully"}, "")
+}
+
+func (s *Server) handlePatchDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	expectedVersion, conditional, err := ifMatchVersion(r)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	if conditional {
+		err = collection.MergeIfVersionAs(principal(r), documentID, req.Data, expectedVersion)
+	} else {
+		err = collection.MergeAs(principal(r), documentID, req.Data)
+	}
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Document patched successfully"}, "")
+}
+
+func (s *Server) handleSyncDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Data       map[string]interface{} `json:"data"`
+		ModifiedAt time.Time              `json:"modified_at"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.ModifiedAt.IsZero() {
+		req.ModifiedAt = time.Now()
+	}
+
+	applied, err := collection.SyncMergeAs(principal(r), documentID, req.Data, req.ModifiedAt)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	document, err := collection.Get(documentID)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]interface{}{
+		"applied":  applied,
+		"document": document,
+	}, "")
+}
+
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	if err := collection.Delete(documentID); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Document deleted successfully"}, "")
+}
+
+// Page sizes for handleDump
+const (
+	defaultDumpLimit = 1000
+	maxDumpLimit     = 10000
+)
+
+func (s *Server) handleExportDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	export, err := collection.ExportDocument(documentID)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	filename := collectionName + "-" + export.Document.ID + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+func (s *Server) handleImportDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		// Try to create the collection if it doesn't exist
+		if err := s.db.CreateCollection(collectionName); err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+		collection, _ = s.db.GetCollection(collectionName)
+	}
+
+	var export storage.DocumentExport
+	if !s.decodeJSON(w, r, &export) {
+		return
+	}
+
+	if err := collection.ImportDocument(&export); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{
+		"message": "Document imported successfully",
+		"id":      export.Document.ID,
+	}, "")
+}
+
+func (s *Server) handleDeleteField(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	documentID := vars["id"]
+	field := vars["field"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	err = collection.DeleteFieldAs(principal(r), documentID, field)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Field deleted successfully"}, "")
+}
+
+func (s *Server) handleDump(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := defaultDumpLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			s.sendResponse(w, false, nil, "Invalid limit")
+			return
+		}
+		if limit > maxDumpLimit {
+			limit = maxDumpLimit
+		}
+	}
+
+	afterID, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		s.sendResponse(w, false, nil, "Invalid cursor")
+		return
+	}
+
+	documents, next := collection.Page(afterID, limit)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", encodeCursor(next))
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handleExportCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" {
+		s.sendResponse(w, false, nil, "Unsupported export format; only csv is available")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": collectionName + ".csv"}))
+	if err := collection.ExportCSV(w); err != nil {
+		log.Printf("CSV export of collection '%s' failed: %v", collectionName, err)
+	}
+}
+
+// handleImportCollection imports a JSON array or CSV dataset, sent either as
+// the request body or as the "file" field of a multipart upload
+func (s *Server) handleImportCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		// Try to create the collection if it doesn't exist
+		if err := s.db.CreateCollection(collectionName); err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+		collection, _ = s.db.GetCollection(collectionName)
+	}
+
+	var body io.Reader = r.Body
+	format := r.URL.Query().Get("format")
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if isBodyTooLarge(err) {
+			s.sendError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			s.sendResponse(w, false, nil, "Upload must include a 'file' field")
+			return
+		}
+		defer file.Close()
+		body = file
+
+		if format == "" {
+			format = r.FormValue("format")
+		}
+		if format == "" && strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+			format = "csv"
+		}
+	}
+
+	var imported int
+	switch format {
+	case "", "json":
+		imported, err = collection.ImportJSONAsContext(r.Context(), principal(r), body)
+	case "csv":
+		imported, err = collection.ImportCSVAsContext(r.Context(), principal(r), body)
+	default:
+		s.sendResponse(w, false, nil, "Unsupported import format; use json or csv")
+		return
+	}
+
+	failed, ok := rowFailures(err)
+	if !ok || isBodyTooLarge(err) {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]interface{}{
+		"imported": imported,
+		"failed":   failed,
+	}, "")
+}
+
+// rowFailure describes a dataset row that could not be imported
+type rowFailure struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// rowFailures lists the per-row errors from a dataset import. It reports
+// false if err is not made up of row errors, meaning the import as a whole
+// failed.
+func rowFailures(err error) ([]rowFailure, bool) {
+	failed := []rowFailure{}
+	if err == nil {
+		return failed, true
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		var rowErr *storage.RowError
+		if !errors.As(err, &rowErr) {
+			return nil, false
+		}
+		failed = append(failed, rowFailure{Row: rowErr.Row, Error: rowErr.Err.Error()})
+	}
+	return failed, true
+}
+
+// encodeCursor turns a document ID into an opaque pagination cursor
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// decodeCursor recovers the document ID from a pagination cursor
+func decodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(id), err
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req queryRequest
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	filters, ok := req.filters()
+	if !ok {
+		s.sendResponse(w, false, nil, "Field is required for query")
+		return
+	}
+
+	results, err := collection.QueryMultiContext(r.Context(), filters...)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResults(w, r, results)
+}
+
+// sendResults sends query results, paginating them by ID when there are
+// more than Options.MaxQueryResults or the request asks for a later page
+func (s *Server) sendResults(w http.ResponseWriter, r *http.Request, results []*storage.Document) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := s.opts.MaxQueryResults
+	if limit > 0 && (len(results) > limit || cursor != "") {
+		afterID, err := decodeCursor(cursor)
+		if err != nil {
+			s.sendResponse(w, false, nil, "Invalid cursor")
+			return
+		}
+
+		s.sendResponse(w, true, paginateResults(results, afterID, limit), "")
+		return
+	}
+
+	s.sendResponse(w, true, results, "")
+}
+
+// queryRequest is a query filter, optionally combined with further filters
+// that must all match
+type queryRequest struct {
+	storage.Filter
+	Filters []storage.Filter `json:"filters"`
+}
+
+// filters returns every filter of the request, and false when there are
+// none or one of them has no field
+func (q queryRequest) filters() ([]storage.Filter, bool) {
+	filters := q.Filters
+	if q.Field != "" {
+		filters = append([]storage.Filter{q.Filter}, filters...)
+	}
+	if len(filters) == 0 {
+		return nil, false
+	}
+	for _, f := range filters {
+		if f.Field == "" {
+			return nil, false
+		}
+	}
+	return filters, true
+}
+
+func (s *Server) handleDeleteQuery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req queryRequest
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	filters, ok := req.filters()
+	if !ok {
+		s.sendResponse(w, false, nil, "Field is required for query")
+		return
+	}
+
+	deleted, err := collection.DeleteMatching(filters...)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]int{"deleted": deleted}, "")
+}
+
+// paginateResults returns the page of results ordered by ID that follows
+// afterID
+func paginateResults(results []*storage.Document, afterID string, limit int) QueryPage {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	start := sort.Search(len(results), func(i int) bool {
+		return results[i].ID > afterID
+	})
+
+	page := QueryPage{Documents: results[start:], Total: len(results)}
+	if len(page.Documents) > limit {
+		page.Documents = page.Documents[:limit]
+		page.NextCursor = encodeCursor(page.Documents[limit-1].ID)
+	}
+
+	return page
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	term := r.URL.Query().Get("q")
+	if term == "" {
+		s.sendResponse(w, false, nil, "Search term q is required")
+		return
+	}
+
+	caseInsensitive := r.URL.Query().Get("case_sensitive") != "true"
+	results, err := collection.SearchContext(r.Context(), term, caseInsensitive)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResults(w, r, results)
+}
+
+func (s *Server) handleDistinct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		s.sendResponse(w, false, nil, "Field is required for distinct")
+		return
+	}
+
+	s.sendResponse(w, true, collection.Distinct(field), "")
+}
+
+func (s *Server) handleGroupBy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		GroupField string `json:"group_field"`
+		Field      string `json:"field"`
+		Op         string `json:"op"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.GroupField == "" {
+		s.sendResponse(w, false, nil, "Group field is required for groupby")
+		return
+	}
+
+	if req.Op == "" {
+		req.Op = storage.AggCount
+	}
+
+	if req.Op != storage.AggCount && req.Field == "" {
+		s.sendResponse(w, false, nil, "Field is required for groupby")
+		return
+	}
+
+	groups, err := collection.GroupBy(req.GroupField, req.Field, req.Op)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, groups, "")
+}
+
+func (s *Server) handleHistogram(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	field := query.Get("field")
+	if field == "" {
+		s.sendResponse(w, false, nil, "Field is required for histogram")
+		return
+	}
+
+	width, err := strconv.ParseFloat(query.Get("width"), 64)
+	if err != nil || width <= 0 || math.IsInf(width, 0) {
+		s.sendResponse(w, false, nil, "Width must be a positive number")
+		return
+	}
+
+	// JSON object keys must be strings
+	buckets := make(map[string]int)
+	for start, count := range collection.Histogram(field, width) {
+		buckets[strconv.FormatFloat(start, 'f', -1, 64)] = count
+	}
+
+	s.sendResponse(w, true, buckets, "")
+}
+
+func (s *Server) handleCreateIndex(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Field  string `json:"field"`
+		Unique bool   `json:"unique"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
 	}
 
 	if req.Field == "" {
-		s.sendResponse(w, false, nil, "Field is required for query")
+		s.sendResponse(w, false, nil, "Field is required for index")
 		return
 	}
 
-	results := collection.Query(req.Field, req.Value)
-	s.sendResponse(w, true, results, "")
+	create := collection.CreateIndex
+	if req.Unique {
+		create = collection.CreateUniqueIndex
+	}
+	if err := create(req.Field); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Index created successfully"}, "")
+}
+
+func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, collection.ListIndexes(), "")
+}
+
+func (s *Server) handleDropIndex(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+	field := vars["field"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	if err := collection.DropIndex(field); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]string{"message": "Index dropped successfully"}, "")
+}
+
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Field   string           `json:"field"`
+		Op      string           `json:"op"`
+		Filter  *storage.Filter  `json:"filter"`
+		Filters []storage.Filter `json:"filters"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Field == "" {
+		s.sendResponse(w, false, nil, "Field is required for aggregate")
+		return
+	}
+
+	filters := req.Filters
+	if req.Filter != nil {
+		filters = append([]storage.Filter{*req.Filter}, filters...)
+	}
+
+	result, err := collection.AggregateWhere(req.Field, req.Op, filters...)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]interface{}{"field": req.Field, "op": req.Op, "result": result}, "")
+}
+
+func (s *Server) handleLabelWhere(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req struct {
+		Filter storage.Filter `json:"filter"`
+		Add    []string       `json:"add"`
+		Remove []string       `json:"remove"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		s.sendResponse(w, false, nil, "At least one label to add or remove is required")
+		return
+	}
+
+	matched, err := collection.LabelWhere(req.Filter, req.Add, req.Remove)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]int{"matched": matched}, "")
+}
+
+func (s *Server) handleVerifyChecksums(w http.ResponseWriter, r *http.Request) {
+	corrupted := s.db.VerifyChecksums()
+	s.sendResponse(w, true, map[string]interface{}{
+		"ok":        len(corrupted) == 0,
+		"corrupted": corrupted,
+	}, "")
+}
+
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	if !s.opts.AllowReset {
+		s.sendError(w, http.StatusForbidden, "Reset is disabled on this server")
+		return
+	}
+
+	var req struct {
+		Confirm bool `json:"confirm"`
+	}
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if !req.Confirm {
+		s.sendResponse(w, false, nil, "Reset requires {\"confirm\": true}")
+		return
+	}
+
+	s.db.Reset()
+	if err := s.db.SaveToDisk(); err != nil {
+		s.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Println("Database reset via admin endpoint")
+	s.sendResponse(w, true, map[string]string{"message": "Database reset successfully"}, "")
+}
+
+// TransactionRequest is a list of document writes to apply atomically
+type TransactionRequest struct {
+	Operations []storage.TxOperation `json:"operations"`
+}
+
+func (s *Server) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	var req TransactionRequest
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		s.sendResponse(w, false, nil, "At least one operation is required")
+		return
+	}
+
+	tx := s.db.BeginAs(principal(r))
+	for _, op := range req.Operations {
+		if err := tx.Add(op); err != nil {
+			s.sendStorageError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	s.sendResponse(w, true, map[string]int{"applied": len(req.Operations)}, "")
+}
+
+// BatchRequest is a list of document writes to one collection. Atomic makes
+// the batch all-or-nothing; otherwise each operation succeeds or fails on
+// its own.
+type BatchRequest struct {
+	Ops    []storage.BatchOperation `json:"ops"`
+	Atomic bool                     `json:"atomic,omitempty"`
+}
+
+// BatchResult is the outcome of one batch operation
+type BatchResult struct {
+	Op      string `json:"op"`
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collectionName := vars["collection"]
+
+	collection, err := s.db.GetCollection(collectionName)
+	if err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+
+	var req BatchRequest
+
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Ops) == 0 {
+		s.sendResponse(w, false, nil, "At least one operation is required")
+		return
+	}
+
+	errs := collection.BatchAs(principal(r), req.Ops, req.Atomic)
+	results := make([]BatchResult, len(req.Ops))
+	applied := 0
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Op: op.Op, ID: op.ID, Success: errs[i] == nil}
+		if errs[i] != nil {
+			results[i].Error = errs[i].Error()
+			continue
+		}
+		applied++
+	}
+
+	s.sendResponse(w, true, map[string]interface{}{
+		"applied": applied,
+		"results": results,
+	}, "")
+}
+
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	filename := "rafdb-backup-" + time.Now().UTC().Format("20060102T150405Z") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	if err := s.db.Backup(w); err != nil {
+		log.Printf("Backup failed: %v", err)
+	}
+}
+
+// handleRestore replaces the database with a snapshot sent as the request
+// body or as the "file" field of a multipart upload
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if len(s.opts.APIKeys) == 0 && !s.opts.AllowRestore {
+		s.sendError(w, http.StatusForbidden, "Restore requires API key authentication or -allow-restore")
+		return
+	}
+
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if isBodyTooLarge(err) {
+			s.sendError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			s.sendResponse(w, false, nil, "Upload must include a 'file' field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	if err := s.db.Restore(body); err != nil {
+		s.sendStorageError(w, err)
+		return
+	}
+	if err := s.db.SaveToDisk(); err != nil {
+		s.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Println("Database restored from uploaded snapshot")
+	s.sendResponse(w, true, map[string]interface{}{
+		"message":     "Database restored successfully",
+		"collections": len(s.db.ListCollections()),
+	}, "")
+}
+
+// Diagnostics is a snapshot of the server's runtime health
+type Diagnostics struct {
+	StartedAt       time.Time       `json:"started_at"`
+	UptimeSeconds   float64         `json:"uptime_seconds"`
+	Goroutines      int             `json:"goroutines"`
+	HeapAllocBytes  uint64          `json:"heap_alloc_bytes"`
+	HeapSysBytes    uint64          `json:"heap_sys_bytes"`
+	TotalAllocBytes uint64          `json:"total_alloc_bytes"`
+	SysBytes        uint64          `json:"sys_bytes"`
+	HeapObjects     uint64          `json:"heap_objects"`
+	NumGC           uint32          `json:"num_gc"`
+	LastGCPauseNs   uint64          `json:"last_gc_pause_ns"`
+	Subscribers     int             `json:"subscribers"`
+	BackgroundJobs  map[string]bool `json:"background_jobs"`
+}
+
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	s.sendResponse(w, true, Diagnostics{
+		StartedAt:       s.started,
+		UptimeSeconds:   time.Since(s.started).Seconds(),
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAllocBytes:  mem.HeapAlloc,
+		HeapSysBytes:    mem.HeapSys,
+		TotalAllocBytes: mem.TotalAlloc,
+		SysBytes:        mem.Sys,
+		HeapObjects:     mem.HeapObjects,
+		NumGC:           mem.NumGC,
+		LastGCPauseNs:   mem.PauseNs[(mem.NumGC+255)%256],
+		Subscribers:     s.db.SubscriberCount(),
+		BackgroundJobs:  s.db.BackgroundJobs(),
+	}, "")
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-	stats := s.db.Stats()
-	s.sendResponse(w, true, stats, "")
+	s.sendResponse(w, true, s.db.StatsStruct(), "")
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.sendResponse(w, true, version.Get(), "")
+}
+
+// Health is the readiness report returned by the health check
+type Health struct {
+	Status string `json:"status"`
+	Name   string `json:"name"`
+	version.Info
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Documents     int     `json:"documents"`
+	storage.SaveStatus
 }
 
+// handleHealth reports whether the server is ready. It responds 503 with
+// status "unhealthy" when the data file can no longer be saved, or when the
+// last Options.MaxSaveFailures saves have all failed.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	s.sendResponse(w, true, map[string]string{
-		"status":  "healthy",
-		"version": "1.0.0",
-		"name":    "RAFDB",
-	}, "")
+	health := Health{
+		Status:        "healthy",
+		Name:          "RAFDB",
+		Info:          version.Get(),
+		UptimeSeconds: time.Since(s.started).Seconds(),
+		Documents:     s.db.DocumentCount(),
+		SaveStatus:    s.db.SaveStatus(),
+	}
+
+	err := s.db.CheckPersistence()
+	if limit := s.maxSaveFailures(); err == nil && limit > 0 && health.ConsecutiveFailures >= limit {
+		err = errors.New("last " + strconv.Itoa(health.ConsecutiveFailures) + " saves failed: " + health.LastSaveError)
+	}
+	if err != nil {
+		health.Status = "unhealthy"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Data:    health,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	s.sendResponse(w, true, health, "")
 }
@@ -0,0 +1,2201 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"rafdb/pkg/storage"
+)
+
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	db := storage.NewDatabase()
+	srv := NewServer(db)
+	return srv, srv.Handler()
+}
+
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) Response {
+	t.Helper()
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected JSON response, got %v", err)
+	}
+	return resp
+}
+
+func TestTrailingSlash(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	for _, path := range []string{"/api/v1/collections", "/api/v1/collections/"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", path, rec.Code)
+		}
+
+		resp := decodeResponse(t, rec)
+		names, ok := resp.Data.([]interface{})
+		if !resp.Success || !ok || len(names) != 1 || names[0] != "users" {
+			t.Fatalf("Expected list handler response for %s, got %+v", path, resp)
+		}
+	}
+}
+
+func TestAggregateWithFilter(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"city": "NYC", "age": 20})
+	collection.Insert("user3", map[string]interface{}{"city": "Boston", "age": 70})
+
+	aggregate := func(body string) (int, Response) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/aggregate", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, decodeResponse(t, rec)
+	}
+
+	tests := []struct {
+		body     string
+		expected float64
+	}{
+		{`{"field": "age", "op": "avg"}`, 40},
+		{`{"field": "age", "op": "avg", "filter": {"field": "city", "value": "NYC"}}`, 25},
+		{`{"field": "age", "op": "sum", "filters": [{"field": "city", "value": "NYC"}, {"field": "age", "value": 20}]}`, 20},
+	}
+	for _, tt := range tests {
+		code, resp := aggregate(tt.body)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %v", tt.body, code, resp.Error)
+		}
+		if result := resp.Data.(map[string]interface{})["result"]; result != tt.expected {
+			t.Fatalf("Expected %v for %s, got %v", tt.expected, tt.body, result)
+		}
+	}
+
+	if code, _ := aggregate(`{"field": "age", "op": "sum", "filter": {"field": "city", "op": "between"}}`); code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid filter, got %d", code)
+	}
+}
+
+func TestSetSaveInterval(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("cache")
+	collection, _ := srv.db.GetCollection("cache")
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/collections/cache/save-interval", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put(`{"interval": "5m"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if collection.GetSaveInterval() != 5*time.Minute {
+		t.Fatalf("Expected a 5m save interval, got %v", collection.GetSaveInterval())
+	}
+
+	for _, body := range []string{`{"interval": "soon"}`, `{"interval": "-1m"}`} {
+		if rec := put(body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := put(`{"interval": "0"}`); rec.Code != http.StatusOK || collection.GetSaveInterval() != 0 {
+		t.Fatalf("Expected the interval to be cleared, got %d %v", rec.Code, collection.GetSaveInterval())
+	}
+}
+
+func TestPollDocument(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1/poll?wait=5s", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		done <- rec
+	}()
+
+	// Wait for the poll to subscribe before writing
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.db.SubscriberCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for poll to subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	collection.Update("user1", map[string]interface{}{"name": "John Doe"})
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		resp := decodeResponse(t, rec)
+		data := resp.Data.(map[string]interface{})["data"].(map[string]interface{})
+		if data["name"] != "John Doe" {
+			t.Fatalf("Expected updated document, got %v", data)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Expected poll to return promptly after the update")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for poll to return")
+	}
+
+	if srv.db.SubscriberCount() != 0 {
+		t.Fatalf("Expected subscription to be cleaned up, got %d", srv.db.SubscriberCount())
+	}
+}
+
+func TestPollDocumentTimeout(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1/poll?wait=50ms", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304, got %d", rec.Code)
+	}
+
+	if srv.db.SubscriberCount() != 0 {
+		t.Fatalf("Expected subscription to be cleaned up, got %d", srv.db.SubscriberCount())
+	}
+}
+
+func TestWatchCollection(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/collections/users/watch", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", ct)
+	}
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Delete("user1")
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				lines <- strings.TrimPrefix(scanner.Text(), "data: ")
+			}
+		}
+		close(lines)
+	}()
+
+	for _, expected := range []string{storage.ChangeInsert, storage.ChangeDelete} {
+		select {
+		case line := <-lines:
+			var event storage.ChangeEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("Expected a JSON event, got %q", line)
+			}
+			if event.Type != expected || event.ID != "user1" {
+				t.Fatalf("Expected %s of user1, got %+v", expected, event)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", expected)
+		}
+	}
+
+	// Disconnecting unsubscribes the watcher
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.db.SubscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected subscription to be cleaned up, got %d", srv.db.SubscriberCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebSocketChangeFeed(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	header := http.Header{"Accept-Encoding": {"gzip"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatalf("Expected WebSocket connection, got %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	read := func() map[string]interface{} {
+		t.Helper()
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Expected a message, got %v", err)
+		}
+		return msg
+	}
+
+	conn.WriteJSON(map[string]string{"action": "subscribe", "collection": "missing"})
+	if msg := read(); msg["type"] != "error" {
+		t.Fatalf("Expected error subscribing to a missing collection, got %v", msg)
+	}
+
+	conn.WriteJSON(map[string]string{"action": "subscribe", "collection": "users"})
+	if msg := read(); msg["type"] != "subscribed" || msg["collection"] != "users" {
+		t.Fatalf("Expected subscription acknowledgement, got %v", msg)
+	}
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	if msg := read(); msg["type"] != storage.ChangeInsert || msg["id"] != "user1" {
+		t.Fatalf("Expected insert event, got %v", msg)
+	}
+
+	conn.WriteJSON(map[string]string{"action": "unsubscribe", "collection": "users"})
+	if msg := read(); msg["type"] != "unsubscribed" {
+		t.Fatalf("Expected unsubscribe acknowledgement, got %v", msg)
+	}
+	if srv.db.SubscriberCount() != 0 {
+		t.Fatalf("Expected no subscribers after unsubscribing, got %d", srv.db.SubscriberCount())
+	}
+
+	// Closing the connection releases its subscriptions
+	conn.WriteJSON(map[string]string{"action": "subscribe", "collection": "users"})
+	read()
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.db.SubscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected subscription to be cleaned up, got %d", srv.db.SubscriberCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHealthReadiness(t *testing.T) {
+	dir := t.TempDir()
+	db := storage.NewDatabaseWithPath(filepath.Join(dir, "data.json"))
+	handler := NewServer(db).Handler()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	db.SaveToDisk()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	health := resp.Data.(map[string]interface{})
+	if rec.Code != http.StatusOK || health["status"] != "healthy" {
+		t.Fatalf("Expected healthy, got %d %v", rec.Code, health)
+	}
+	if health["documents"] != float64(1) || health["last_save_time"] == nil {
+		t.Fatalf("Expected document count and last save, got %v", health)
+	}
+
+	// A data directory that has gone away fails the check
+	broken := storage.NewDatabaseWithPath(filepath.Join(dir, "missing", "data.json"))
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rec = httptest.NewRecorder()
+	NewServer(broken).Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", rec.Code)
+	}
+	resp = decodeResponse(t, rec)
+	if health := resp.Data.(map[string]interface{}); health["status"] != "unhealthy" || resp.Error == "" {
+		t.Fatalf("Expected unhealthy with a reason, got %v", resp)
+	}
+}
+
+// saveStatusStore is a Store that reports a fixed save status
+type saveStatusStore struct {
+	*storage.MemStore
+	status storage.SaveStatus
+}
+
+func (s *saveStatusStore) SaveStatus() storage.SaveStatus {
+	return s.status
+}
+
+func TestHealthSaveFailures(t *testing.T) {
+	store := &saveStatusStore{MemStore: storage.NewDatabaseWithPath(filepath.Join(t.TempDir(), "data.json"))}
+	handler := NewServer(store).Handler()
+
+	health := func() (int, Response) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, decodeResponse(t, rec)
+	}
+
+	// Failures below the limit are reported but still healthy
+	store.status = storage.SaveStatus{LastSaveError: "no space left on device", SaveErrors: 2, ConsecutiveFailures: 2}
+	code, resp := health()
+	data := resp.Data.(map[string]interface{})
+	if code != http.StatusOK || data["status"] != "healthy" {
+		t.Fatalf("Expected healthy below the limit, got %d %v", code, data)
+	}
+	if data["last_save_error"] != "no space left on device" || data["save_errors"] != float64(2) || data["consecutive_save_failures"] != float64(2) {
+		t.Fatalf("Expected save failures in the health report, got %v", data)
+	}
+
+	store.status.SaveErrors, store.status.ConsecutiveFailures = 3, 3
+	code, resp = health()
+	if code != http.StatusServiceUnavailable || resp.Data.(map[string]interface{})["status"] != "unhealthy" {
+		t.Fatalf("Expected unhealthy after %d failures, got %d %v", DefaultMaxSaveFailures, code, resp.Data)
+	}
+	if !strings.Contains(resp.Error, "no space left on device") {
+		t.Fatalf("Expected the save error as the reason, got %q", resp.Error)
+	}
+
+	// A successful save ends the run
+	now := time.Now()
+	store.status = storage.SaveStatus{LastSaveTime: &now, SaveErrors: 3}
+	if code, resp := health(); code != http.StatusOK || resp.Data.(map[string]interface{})["last_save_time"] == nil {
+		t.Fatalf("Expected healthy with the last save time, got %d %v", code, resp.Data)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	stats := decodeResponse(t, rec).Data.(map[string]interface{})
+	if _, ok := stats["save_errors"]; !ok {
+		t.Fatalf("Expected save errors in stats, got %v", stats)
+	}
+
+	// A negative limit never fails the check for saves
+	store.status = storage.SaveStatus{LastSaveError: "no space left on device", SaveErrors: 10, ConsecutiveFailures: 10}
+	handler = NewServerWithOptions(store, Options{MaxSaveFailures: -1}).Handler()
+	if code, _ := health(); code != http.StatusOK {
+		t.Fatalf("Expected healthy with the limit disabled, got %d", code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	_, handler := newTestServer(t)
+
+	for _, path := range []string{"/api/v1/version", "/api/v1/health"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		info := decodeResponse(t, rec).Data.(map[string]interface{})
+		if info["version"] != "dev" || info["commit"] != "dev" || info["go_version"] != runtime.Version() {
+			t.Fatalf("Expected dev build details from %s, got %v", path, info)
+		}
+	}
+}
+
+func TestPprofHandler(t *testing.T) {
+	handler := PprofHandler()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap?debug=1", "/debug/pprof/goroutine?debug=1"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", path, rec.Code)
+		}
+	}
+
+	// Profiles are not served on the API handler
+	_, api := newTestServer(t)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code == http.StatusOK {
+		t.Fatal("Expected pprof not to be exposed by the API handler")
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{MaxBodyBytes: 64, MaxBulkBodyBytes: 1024})
+	handler := srv.Handler()
+	srv.db.CreateCollection("users")
+
+	big := `{"id": "user1", "data": {"bio": "` + strings.Repeat("x", 100) + `"}}`
+
+	// Rejected up front from Content-Length
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", strings.NewReader(big))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", rec.Code)
+	}
+	if resp := decodeResponse(t, rec); resp.Success || resp.Error == "" {
+		t.Fatalf("Expected JSON error, got %+v", resp)
+	}
+
+	// Rejected while decoding a body of unknown length
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", io.MultiReader(strings.NewReader(big)))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413 for a streamed body, got %d", rec.Code)
+	}
+
+	// Bulk endpoints use the larger limit
+	bulk := `{"documents": [` + big + `]}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents/bulk", strings.NewReader(bulk))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected bulk insert within the bulk limit to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStartInvalidAddress(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	if err := srv.Start("invalid-address:-1"); err == nil {
+		t.Fatal("Expected error starting on an invalid address")
+	}
+}
+
+func TestServeAndShutdown(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+
+	// The listener is already open, so the request succeeds without retrying
+	resp, err := http.Get("http://" + listener.Addr().String() + "/api/v1/health")
+	if err != nil {
+		t.Fatalf("Failed to reach server: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("Expected ErrServerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Shutdown")
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	srv, _ := newTestServer(t)
+	if read, write, idle := srv.Timeouts(); read != DefaultReadTimeout || write != DefaultWriteTimeout || idle != DefaultIdleTimeout {
+		t.Fatalf("Expected default timeouts, got %s, %s, %s", read, write, idle)
+	}
+
+	db := storage.NewDatabase()
+	db.CreateCollection("users")
+	srv = NewServerWithOptions(db, Options{ReadTimeout: 100 * time.Millisecond, WriteTimeout: -1, IdleTimeout: time.Minute})
+	server := srv.newHTTPServer("127.0.0.1:0", nil)
+	if server.ReadTimeout != 100*time.Millisecond || server.WriteTimeout >= 0 || server.IdleTimeout != time.Minute {
+		t.Fatalf("Expected configured timeouts, got %s, %s, %s", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go srv.Serve(listener)
+	defer srv.Shutdown(context.Background())
+
+	// Sends a body in two halves, pausing past the read timeout in between
+	slowPost := func(path, body string) (int, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte(body[:len(body)/2]))
+			time.Sleep(300 * time.Millisecond)
+			pw.Write([]byte(body[len(body)/2:]))
+			pw.Close()
+		}()
+		resp, err := http.Post("http://"+listener.Addr().String()+path, "application/json", pr)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if status, err := slowPost("/api/v1/collections/users/documents", `{"id": "user1", "data": {"name": "John"}}`); err == nil && status == http.StatusOK {
+		t.Fatal("Expected a slow request body to hit the read timeout")
+	}
+
+	status, err := slowPost("/api/v1/collections/users/documents/bulk", `{"documents": [{"id": "user2", "data": {"name": "Jane"}}]}`)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected bulk requests to be exempt from the read timeout, got %d, %v", status, err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	tempFile := "test_server_reset.json"
+	defer os.Remove(tempFile)
+
+	db := storage.NewDatabaseWithPath(tempFile)
+	db.CreateCollection("users")
+
+	// Disabled by default
+	handler := NewServer(db).Handler()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reset", strings.NewReader(`{"confirm": true}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 when reset is disabled, got %d", rec.Code)
+	}
+
+	handler = NewServerWithOptions(db, Options{AllowReset: true}).Handler()
+
+	// Requires explicit confirmation
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/admin/reset", strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without confirmation, got %d", rec.Code)
+	}
+	if len(db.ListCollections()) != 1 {
+		t.Fatal("Expected collections to survive an unconfirmed reset")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/admin/reset", strings.NewReader(`{"confirm": true}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if len(db.ListCollections()) != 0 {
+		t.Fatal("Expected all collections to be dropped")
+	}
+}
+
+func TestAuthStampsPrincipal(t *testing.T) {
+	db := storage.NewDatabase()
+	db.CreateCollection("users")
+	handler := NewServerWithOptions(db, Options{
+		APIKeys: map[string]string{"alice-key": "alice", "bob-key": "bob"},
+	}).Handler()
+
+	// Requests without a valid key are rejected
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a key, got %d", rec.Code)
+	}
+
+	// The health check stays open
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for health without a key, got %d", rec.Code)
+	}
+
+	// Client-supplied audit fields are rejected rather than trusted
+	body := `{"id": "user1", "created_by": "mallory", "data": {"name": "John"}}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "alice-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a client-supplied created_by, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body = `{"id": "user1", "data": {"name": "John"}}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "alice-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/collections/users/documents/user1", strings.NewReader(`{"data": {"age": 30}}`))
+	req.Header.Set("Authorization", "Bearer bob-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	collection, _ := db.GetCollection("users")
+	doc, _ := collection.Get("user1")
+	if doc.CreatedBy != "alice" {
+		t.Fatalf("Expected created_by 'alice', got %q", doc.CreatedBy)
+	}
+	if doc.UpdatedBy != "bob" {
+		t.Fatalf("Expected updated_by 'bob', got %q", doc.UpdatedBy)
+	}
+}
+
+func TestDumpFollowsCursors(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("items")
+	collection, _ := srv.db.GetCollection("items")
+	for i := 0; i < 7; i++ {
+		collection.Insert("item"+strconv.Itoa(i), map[string]interface{}{"n": i})
+	}
+
+	seen := make(map[string]int)
+	cursor := ""
+	for requests := 0; ; requests++ {
+		if requests > 10 {
+			t.Fatal("Too many pages")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/items/dump?limit=3&cursor="+cursor, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+
+		decoder := json.NewDecoder(rec.Body)
+		for decoder.More() {
+			var doc storage.Document
+			if err := decoder.Decode(&doc); err != nil {
+				t.Fatalf("Expected NDJSON documents, got %v", err)
+			}
+			seen[doc.ID]++
+		}
+
+		cursor = rec.Header().Get("X-Next-Cursor")
+		if cursor == "" {
+			break
+		}
+	}
+
+	if len(seen) != 7 {
+		t.Fatalf("Expected 7 documents, got %d", len(seen))
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Fatalf("Expected %s exactly once, got %d", id, count)
+		}
+	}
+}
+
+func TestGetRawDocument(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.InsertAs("alice", "user1", map[string]interface{}{"name": "John"})
+	collection.AddLabels("user1", "vip")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1?raw=true", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	if !resp.Success {
+		t.Fatalf("Expected success, got %q", resp.Error)
+	}
+
+	raw := resp.Data.(map[string]interface{})
+	for _, field := range []string{"collection", "checksum", "checksum_valid", "labels", "field_times", "created_at", "updated_at", "created_by", "updated_by"} {
+		if _, exists := raw[field]; !exists {
+			t.Fatalf("Expected raw document to include %q, got %v", field, raw)
+		}
+	}
+
+	if raw["checksum_valid"] != true || raw["created_by"] != "alice" || raw["collection"] != "users" {
+		t.Fatalf("Unexpected raw metadata: %v", raw)
+	}
+}
+
+func TestDeleteQuery(t *testing.T) {
+	db := storage.NewDatabase()
+	handler := NewServer(db).Handler()
+	db.CreateCollection("items")
+	collection, _ := db.GetCollection("items")
+	collection.Insert("a", map[string]interface{}{"kind": "widget", "price": 5})
+	collection.Insert("b", map[string]interface{}{"kind": "widget", "price": 15})
+	collection.Insert("c", map[string]interface{}{"kind": "gadget", "price": 5})
+
+	body := strings.NewReader(`{"field": "kind", "value": "widget", "filters": [{"field": "price", "op": "lt", "value": 10}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/items/documents/delete-query", body)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	if !resp.Success {
+		t.Fatalf("Expected success, got %s", resp.Error)
+	}
+	if deleted := resp.Data.(map[string]interface{})["deleted"]; deleted != float64(1) {
+		t.Fatalf("Expected 1 deleted, got %v", deleted)
+	}
+	if len(collection.List()) != 2 {
+		t.Fatalf("Expected 2 documents left, got %d", len(collection.List()))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/items/documents/delete-query", strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without a field, got %d", rec.Code)
+	}
+}
+
+func TestCreateCollectionInvalidName(t *testing.T) {
+	srv, handler := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(`{"name": "../etc"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", rec.Code)
+	}
+	if resp := decodeResponse(t, rec); !strings.Contains(resp.Error, "..") {
+		t.Fatalf("Expected error to explain the invalid name, got %q", resp.Error)
+	}
+	if len(srv.db.ListCollections()) != 0 {
+		t.Fatal("Expected no collection to be created")
+	}
+}
+
+func TestStorageErrorStatus(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/api/v1/collections/missing/documents", "", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/collections/users/documents/missing", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/collections/users/documents/missing", "", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/collections", `{"name": "users"}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/collections/users/documents", `{"id": "user1", "data": {}}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestRejectUnknownFields(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/v1/collections", `{"naem": "x"}`},
+		{http.MethodPost, "/api/v1/collections/users/documents", `{"id": "user1", "dta": {}}`},
+		{http.MethodPut, "/api/v1/collections/users/documents/user1", `{"data": {}, "upsert": true}`},
+		{http.MethodPost, "/api/v1/collections/users/query", `{"field": "name", "vaule": "John"}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status 400, got %d", tt.method, tt.path, rec.Code)
+			continue
+		}
+		if resp := decodeResponse(t, rec); !strings.Contains(resp.Error, "Unknown field") {
+			t.Errorf("%s %s: expected unknown field error, got %q", tt.method, tt.path, resp.Error)
+		}
+	}
+
+	if len(srv.db.ListCollections()) != 1 {
+		t.Fatalf("Expected no nameless collection, got %v", srv.db.ListCollections())
+	}
+}
+
+func TestCollectionMetadata(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	srv.db.CreateCollection("orders")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/collections/users/metadata", strings.NewReader(`{"metadata": {"owner": "growth"}}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if resp := decodeResponse(t, rec); !resp.Success {
+		t.Fatalf("Expected success, got %s", resp.Error)
+	}
+
+	// Plain listings stay a list of names
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil))
+	if names := decodeResponse(t, rec).Data.([]interface{}); names[0] != "orders" && names[0] != "users" {
+		t.Fatalf("Expected collection names, got %v", names)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections?detailed=true", nil))
+	var resp struct {
+		Data []storage.CollectionInfo `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected JSON response, got %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("Expected 2 collections, got %d", len(resp.Data))
+	}
+	for _, info := range resp.Data {
+		if info.Name == "users" && info.Metadata["owner"] != "growth" {
+			t.Fatalf("Expected users metadata, got %v", info.Metadata)
+		}
+		if info.Name == "orders" && info.Metadata != nil {
+			t.Fatalf("Expected no orders metadata, got %v", info.Metadata)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/collections/missing/metadata", strings.NewReader(`{"metadata": {}}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing collection, got %d", rec.Code)
+	}
+}
+
+func TestListCollectionsDetailed(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	srv.db.CreateCollection("orders")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane"})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections?detailed=true", nil))
+	var resp struct {
+		Data []storage.CollectionInfo `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected JSON response, got %v", err)
+	}
+
+	if len(resp.Data) != 2 || resp.Data[0].Name != "orders" || resp.Data[1].Name != "users" {
+		t.Fatalf("Expected orders and users in name order, got %+v", resp.Data)
+	}
+	if resp.Data[0].Count != 0 || resp.Data[1].Count != 2 {
+		t.Fatalf("Expected counts 0 and 2, got %d and %d", resp.Data[0].Count, resp.Data[1].Count)
+	}
+	if resp.Data[1].CreatedAt.IsZero() {
+		t.Fatal("Expected a creation time")
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	get := httptest.NewRecorder()
+	handler.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1", nil))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/v1/collections/users/documents/user1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("Expected no body, got %q", rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag == "" || etag != get.Header().Get("ETag") {
+		t.Fatalf("Expected ETag %q, got %q", get.Header().Get("ETag"), etag)
+	}
+	if length := rec.Header().Get("Content-Length"); length != strconv.Itoa(get.Body.Len()) {
+		t.Fatalf("Expected Content-Length %d, got %q", get.Body.Len(), length)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/v1/collections/users/documents/missing", nil))
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Fatalf("Expected an empty 404 for a missing document, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/v1/collections/users", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Document-Count") != "1" {
+		t.Fatalf("Expected 200 with a document count of 1, got %d %q", rec.Code, rec.Header().Get("X-Document-Count"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/v1/collections/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a missing collection, got %d", rec.Code)
+	}
+}
+
+func TestListDocumentsStream(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	list := func(url string) []storage.Document {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var resp struct {
+			Success bool               `json:"success"`
+			Data    []storage.Document `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Expected a valid JSON response, got %q: %v", rec.Body.String(), err)
+		}
+		if !resp.Success || resp.Data == nil {
+			t.Fatalf("Expected a successful response with a data array, got %q", rec.Body.String())
+		}
+		return resp.Data
+	}
+
+	if docs := list("/api/v1/collections/users/documents"); len(docs) != 0 {
+		t.Fatalf("Expected no documents, got %d", len(docs))
+	}
+
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane", "age": 25})
+	collection.Insert("user3", map[string]interface{}{"name": "Bob", "age": 41})
+
+	docs := list("/api/v1/collections/users/documents")
+	if len(docs) != 3 || docs[0].ID != "user1" || docs[2].ID != "user3" {
+		t.Fatalf("Expected three documents in creation order, got %+v", docs)
+	}
+
+	docs = list("/api/v1/collections/users/documents?sort=age&order=desc")
+	if len(docs) != 3 || docs[0].ID != "user3" || docs[2].ID != "user2" {
+		t.Fatalf("Expected three documents sorted by age, got %+v", docs)
+	}
+}
+
+// countingStore is a Store that wraps the in-memory one and counts
+// collections created through it
+type countingStore struct {
+	*storage.MemStore
+	created int
+}
+
+func (s *countingStore) CreateCollection(name string) error {
+	s.created++
+	return s.MemStore.CreateCollection(name)
+}
+
+func TestCustomStore(t *testing.T) {
+	store := &countingStore{MemStore: storage.NewMemStore()}
+	handler := NewServer(store).Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(`{"name": "users"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if store.created != 1 {
+		t.Fatalf("Expected the server to create the collection through the store, got %d calls", store.created)
+	}
+	if _, err := store.GetCollection("users"); err != nil {
+		t.Fatalf("Expected collection in the store, got %v", err)
+	}
+}
+
+func TestCreateUniqueIndex(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/indexes", strings.NewReader(`{"field": "email", "unique": true}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", strings.NewReader(`{"id": "user2", "data": {"email": "john@example.com"}}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for a duplicate value, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListAndDropIndexes(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+	collection.CreateUniqueIndex("email")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/indexes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data []storage.IndexInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected JSON response, got %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0] != (storage.IndexInfo{Field: "email", Unique: true, Cardinality: 1}) {
+		t.Fatalf("Expected the unique email index, got %+v", resp.Data)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/collections/users/indexes/email", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if indexes := collection.ListIndexes(); len(indexes) != 0 {
+		t.Fatalf("Expected no indexes, got %v", indexes)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/collections/users/indexes/email", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing index, got %d", rec.Code)
+	}
+}
+
+func TestInsertWithoutData(t *testing.T) {
+	_, handler := newTestServer(t)
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/v1/collections/users/documents", `{"id": "user1"}`},
+		{http.MethodPost, "/api/v1/collections/users/query", `{"field": "name", "value": "John"}`},
+		{http.MethodPatch, "/api/v1/collections/users/documents/user1", `{"data": {"name": "John"}}`},
+		{http.MethodGet, "/api/v1/collections/users/documents/user1", ""},
+	}
+	for _, r := range requests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, strings.NewReader(r.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s %s, got %d: %s", r.method, r.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestReservedFields(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/v1/collections/users/query", `{"field": "created_at", "value": "2024-01-01"}`},
+		{http.MethodGet, "/api/v1/collections/users/documents?sort=id", ""},
+	}
+	for _, r := range requests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, strings.NewReader(r.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %s %s, got %d: %s", r.method, r.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// A conflicting id in data is dropped in favour of the document's own
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/documents", strings.NewReader(`{"id": "user1", "data": {"id": "other", "name": "John"}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	collection, _ := srv.db.GetCollection("users")
+	if doc, err := collection.Get("user1"); err != nil || doc.Data["id"] != nil || doc.Data["name"] != "John" {
+		t.Fatalf("Expected user1 stored without the conflicting id, got %v", err)
+	}
+}
+
+func TestBulkUpsert(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("bulk", map[string]interface{}{"name": "John"})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/collections/users/bulk", strings.NewReader(`{"documents": {"bulk": {"name": "Jane"}, "user2": {"name": "Bob"}}}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	result := decodeResponse(t, rec).Data.(map[string]interface{})
+	if rec.Code != http.StatusOK || result["created"] != float64(1) || result["updated"] != float64(1) {
+		t.Fatalf("Expected 1 created and 1 updated, got %d %v", rec.Code, result)
+	}
+
+	// A document named "bulk" is updated like any other
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/collections/users/documents/bulk", strings.NewReader(`{"data": {"name": "Alice"}}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if doc, _ := collection.Get("bulk"); doc.Data["name"] != "Alice" {
+		t.Fatalf("Expected document 'bulk' to be updated, got %v", doc.Data)
+	}
+}
+
+func TestTruncateCollection(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/truncate", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if resp := decodeResponse(t, rec); !resp.Success {
+		t.Fatalf("Expected success, got %s", resp.Error)
+	}
+	if len(collection.List()) != 0 {
+		t.Fatalf("Expected empty collection, got %d documents", len(collection.List()))
+	}
+	if _, err := srv.db.GetCollection("users"); err != nil {
+		t.Fatal("Expected collection to still exist")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("posts")
+	collection, _ := srv.db.GetCollection("posts")
+	collection.Insert("p1", map[string]interface{}{"body": "Hello World"})
+	collection.Insert("p2", map[string]interface{}{"body": "Goodbye"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/posts/search?q=world", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	results, _ := resp.Data.([]interface{})
+	if !resp.Success || len(results) != 1 {
+		t.Fatalf("Expected one result, got %v", resp.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/collections/posts/search?q=world&case_sensitive=true", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if results, _ := decodeResponse(t, rec).Data.([]interface{}); len(results) != 0 {
+		t.Fatalf("Expected no case-sensitive results, got %v", results)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/collections/posts/search", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without a search term, got %d", rec.Code)
+	}
+}
+
+func TestQueryRegexInvalidPattern(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	body := strings.NewReader(`{"field": "email", "op": "regex", "value": "[a-"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/query", body)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+	if resp := decodeResponse(t, rec); !strings.Contains(resp.Error, "invalid regex pattern") {
+		t.Fatalf("Expected an invalid pattern message, got %q", resp.Error)
+	}
+}
+
+func TestQueryCaseInsensitive(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC"})
+	collection.Insert("user2", map[string]interface{}{"city": "nyc"})
+	collection.Insert("user3", map[string]interface{}{"city": "Nyc", "zip": 10001})
+
+	for body, want := range map[string]int{
+		`{"field": "city", "value": "Nyc", "caseInsensitive": true}`:                                                  3,
+		`{"filters": [{"field": "city", "value": "NYC", "caseInsensitive": true}, {"field": "zip", "value": 10001}]}`: 1,
+		`{"field": "city", "value": "Nyc", "filters": [{"field": "zip", "op": "exists"}]}`:                            1,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/query", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		resp := decodeResponse(t, rec)
+		if !resp.Success {
+			t.Fatalf("%s: expected success, got %s", body, resp.Error)
+		}
+		if results := resp.Data.([]interface{}); len(results) != want {
+			t.Errorf("%s: expected %d results, got %d", body, want, len(results))
+		}
+	}
+}
+
+func TestQueryIn(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("orders")
+	collection, _ := srv.db.GetCollection("orders")
+	collection.Insert("o1", map[string]interface{}{"status": "active"})
+	collection.Insert("o2", map[string]interface{}{"status": "pending"})
+	collection.Insert("o3", map[string]interface{}{"status": "closed"})
+
+	body := strings.NewReader(`{"field": "status", "op": "in", "value": ["active", "pending"]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/orders/query", body)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	if results, _ := resp.Data.([]interface{}); !resp.Success || len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %v", resp.Data)
+	}
+}
+
+func TestQueryContains(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("posts")
+	collection, _ := srv.db.GetCollection("posts")
+	collection.Insert("p1", map[string]interface{}{"tags": []interface{}{"go", "db"}})
+	collection.Insert("p2", map[string]interface{}{"tags": []interface{}{"rust"}})
+
+	body := strings.NewReader(`{"field": "tags", "op": "contains", "value": "go"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/posts/query", body)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := decodeResponse(t, rec)
+	if results, _ := resp.Data.([]interface{}); !resp.Success || len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %v", resp.Data)
+	}
+}
+
+func TestQueryPaginatesOversizedResults(t *testing.T) {
+	db := storage.NewDatabase()
+	handler := NewServerWithOptions(db, Options{MaxQueryResults: 3}).Handler()
+	db.CreateCollection("items")
+	collection, _ := db.GetCollection("items")
+	for i := 0; i < 5; i++ {
+		collection.Insert("item"+strconv.Itoa(i), map[string]interface{}{"kind": "widget"})
+	}
+	collection.Insert("other", map[string]interface{}{"kind": "gadget"})
+
+	query := func(cursor string) QueryPage {
+		body := strings.NewReader(`{"field": "kind", "value": "widget"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/items/query?cursor="+cursor, body)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var resp struct {
+			Success bool      `json:"success"`
+			Data    QueryPage `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || !resp.Success {
+			t.Fatalf("Expected a successful paginated response, got %v", err)
+		}
+		return resp.Data
+	}
+
+	first := query("")
+	if len(first.Documents) != 3 || first.Total != 5 || first.NextCursor == "" {
+		t.Fatalf("Expected first page of 3 of 5 with a cursor, got %+v", first)
+	}
+
+	second := query(first.NextCursor)
+	if len(second.Documents) != 2 || second.NextCursor != "" {
+		t.Fatalf("Expected final page of 2 without a cursor, got %+v", second)
+	}
+	if second.Documents[0].ID != "item3" {
+		t.Fatalf("Expected second page to continue after the first, got %s", second.Documents[0].ID)
+	}
+
+	// Small result sets keep the plain list response
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/items/query", strings.NewReader(`{"field": "kind", "value": "gadget"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if docs, ok := decodeResponse(t, rec).Data.([]interface{}); !ok || len(docs) != 1 {
+		t.Fatal("Expected a plain list for results under the threshold")
+	}
+}
+
+func TestUpdateIfMatch(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("Expected ETag \"1\", got %q", etag)
+	}
+
+	update := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/collections/users/documents/user1", strings.NewReader(`{"data": {"name": "`+name+`"}}`))
+		req.Header.Set("If-Match", etag)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := update("Jane"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if rec := update("Bob"); rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for a stale version, got %d", rec.Code)
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "Jane" {
+		t.Fatalf("Expected stale update to be rejected, got %v", doc.Data)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{
+		RequestTimeout: 20 * time.Millisecond,
+		TimeoutStatus:  http.StatusServiceUnavailable,
+	})
+
+	// A slow operation that only stops when its context is cancelled
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			srv.sendResponse(w, false, nil, r.Context().Err().Error())
+		case <-time.After(5 * time.Second):
+			srv.sendResponse(w, true, "finished", "")
+		}
+	})
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil)
+	rec := httptest.NewRecorder()
+	srv.withTimeout(slow).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the request to be cancelled promptly, took %v", elapsed)
+	}
+	if resp := decodeResponse(t, rec); resp.Error != "Request timed out" {
+		t.Fatalf("Expected timeout error, got %q", resp.Error)
+	}
+}
+
+func TestExportImportDocument(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1/export", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Expected an attachment, got %d %q", rec.Code, rec.Header().Get("Content-Disposition"))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/collections/archive/documents/import", rec.Body)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if resp := decodeResponse(t, rec); !resp.Success {
+		t.Fatalf("Expected import to succeed, got %q", resp.Error)
+	}
+
+	archive, err := srv.db.GetCollection("archive")
+	if err != nil {
+		t.Fatalf("Expected import to create the collection, got %v", err)
+	}
+	doc, err := archive.Get("user1")
+	if err != nil || doc.Data["name"] != "John" {
+		t.Fatalf("Expected imported document, got %v, %v", doc, err)
+	}
+}
+
+func TestPollDocumentSubscriberLimit(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	srv.db.(*storage.MemStore).SetSubscriberLimits(1, 0)
+
+	_, unsubscribe, err := srv.db.Subscribe("users", 1)
+	if err != nil {
+		t.Fatalf("Expected no error subscribing, got %v", err)
+	}
+	defer unsubscribe()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/documents/user1/poll?wait=1s", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 when the subscriber limit is reached, got %d", rec.Code)
+	}
+}
+
+func TestReadOnlyAPIKey(t *testing.T) {
+	db := storage.NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	handler := NewServerWithOptions(db, Options{
+		APIKeys:     map[string]string{"reader-key": "reader", "writer-key": "writer"},
+		APIKeyRoles: map[string]string{"reader-key": RoleRead},
+		AllowReset:  true,
+	}).Handler()
+
+	do := func(method, path, body, key string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	writes := []struct{ method, path, body string }{
+		{http.MethodPost, "/api/v1/collections", `{"name": "orders"}`},
+		{http.MethodDelete, "/api/v1/collections/users", ``},
+		{http.MethodPost, "/api/v1/collections/users/documents", `{"id": "user2", "data": {}}`},
+		{http.MethodPost, "/api/v1/collections/users/documents/bulk", `{"documents": [{"id": "user2", "data": {}}]}`},
+		{http.MethodPut, "/api/v1/collections/users/bulk", `{"documents": {"user2": {}}}`},
+		{http.MethodPost, "/api/v1/collections/users/documents/import", `{}`},
+		{http.MethodPost, "/api/v1/collections/users/documents/user1/sync", `{"data": {}}`},
+		{http.MethodPut, "/api/v1/collections/users/documents/user1", `{"data": {}}`},
+		{http.MethodPatch, "/api/v1/collections/users/documents/user1", `{"data": {}}`},
+		{http.MethodDelete, "/api/v1/collections/users/documents/user1", ``},
+		{http.MethodPost, "/api/v1/collections/users/indexes", `{"field": "name"}`},
+		{http.MethodPost, "/api/v1/collections/users/label-where", `{"filter": {"field": "name", "value": "John"}, "add": ["vip"]}`},
+		{http.MethodPost, "/api/v1/admin/reset", `{"confirm": true}`},
+	}
+	for _, w := range writes {
+		if code := do(w.method, w.path, w.body, "reader-key"); code != http.StatusForbidden {
+			t.Fatalf("Expected 403 for read-only %s %s, got %d", w.method, w.path, code)
+		}
+	}
+
+	doc, err := collection.Get("user1")
+	if err != nil || doc.Data["name"] != "John" || doc.Version != 1 {
+		t.Fatalf("Expected read-only requests to leave data untouched, got %v, %v", doc, err)
+	}
+
+	reads := []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/health", ``},
+		{http.MethodGet, "/api/v1/collections", ``},
+		{http.MethodGet, "/api/v1/collections/users/documents/user1", ``},
+		{http.MethodPost, "/api/v1/collections/users/query", `{"field": "name", "value": "John"}`},
+		{http.MethodPost, "/api/v1/collections/users/aggregate", `{"field": "age", "op": "sum"}`},
+		{http.MethodGet, "/api/v1/stats", ``},
+	}
+	for _, r := range reads {
+		if code := do(r.method, r.path, r.body, "reader-key"); code == http.StatusForbidden || code == http.StatusUnauthorized {
+			t.Fatalf("Expected read-only key to be allowed %s %s, got %d", r.method, r.path, code)
+		}
+	}
+
+	if code := do(http.MethodPatch, "/api/v1/collections/users/documents/user1", `{"data": {"age": 30}}`, "writer-key"); code != http.StatusOK {
+		t.Fatalf("Expected read-write key to update, got %d", code)
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var text, jsonLines bytes.Buffer
+
+	handler := NewServerWithOptions(storage.NewDatabase(), Options{
+		RequestLogFormat: LogFormatText,
+		RequestLogOutput: &text,
+	}).Handler()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/collections/missing/documents/x", nil))
+	if !strings.Contains(text.String(), "GET /api/v1/collections/missing/documents/x 404 ") {
+		t.Fatalf("Expected text log line with method, path and status, got %q", text.String())
+	}
+
+	handler = NewServerWithOptions(storage.NewDatabase(), Options{
+		RequestLogFormat: LogFormatJSON,
+		RequestLogOutput: &jsonLines,
+	}).Handler()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+
+	var entry struct {
+		Method     string  `json:"method"`
+		Path       string  `json:"path"`
+		Status     int     `json:"status"`
+		DurationMS float64 `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(jsonLines.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", jsonLines.String(), err)
+	}
+	if entry.Method != http.MethodGet || entry.Path != "/api/v1/health" || entry.Status != http.StatusOK {
+		t.Fatalf("Unexpected log entry: %+v", entry)
+	}
+}
+
+func TestDeleteField(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John", "address": map[string]interface{}{"city": "NYC"}})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/collections/users/documents/user1/fields/address.city", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	doc, _ := collection.Get("user1")
+	if city, exists := doc.Data["address"].(map[string]interface{})["city"]; exists {
+		t.Fatalf("Expected nested field to be removed, got %v", city)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/collections/users/documents/user1/fields/age", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an absent field, got %d", rec.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	for _, path := range []string{"/api/v1/collections/users/documents/user1", "/api/v1/collections/users/documents/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected text metrics, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`rafdb_http_requests_total{method="GET",route="/api/v1/collections/{collection}/documents/{id}",status="200"} 1`,
+		`rafdb_http_requests_total{method="GET",route="/api/v1/collections/{collection}/documents/{id}",status="404"} 1`,
+		`rafdb_http_request_duration_seconds_bucket{route="/api/v1/collections/{collection}/documents/{id}",le="+Inf"} 2`,
+		`rafdb_http_request_duration_seconds_count{route="/api/v1/collections/{collection}/documents/{id}"} 2`,
+		"rafdb_collections 1",
+		"rafdb_documents 1",
+		`rafdb_collection_documents{collection="users"} 1`,
+		`rafdb_collection_size_bytes{collection="users"} `,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	srv, handler := newTestServer(t)
+	stop := srv.db.(*storage.MemStore).StartExpirySweeper(time.Hour)
+	defer stop()
+
+	_, unsubscribe, err := srv.db.Subscribe("users", 1)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer unsubscribe()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/diagnostics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Data Diagnostics `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode diagnostics: %v", err)
+	}
+
+	diag := resp.Data
+	if diag.Goroutines < 1 || diag.HeapAllocBytes == 0 || diag.HeapObjects == 0 || diag.SysBytes == 0 {
+		t.Errorf("Expected positive runtime stats, got %+v", diag)
+	}
+	if !diag.StartedAt.Equal(srv.started) || diag.UptimeSeconds <= 0 {
+		t.Errorf("Expected uptime since the server started, got %v and %v", diag.StartedAt, diag.UptimeSeconds)
+	}
+	if diag.Subscribers != 1 {
+		t.Errorf("Expected 1 subscriber, got %d", diag.Subscribers)
+	}
+	if !diag.BackgroundJobs["expiry_sweeper"] || diag.BackgroundJobs["autosave"] {
+		t.Errorf("Expected only the sweeper to be running, got %v", diag.BackgroundJobs)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{RateLimit: 1, RateBurst: 2})
+	handler := srv.Handler()
+
+	get := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected burst request %d to succeed, got %d", i, rec.Code)
+		}
+	}
+
+	rec := get("", "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+	if resp := decodeResponse(t, rec); resp.Success || resp.Error == "" {
+		t.Errorf("Expected a JSON error, got %+v", resp)
+	}
+
+	// Other clients have their own buckets
+	if rec := get("", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another IP to be allowed, got %d", rec.Code)
+	}
+	if rec := get("made-up-key", "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unauthenticated API key not to get its own bucket, got %d", rec.Code)
+	}
+
+	// The health check is never limited
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected health check to bypass the limit, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{
+		RateLimit: 1,
+		RateBurst: 1,
+		APIKeys:   map[string]string{"alice-key": "alice", "alice-key-2": "alice", "bob-key": "bob"},
+	})
+	handler := srv.Handler()
+
+	get := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get("alice-key"); code != http.StatusOK {
+		t.Fatalf("Expected first request to succeed, got %d", code)
+	}
+	// Keys of the same principal share a bucket
+	if code := get("alice-key-2"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 for the same principal, got %d", code)
+	}
+	if code := get("bob-key"); code != http.StatusOK {
+		t.Fatalf("Expected another principal to be limited separately, got %d", code)
+	}
+	// Invented keys never get a bucket of their own; they are charged to
+	// the client IP, so guessing keys is throttled too
+	if code := get("fake-1"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for an invalid key, got %d", code)
+	}
+	if code := get("fake-2"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 for repeated invalid keys, got %d", code)
+	}
+	if code := get("bob-key"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected bob to still be limited by its own bucket, got %d", code)
+	}
+}
+
+func TestRateLimitInvalidKeys(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{
+		RateLimit: 1,
+		RateBurst: 3,
+		APIKeys:   map[string]string{"alice-key": "alice"},
+	})
+	handler := srv.Handler()
+
+	get := func(key, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/collections", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	limited := false
+	for i := 0; i < 10; i++ {
+		code := get("guess-"+strconv.Itoa(i), "10.0.0.1:1234")
+		if code == http.StatusTooManyRequests {
+			limited = true
+			break
+		}
+		if code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for an invalid key, got %d", code)
+		}
+	}
+	if !limited {
+		t.Fatal("Expected repeated invalid keys to eventually get status 429")
+	}
+
+	// A valid key is limited by its principal, not the guessing IP
+	if code := get("alice-key", "10.0.0.1:1234"); code != http.StatusOK {
+		t.Fatalf("Expected a valid key to be allowed, got %d", code)
+	}
+}
+
+func TestRateLimiterRefillAndCleanup(t *testing.T) {
+	limiter := newRateLimiter(2, 1)
+	now := time.Now()
+
+	if ok, _ := limiter.allow("a", now); !ok {
+		t.Fatal("Expected first request to be allowed")
+	}
+	ok, wait := limiter.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("Expected to wait 500ms, got allowed=%v wait=%v", ok, wait)
+	}
+	if ok, _ := limiter.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("Expected the bucket to refill")
+	}
+
+	limiter.allow("b", now.Add(time.Second+rateLimitIdleTTL))
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("Expected idle bucket to be cleaned up, got %d buckets", len(limiter.buckets))
+	}
+	if _, exists := limiter.buckets["b"]; !exists {
+		t.Fatal("Expected the active bucket to remain")
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{GzipMinSize: 512})
+	handler := srv.Handler()
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	for i := 0; i < 50; i++ {
+		collection.Insert("user"+strconv.Itoa(i), map[string]interface{}{"name": "John", "bio": strings.Repeat("x", 20)})
+	}
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plain := get("/api/v1/collections/users/documents", "")
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatal("Expected no compression without Accept-Encoding")
+	}
+
+	compressed := get("/api/v1/collections/users/documents", "deflate, gzip")
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", compressed.Header().Get("Content-Encoding"))
+	}
+	if compressed.Body.Len() >= plain.Body.Len() {
+		t.Errorf("Expected compressed body to be smaller than %d bytes, got %d", plain.Body.Len(), compressed.Body.Len())
+	}
+
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatalf("Failed to read gzip body: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	if !bytes.Equal(decompressed, plain.Body.Bytes()) {
+		t.Error("Expected decompressed body to match the uncompressed response")
+	}
+
+	// Small responses are sent as is
+	small := get("/api/v1/health", "gzip")
+	if small.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected small response not to be compressed")
+	}
+	if resp := decodeResponse(t, small); !resp.Success {
+		t.Errorf("Expected readable health response, got %+v", resp)
+	}
+
+	// Clients refusing gzip get plain responses
+	if refused := get("/api/v1/collections/users/documents", "gzip;q=0"); refused.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected no compression when gzip is refused")
+	}
+}
+
+func TestGzipDoesNotDoubleCompress(t *testing.T) {
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{GzipMinSize: 1})
+	body := []byte(strings.Repeat("already encoded ", 10))
+	handler := srv.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write(body)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "br" || !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Fatalf("Expected body to pass through untouched, got %q %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestExportCollectionCSV(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/export?format=csv", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Expected CSV, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || lines[0] != "id,created_at,updated_at,name" || !strings.HasPrefix(lines[1], "user1,") {
+		t.Errorf("Unexpected CSV body %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/users/export?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unsupported format, got %d", rec.Code)
+	}
+}
+
+func TestImportCollection(t *testing.T) {
+	srv, handler := newTestServer(t)
+
+	// JSON array in the request body, creating the collection
+	rec := httptest.NewRecorder()
+	body := `[{"id": "user1", "name": "John"}, {"id": "user1", "name": "Duplicate"}]`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/import", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Imported int          `json:"imported"`
+			Failed   []rowFailure `json:"failed"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Data.Imported != 1 || len(resp.Data.Failed) != 1 || resp.Data.Failed[0].Row != 2 {
+		t.Fatalf("Expected 1 imported and row 2 failed, got %+v", resp.Data)
+	}
+
+	// CSV as a multipart upload, detected from the file name
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	part, _ := form.CreateFormFile("file", "users.csv")
+	part.Write([]byte("id,name,age\nuser2,Jane,25\n"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/import", &upload)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	collection, _ := srv.db.GetCollection("users")
+	user2, err := collection.Get("user2")
+	if err != nil || user2.Data["age"] != float64(25) {
+		t.Fatalf("Expected imported CSV document with a numeric age, got %v (%v)", user2, err)
+	}
+
+	// Malformed input fails as a whole
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/import?format=json", strings.NewReader("not json")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for malformed input, got %d", rec.Code)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("accounts")
+	accounts, _ := srv.db.GetCollection("accounts")
+	accounts.Insert("alice", map[string]interface{}{"balance": 100})
+	accounts.Insert("bob", map[string]interface{}{"balance": 0})
+
+	transact := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/transaction", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := transact(`{"operations": [
+		{"op": "update", "collection": "accounts", "id": "alice", "data": {"balance": 60}},
+		{"op": "update", "collection": "accounts", "id": "carol", "data": {"balance": 40}}
+	]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an operation on a missing document, got %d", rec.Code)
+	}
+	alice, _ := accounts.Get("alice")
+	if alice.Data["balance"] != 100 {
+		t.Fatalf("Expected alice to be unchanged, got %v", alice.Data["balance"])
+	}
+
+	rec = transact(`{"operations": [
+		{"op": "update", "collection": "accounts", "id": "alice", "data": {"balance": 60}},
+		{"op": "update", "collection": "accounts", "id": "bob", "data": {"balance": 40}}
+	]}`)
+	if resp := decodeResponse(t, rec); !resp.Success {
+		t.Fatalf("Expected success, got %s", resp.Error)
+	}
+	bob, _ := accounts.Get("bob")
+	if bob.Data["balance"] != float64(40) {
+		t.Fatalf("Expected bob's balance to be 40, got %v", bob.Data["balance"])
+	}
+
+	if rec := transact(`{"operations": [{"op": "upsert", "collection": "accounts", "id": "bob"}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an unknown operation, got %d", rec.Code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+
+	batch := func(body string) Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/collections/users/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return decodeResponse(t, rec)
+	}
+
+	resp := batch(`{"ops": [
+		{"op": "insert", "id": "a", "data": {"name": "Alice"}},
+		{"op": "delete", "id": "b"}
+	]}`)
+	if !resp.Success {
+		t.Fatalf("Expected success, got %s", resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	results := data["results"].([]interface{})
+	if data["applied"] != float64(1) || len(results) != 2 {
+		t.Fatalf("Expected 1 of 2 operations applied, got %v", data)
+	}
+	if first := results[0].(map[string]interface{}); first["success"] != true {
+		t.Fatalf("Expected the insert to succeed, got %v", first)
+	}
+	if second := results[1].(map[string]interface{}); second["success"] != false || second["error"] == "" {
+		t.Fatalf("Expected the delete to fail, got %v", second)
+	}
+
+	resp = batch(`{"atomic": true, "ops": [
+		{"op": "insert", "id": "c", "data": {"name": "Carol"}},
+		{"op": "delete", "id": "b"}
+	]}`)
+	if applied := resp.Data.(map[string]interface{})["applied"]; applied != float64(0) {
+		t.Fatalf("Expected nothing applied atomically, got %v", applied)
+	}
+	collection, _ := srv.db.GetCollection("users")
+	if _, err := collection.Get("c"); err == nil {
+		t.Fatal("Expected no partial insert")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	tempFile := "test_server_restore.json"
+	defer os.Remove(tempFile)
+
+	db := storage.NewDatabaseWithPath(tempFile)
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	handler := NewServerWithOptions(db, Options{
+		APIKeys: map[string]string{"admin-key": "admin"},
+	}).Handler()
+
+	do := func(method, path string, body io.Reader, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/backup", nil, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected backup to require authentication, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/v1/restore", strings.NewReader("{}"), ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected restore to require authentication, got %d", rec.Code)
+	}
+
+	backup := do(http.MethodGet, "/api/v1/backup", nil, "admin-key")
+	if backup.Code != http.StatusOK || !strings.Contains(backup.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Expected a backup download, got %d", backup.Code)
+	}
+	snapshot := backup.Body.Bytes()
+
+	db.DeleteCollection("users")
+
+	// A bad upload is rejected without touching the database
+	if rec := do(http.MethodPost, "/api/v1/restore", strings.NewReader(`{"collections": {"x": null}}`), "admin-key"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid snapshot, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/restore", bytes.NewReader(snapshot), "admin-key"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restored, err := db.GetCollection("users")
+	if err != nil {
+		t.Fatalf("Expected restored collection, got %v", err)
+	}
+	if doc, err := restored.Get("user1"); err != nil || doc.Data["name"] != "John" {
+		t.Fatalf("Expected restored document, got %v (%v)", doc, err)
+	}
+}
+
+func TestRestoreRequiresAuthOrOptIn(t *testing.T) {
+	db := storage.NewDatabaseWithPath(filepath.Join(t.TempDir(), "db.json"))
+	db.CreateCollection("users")
+	var snapshot bytes.Buffer
+	if err := db.Backup(&snapshot); err != nil {
+		t.Fatalf("Expected no error backing up, got %v", err)
+	}
+
+	restore := func(opts Options) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/restore", bytes.NewReader(snapshot.Bytes()))
+		NewServerWithOptions(db, opts).Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := restore(Options{}); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without authentication, got %d", code)
+	}
+	if code := restore(Options{AllowRestore: true}); code != http.StatusOK {
+		t.Errorf("Expected status 200 with -allow-restore, got %d", code)
+	}
+}
+
+func TestCopyAndRenameCollection(t *testing.T) {
+	srv, handler := newTestServer(t)
+	srv.db.CreateCollection("users")
+	collection, _ := srv.db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := post("/api/v1/collections/users/copy", `{"name": "sandbox"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 copying, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("/api/v1/collections/users/copy", `{"name": "sandbox"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 copying onto an existing collection, got %d", rec.Code)
+	}
+
+	if rec := post("/api/v1/collections/sandbox/rename", `{"name": "experiment"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 renaming, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("/api/v1/collections/missing/rename", `{"name": "other"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 renaming a missing collection, got %d", rec.Code)
+	}
+
+	experiment, err := srv.db.GetCollection("experiment")
+	if err != nil {
+		t.Fatalf("Expected renamed copy, got %v", err)
+	}
+	if _, err := experiment.Get("user1"); err != nil {
+		t.Errorf("Expected copied document, got %v", err)
+	}
+	if _, err := srv.db.GetCollection("sandbox"); err == nil {
+		t.Error("Expected the old name to be gone")
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// tlsEnabled reports whether a certificate and key are configured
+func (s *Server) tlsEnabled() bool {
+	return s.opts.TLSCertFile != "" && s.opts.TLSKeyFile != ""
+}
+
+// ValidateTLSFiles checks a TLS certificate and key before the server starts.
+// Both paths must be set, or neither for plain HTTP, and they must name
+// readable files that form a valid key pair.
+func ValidateTLSFiles(certFile, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	if certFile == "" || keyFile == "" {
+		return errors.New("a TLS certificate and key must be configured together")
+	}
+
+	for _, path := range []string{certFile, keyFile} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("TLS file '%s' is not readable: %w", path, err)
+		}
+	}
+
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return fmt.Errorf("TLS certificate '%s' and key '%s' are not a valid key pair: %w", certFile, keyFile, err)
+	}
+	return nil
+}
+
+// ReloadCertificate re-reads the TLS certificate and key from disk. New
+// connections use the reloaded certificate; existing ones are unaffected.
+// The previous certificate stays in use if loading fails.
+func (s *Server) ReloadCertificate() error {
+	cert, err := tls.LoadX509KeyPair(s.opts.TLSCertFile, s.opts.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	s.cert.Store(&cert)
+	return nil
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+// serveTLS serves HTTPS. With a separate TLSAddr, listener keeps serving
+// plain HTTP, optionally redirecting to HTTPS, and both stop together.
+func (s *Server) serveTLS(listener net.Listener, handler http.Handler) error {
+	if err := s.ReloadCertificate(); err != nil {
+		listener.Close()
+		return err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.getCertificate,
+	}
+
+	if s.opts.TLSAddr == "" {
+		server := s.newHTTPServer(listener.Addr().String(), handler)
+		server.TLSConfig = tlsConfig
+		s.setServers(server, nil)
+		return server.ServeTLS(listener, "", "")
+	}
+
+	tlsListener, err := net.Listen("tcp", s.opts.TLSAddr)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	tlsServer := s.newHTTPServer(s.opts.TLSAddr, handler)
+	tlsServer.TLSConfig = tlsConfig
+
+	plain := handler
+	if s.opts.RedirectHTTP {
+		plain = s.redirectToHTTPS(handler)
+	}
+	server := s.setServers(s.newHTTPServer(listener.Addr().String(), plain), tlsServer)
+
+	errs := make(chan error, 2)
+	go func() { errs <- tlsServer.ServeTLS(tlsListener, "", "") }()
+	go func() { errs <- server.Serve(listener) }()
+
+	// If either listener fails, take the other down with it
+	err = <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		server.Close()
+		tlsServer.Close()
+	}
+	<-errs
+
+	return err
+}
+
+// redirectToHTTPS sends plain HTTP requests to the HTTPS listener, except
+// for the health check so load balancers can keep probing over HTTP
+func (s *Server) redirectToHTTPS(next http.Handler) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(s.opts.TLSAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
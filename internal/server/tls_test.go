@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rafdb/pkg/storage"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its
+// key to dir, returning their paths
+func writeSelfSignedCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "rafdb test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+// freeAddr returns a loopback address with a port that is currently unused
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitForServer retries get until it succeeds or a deadline passes
+func waitForServer(t *testing.T, get func() (*http.Response, error)) *http.Response {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := get()
+		if err == nil {
+			return resp
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not become ready: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestValidateTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir)
+	otherCert, _ := writeSelfSignedCert(t, t.TempDir())
+
+	if err := ValidateTLSFiles("", ""); err != nil {
+		t.Errorf("Expected plain HTTP to be valid, got %v", err)
+	}
+	if err := ValidateTLSFiles(certFile, keyFile); err != nil {
+		t.Errorf("Expected valid key pair, got %v", err)
+	}
+
+	for name, files := range map[string][2]string{
+		"missing key":      {certFile, ""},
+		"missing cert":     {"", keyFile},
+		"nonexistent file": {certFile, filepath.Join(dir, "missing.pem")},
+		"mismatched pair":  {otherCert, keyFile},
+	} {
+		if err := ValidateTLSFiles(files[0], files[1]); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir())
+	httpAddr, httpsAddr := freeAddr(t), freeAddr(t)
+
+	srv := NewServerWithOptions(storage.NewDatabase(), Options{
+		TLSCertFile:  certFile,
+		TLSKeyFile:   keyFile,
+		TLSAddr:      httpsAddr,
+		RedirectHTTP: true,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Start(httpAddr) }()
+
+	pool := x509.NewCertPool()
+	certPEM, _ := os.ReadFile(certFile)
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp := waitForServer(t, func() (*http.Response, error) {
+		return client.Get("https://" + httpsAddr + "/api/v1/collections")
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatalf("Expected successful HTTPS response, got %d", resp.StatusCode)
+	}
+
+	// Plain HTTP keeps serving health checks and redirects everything else
+	resp = waitForServer(t, func() (*http.Response, error) {
+		return client.Get("http://" + httpAddr + "/api/v1/health")
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected health check over HTTP, got %d", resp.StatusCode)
+	}
+
+	resp, err := client.Get("http://" + httpAddr + "/api/v1/collections")
+	if err != nil {
+		t.Fatalf("Expected redirect response, got %v", err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	if location := resp.Header.Get("Location"); location != "https://127.0.0.1:"+port+"/api/v1/collections" {
+		t.Fatalf("Expected redirect to HTTPS, got %d %q", resp.StatusCode, location)
+	}
+
+	srv.Shutdown(context.Background())
+	select {
+	case err := <-done:
+		if err != http.ErrServerClosed {
+			t.Fatalf("Expected ErrServerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the server to stop")
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"rafdb/pkg/storage"
+)
+
+// WebSocket change feed settings
+const (
+	// Time allowed to write a message to the client
+	wsWriteWait = 10 * time.Second
+	// Time allowed between pongs before the connection is considered dead
+	wsPongWait = 60 * time.Second
+	// Interval between pings; must be shorter than wsPongWait
+	wsPingInterval = wsPongWait * 9 / 10
+	// Largest control message accepted from the client
+	wsMaxMessageSize = 4096
+)
+
+// WebSocket control message actions
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// The API already allows requests from any origin, so WebSocket handshakes
+// do too
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsControl is a message from a WebSocket client
+type wsControl struct {
+	Action     string `json:"action"`
+	Collection string `json:"collection"`
+}
+
+// wsReply acknowledges a control message or reports its failure
+type wsReply struct {
+	Type       string `json:"type"`
+	Collection string `json:"collection,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// handleWebSocket serves a change feed over a WebSocket. Clients send
+// {"action": "subscribe"|"unsubscribe", "collection": "..."} messages and
+// receive change events for every subscribed collection. As with the SSE
+// feed, events for a client that falls behind are dropped rather than
+// slowing down writers.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already sent an error response
+		return
+	}
+	defer conn.Close()
+
+	out := make(chan interface{}, watchBuffer)
+	done := make(chan struct{})
+	defer close(done)
+
+	go wsWriteLoop(conn, out, done)
+
+	subscriptions := make(map[string]func())
+	var forwarders sync.WaitGroup
+	defer func() {
+		for _, unsubscribe := range subscriptions {
+			unsubscribe()
+		}
+		forwarders.Wait()
+	}()
+
+	reply := func(msg wsReply) {
+		select {
+		case out <- msg:
+		case <-done:
+		}
+	}
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		// Any read error means the connection is closed or dead
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsControl
+		if err := json.Unmarshal(data, &msg); err != nil {
+			reply(wsReply{Type: "error", Error: "Invalid JSON"})
+			continue
+		}
+
+		switch msg.Action {
+		case wsSubscribe:
+			if _, exists := subscriptions[msg.Collection]; exists {
+				reply(wsReply{Type: "subscribed", Collection: msg.Collection})
+				continue
+			}
+			if _, err := s.db.GetCollection(msg.Collection); err != nil {
+				reply(wsReply{Type: "error", Collection: msg.Collection, Error: err.Error()})
+				continue
+			}
+
+			events, unsubscribe, err := s.db.Subscribe(msg.Collection, watchBuffer)
+			if err != nil {
+				reply(wsReply{Type: "error", Collection: msg.Collection, Error: err.Error()})
+				continue
+			}
+			subscriptions[msg.Collection] = unsubscribe
+
+			forwarders.Add(1)
+			go func(events <-chan storage.ChangeEvent) {
+				defer forwarders.Done()
+				for event := range events {
+					select {
+					case out <- event:
+					default:
+					}
+				}
+			}(events)
+
+			reply(wsReply{Type: "subscribed", Collection: msg.Collection})
+		case wsUnsubscribe:
+			if unsubscribe, exists := subscriptions[msg.Collection]; exists {
+				unsubscribe()
+				delete(subscriptions, msg.Collection)
+			}
+			reply(wsReply{Type: "unsubscribed", Collection: msg.Collection})
+		default:
+			reply(wsReply{Type: "error", Error: "Unknown action '" + msg.Action + "'"})
+		}
+	}
+}
+
+// wsWriteLoop is the connection's only writer. It sends queued messages and
+// periodic pings until done is closed or a write fails, in which case it
+// closes the connection so the read loop stops too.
+func wsWriteLoop(conn *websocket.Conn, out <-chan interface{}, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-out:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				conn.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
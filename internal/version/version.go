@@ -0,0 +1,40 @@
+// Package version reports which build of RAFDB is running. The variables
+// are set at build time with -ldflags, for example:
+//
+//	go build -ldflags "-X rafdb/internal/version.Version=v1.2.0 -X rafdb/internal/version.Commit=$(git rev-parse --short HEAD)"
+package version
+
+import "runtime"
+
+// Build details, "dev" unless set with -ldflags
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildTime = "dev"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's details
+func Get() Info {
+	return Info{
+		Version:   orDev(Version),
+		Commit:    orDev(Commit),
+		BuildTime: orDev(BuildTime),
+		GoVersion: runtime.Version(),
+	}
+}
+
+// orDev substitutes "dev" for a value set to empty at build time
+func orDev(value string) string {
+	if value == "" {
+		return "dev"
+	}
+	return value
+}
@@ -1,44 +1,284 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"rafdb/internal/server"
-	"rafdb/internal/storage"
+	"rafdb/internal/version"
+	"rafdb/pkg/storage"
 )
 
 func main() {
+	dataFile := flag.String("data", envOrDefault("RAFDB_DATA_FILE", storage.DefaultDataFile), "path to the data file (env RAFDB_DATA_FILE)")
+	compactionRatio := flag.Float64("compaction-ratio", floatEnvOrDefault("RAFDB_COMPACTION_RATIO", storage.DefaultCompactionRatio), "share of the data file that must be wasted before it is compacted, 0 to disable (env RAFDB_COMPACTION_RATIO)")
+	addr := flag.String("addr", envOrDefault("RAFDB_ADDR", ":8080"), "address to listen on (env RAFDB_ADDR)")
+	allowRestore := flag.Bool("allow-restore", os.Getenv("RAFDB_ALLOW_RESTORE") == "true", "enable the POST /restore endpoint without API key authentication (env RAFDB_ALLOW_RESTORE)")
+	allowReset := flag.Bool("allow-reset", os.Getenv("RAFDB_ALLOW_RESET") == "true", "enable the POST /admin/reset endpoint (env RAFDB_ALLOW_RESET)")
+	apiKeysFile := flag.String("api-keys", os.Getenv("RAFDB_API_KEYS_FILE"), "JSON file mapping API keys to principals; enables authentication (env RAFDB_API_KEYS_FILE)")
+	autoSave := flag.Duration("autosave", durationEnvOrDefault("RAFDB_AUTOSAVE_INTERVAL", 30*time.Second), "interval between automatic saves, 0 to disable (env RAFDB_AUTOSAVE_INTERVAL)")
+	sweepInterval := flag.Duration("sweep-interval", durationEnvOrDefault("RAFDB_SWEEP_INTERVAL", time.Minute), "interval between sweeps for expired documents, 0 to disable (env RAFDB_SWEEP_INTERVAL)")
+	maxQueryResults := flag.Int("max-query-results", intEnvOrDefault("RAFDB_MAX_QUERY_RESULTS", 0), "paginate query responses larger than this many documents, 0 to disable (env RAFDB_MAX_QUERY_RESULTS)")
+	tlsCert := flag.String("tls-cert", os.Getenv("RAFDB_TLS_CERT"), "TLS certificate file; serves HTTPS together with -tls-key (env RAFDB_TLS_CERT)")
+	tlsKey := flag.String("tls-key", os.Getenv("RAFDB_TLS_KEY"), "TLS private key file (env RAFDB_TLS_KEY)")
+	httpsAddr := flag.String("https-addr", os.Getenv("RAFDB_HTTPS_ADDR"), "serve HTTPS on this address and keep plain HTTP on -addr (env RAFDB_HTTPS_ADDR)")
+	httpRedirect := flag.Bool("http-redirect", os.Getenv("RAFDB_HTTP_REDIRECT") == "true", "redirect plain HTTP to HTTPS, except health checks, when -https-addr is set (env RAFDB_HTTP_REDIRECT)")
+	requestTimeout := flag.Duration("request-timeout", durationEnvOrDefault("RAFDB_REQUEST_TIMEOUT", 10*time.Second), "maximum time a request may run before it is cancelled with 504, 0 to disable (env RAFDB_REQUEST_TIMEOUT)")
+	readTimeout := flag.Duration("read-timeout", durationEnvOrDefault("RAFDB_READ_TIMEOUT", server.DefaultReadTimeout), "maximum time to read a request, bulk requests excepted; negative to disable (env RAFDB_READ_TIMEOUT)")
+	writeTimeout := flag.Duration("write-timeout", durationEnvOrDefault("RAFDB_WRITE_TIMEOUT", server.DefaultWriteTimeout), "maximum time to write a response, bulk requests and streams excepted; negative to disable (env RAFDB_WRITE_TIMEOUT)")
+	idleTimeout := flag.Duration("idle-timeout", durationEnvOrDefault("RAFDB_IDLE_TIMEOUT", server.DefaultIdleTimeout), "maximum time a keep-alive connection waits for its next request; negative to disable (env RAFDB_IDLE_TIMEOUT)")
+	maxSaveFailures := flag.Int("max-save-failures", intEnvOrDefault("RAFDB_MAX_SAVE_FAILURES", server.DefaultMaxSaveFailures), "consecutive failed saves before the health check reports unhealthy, negative to disable (env RAFDB_MAX_SAVE_FAILURES)")
+	maxSubscribers := flag.Int("max-subscribers", intEnvOrDefault("RAFDB_MAX_SUBSCRIBERS", 1000), "maximum concurrent change subscribers (pollers), 0 for unlimited (env RAFDB_MAX_SUBSCRIBERS)")
+	maxCollectionSubscribers := flag.Int("max-subscribers-per-collection", intEnvOrDefault("RAFDB_MAX_SUBSCRIBERS_PER_COLLECTION", 0), "maximum concurrent change subscribers per collection, 0 for unlimited (env RAFDB_MAX_SUBSCRIBERS_PER_COLLECTION)")
+	apiKeyRolesFile := flag.String("api-key-roles", os.Getenv("RAFDB_API_KEY_ROLES_FILE"), "JSON file mapping API keys to a role, read or readwrite (env RAFDB_API_KEY_ROLES_FILE)")
+	logFormat := flag.String("log-requests", envOrDefault("RAFDB_LOG_REQUESTS", "text"), "request log format: text, json or off (env RAFDB_LOG_REQUESTS)")
+	rateLimit := flag.Float64("rate-limit", floatEnvOrDefault("RAFDB_RATE_LIMIT", 0), "requests per second allowed per authenticated principal or client IP, 0 to disable (env RAFDB_RATE_LIMIT)")
+	rateBurst := flag.Int("rate-burst", intEnvOrDefault("RAFDB_RATE_BURST", 0), "requests a client may burst above -rate-limit, defaults to the rate (env RAFDB_RATE_BURST)")
+	globalIDs := flag.Bool("global-unique-ids", os.Getenv("RAFDB_GLOBAL_UNIQUE_IDS") == "true", "require document IDs to be unique across all collections (env RAFDB_GLOBAL_UNIQUE_IDS)")
+	recordOps := flag.String("record-ops", os.Getenv("RAFDB_RECORD_OPS"), "append every mutating operation to this file for replay with rafdb-replay (env RAFDB_RECORD_OPS)")
+	gzipMinSize := flag.Int("gzip-min-size", intEnvOrDefault("RAFDB_GZIP_MIN_SIZE", 1024), "gzip responses of at least this many bytes for clients that accept it, 0 to disable (env RAFDB_GZIP_MIN_SIZE)")
+	maxBodyBytes := flag.Int("max-body-bytes", intEnvOrDefault("RAFDB_MAX_BODY_BYTES", 10<<20), "reject request bodies larger than this many bytes with 413, 0 to disable (env RAFDB_MAX_BODY_BYTES)")
+	maxBulkBodyBytes := flag.Int("max-bulk-body-bytes", intEnvOrDefault("RAFDB_MAX_BULK_BODY_BYTES", 100<<20), "body size limit for bulk, batch, import, restore and transaction requests, 0 to disable (env RAFDB_MAX_BULK_BODY_BYTES)")
+	compress := flag.Bool("compress", os.Getenv("RAFDB_COMPRESS") == "true", "gzip the data file; compressed and plain files are both readable (env RAFDB_COMPRESS)")
+	saveDebounce := flag.Duration("save-debounce", durationEnvOrDefault("RAFDB_SAVE_DEBOUNCE", 0), "wait this long before each save so concurrent saves share one write, 0 to disable (env RAFDB_SAVE_DEBOUNCE)")
+	pprofAddr := flag.String("pprof", os.Getenv("RAFDB_PPROF"), "serve pprof profiles on this separate address, such as localhost:6060; disabled when empty (env RAFDB_PPROF)")
+	showVersion := flag.Bool("version", false, "print the build version and exit")
+	flag.Parse()
+
+	build := version.Get()
+	if *showVersion {
+		fmt.Printf("rafdb %s (commit %s, built %s, %s)\n", build.Version, build.Commit, build.BuildTime, build.GoVersion)
+		return
+	}
+
+	if *logFormat == "off" {
+		*logFormat = ""
+	} else if *logFormat != server.LogFormatText && *logFormat != server.LogFormatJSON {
+		log.Fatalf("Invalid -log-requests %q: must be text, json or off", *logFormat)
+	}
+
+	if err := server.ValidateTLSFiles(*tlsCert, *tlsKey); err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+
 	// Initialize the database
-	db := storage.NewDatabase()
+	db := storage.NewDatabaseWithOptions(storage.Options{DataFile: *dataFile, Compress: *compress, SaveDebounce: *saveDebounce})
+	log.Printf("Using data file %s", db.DataFile())
+	db.SetSubscriberLimits(*maxCollectionSubscribers, *maxSubscribers)
 
 	// Load existing data from disk if available
 	if err := db.LoadFromDisk(); err != nil {
 		log.Printf("Warning: Could not load existing data: %v", err)
 	}
 
+	if *globalIDs {
+		if err := db.SetGlobalIDUniqueness(true); err != nil {
+			log.Fatalf("Could not enable global ID uniqueness: %v", err)
+		}
+	}
+
+	// Record operations after loading so the log starts from the snapshot
+	if *recordOps != "" {
+		opsFile, err := os.OpenFile(*recordOps, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("Could not open operations log: %v", err)
+		}
+		defer opsFile.Close()
+		db.RecordOperations(opsFile)
+		log.Printf("Recording operations to %s", *recordOps)
+	}
+
+	// Rewrite the data file in the background once deletes leave much of it
+	// wasted
+	stopCompaction := func() {}
+	if *compactionRatio > 0 {
+		stopCompaction = db.StartCompaction(time.Minute, *compactionRatio)
+	}
+
+	// Periodically persist changes so a crash loses at most one interval
+	stopAutoSave := func() {}
+	if *autoSave > 0 {
+		stopAutoSave = db.StartAutoSave(*autoSave)
+	}
+
+	// Periodically delete documents whose TTL has passed
+	stopSweeper := func() {}
+	if *sweepInterval > 0 {
+		stopSweeper = db.StartExpirySweeper(*sweepInterval)
+	}
+
+	var apiKeys map[string]string
+	if *apiKeysFile != "" {
+		keys, err := server.LoadAPIKeys(*apiKeysFile)
+		if err != nil {
+			log.Fatalf("Could not load API keys: %v", err)
+		}
+		apiKeys = keys
+		log.Printf("API key authentication enabled with %d keys", len(apiKeys))
+	}
+
+	var apiKeyRoles map[string]string
+	if *apiKeyRolesFile != "" {
+		roles, err := server.LoadAPIKeyRoles(*apiKeyRolesFile)
+		if err != nil {
+			log.Fatalf("Could not load API key roles: %v", err)
+		}
+		apiKeyRoles = roles
+	}
+
 	// Start the HTTP server
-	srv := server.NewServer(db)
+	srv := server.NewServerWithOptions(db, server.Options{
+		AllowReset:       *allowReset,
+		AllowRestore:     *allowRestore,
+		APIKeys:          apiKeys,
+		APIKeyRoles:      apiKeyRoles,
+		MaxQueryResults:  *maxQueryResults,
+		TLSCertFile:      *tlsCert,
+		TLSKeyFile:       *tlsKey,
+		TLSAddr:          *httpsAddr,
+		RedirectHTTP:     *httpRedirect,
+		RequestTimeout:   *requestTimeout,
+		RequestLogFormat: *logFormat,
+		RateLimit:        *rateLimit,
+		RateBurst:        *rateBurst,
+		GzipMinSize:      *gzipMinSize,
+		MaxBodyBytes:     *maxBodyBytes,
+		MaxBulkBodyBytes: *maxBulkBodyBytes,
+		ReadTimeout:      *readTimeout,
+		WriteTimeout:     *writeTimeout,
+		IdleTimeout:      *idleTimeout,
+		MaxSaveFailures:  *maxSaveFailures,
+	})
+	read, write, idle := srv.Timeouts()
+	log.Printf("HTTP timeouts: read %s, write %s, idle %s", read, write, idle)
+
+	// Reload the TLS certificate on SIGHUP so it can be rotated in place
+	if *tlsCert != "" && *tlsKey != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := srv.ReloadCertificate(); err != nil {
+					log.Printf("Could not reload TLS certificate: %v", err)
+					continue
+				}
+				log.Println("Reloaded TLS certificate")
+			}
+		}()
+	}
 
-	// Handle graceful shutdown
+	// Profiling gets its own listener so it is never exposed on the API
+	// address and needs no API key
+	if *pprofAddr != "" {
+		go func() {
+			log.Printf("Serving pprof profiles on %s/debug/pprof/", *pprofAddr)
+			if err := http.ListenAndServe(*pprofAddr, server.PprofHandler()); err != nil {
+				log.Printf("pprof server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Serve until the listener fails or a shutdown signal arrives
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	serveErr := make(chan error, 1)
 	go func() {
-		<-c
-		log.Println("Shutting down gracefully...")
+		log.Printf("Starting RAFDB %s (commit %s) on %s", build.Version, build.Commit, *addr)
+		serveErr <- srv.Start(*addr)
+	}()
 
-		// Save data to disk before shutdown
-		if err := db.SaveToDisk(); err != nil {
-			log.Printf("Error saving data to disk: %v", err)
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
 		}
+		return
+	case <-c:
+	}
 
-		srv.Shutdown()
-		os.Exit(0)
-	}()
+	log.Println("Shutting down gracefully...")
+
+	// Let in-flight requests finish so their writes make it into the final save
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	<-serveErr
+
+	stopCompaction()
+	stopSweeper()
+	stopAutoSave()
+
+	// Save data to disk before exiting
+	if err := db.SaveToDisk(); err != nil {
+		log.Printf("Error saving data to disk: %v", err)
+	}
+}
+
+// envOrDefault returns the value of an environment variable, or fallback when
+// it is unset or empty
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
 
-	log.Println("Starting RAFDB server on :8080")
-	srv.Start(":8080")
+// durationEnvOrDefault parses a duration from an environment variable, or
+// returns fallback when it is unset or invalid
+func durationEnvOrDefault(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// intEnvOrDefault parses an integer from an environment variable, or returns
+// fallback when it is unset or invalid
+func intEnvOrDefault(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// floatEnvOrDefault parses a number from an environment variable, or returns
+// fallback when it is unset or invalid
+func floatEnvOrDefault(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %g", key, value, fallback)
+		return fallback
+	}
+	return n
 }
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Aggregate operators supported by Aggregate and GroupBy. AggCount is only
+// meaningful for GroupBy.
+const (
+	AggCount = "count"
+	AggSum   = "sum"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+)
+
+// aggregator accumulates numeric values for a single aggregate operator
+type aggregator struct {
+	op    string
+	count int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func newAggregator(op string) (*aggregator, error) {
+	switch op {
+	case AggSum, AggAvg, AggMin, AggMax:
+		return &aggregator{op: op}, nil
+	}
+	return nil, fmt.Errorf("unknown aggregate operator '%s'", op)
+}
+
+func (a *aggregator) add(v float64) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+}
+
+func (a *aggregator) result() float64 {
+	if a.count == 0 {
+		return 0
+	}
+
+	switch a.op {
+	case AggAvg:
+		return a.sum / float64(a.count)
+	case AggMin:
+		return a.min
+	case AggMax:
+		return a.max
+	}
+	return a.sum
+}
+
+// Aggregate computes sum, avg, min or max over a numeric field. Documents
+// where the field is missing or not a number are skipped. An error is
+// returned when no numeric values are found, so callers can tell an empty
+// result from a zero.
+func (c *Collection) Aggregate(field string, op string) (float64, error) {
+	return c.AggregateWhere(field, op)
+}
+
+// AggregateWhere is Aggregate over only the documents matching all of the
+// filters
+func (c *Collection) AggregateWhere(field string, op string, filters ...Filter) (float64, error) {
+	agg, err := newAggregator(op)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range filters {
+		if err := f.validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, f := range filters {
+		if err := c.checkFieldKnownLocked(f.Field); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+	for _, doc := range c.Documents {
+		if doc.expired(now) || !matchesAll(doc, filters) {
+			continue
+		}
+
+		value, exists := lookupPath(doc.Data, field)
+		if !exists {
+			continue
+		}
+		if n, ok := toFloat64(value); ok {
+			agg.add(n)
+		}
+	}
+
+	if agg.count == 0 {
+		return 0, fmt.Errorf("no numeric values for field '%s' in collection '%s'", field, c.Name)
+	}
+
+	return agg.result(), nil
+}
+
+// matchesAll reports whether a document satisfies every filter
+func matchesAll(doc *Document, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.matches(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupBy buckets documents by the string form of groupField and computes op
+// over aggField within each bucket. op is "count", which counts documents, or
+// one of the numeric aggregates, which skip missing and non-numeric values and
+// yield 0 for a bucket without any. Documents without groupField fall into the
+// "" bucket.
+func (c *Collection) GroupBy(groupField string, aggField string, op string) (map[string]float64, error) {
+	if op != AggCount {
+		if _, err := newAggregator(op); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	buckets := make(map[string]*aggregator)
+	for _, doc := range c.Documents {
+		if doc.expired(now) {
+			continue
+		}
+
+		key := ""
+		if value, exists := lookupPath(doc.Data, groupField); exists {
+			key = groupKey(value)
+		}
+
+		bucket, exists := buckets[key]
+		if !exists {
+			bucket = &aggregator{op: op}
+			buckets[key] = bucket
+		}
+
+		if op == AggCount {
+			bucket.count++
+			continue
+		}
+
+		if value, exists := lookupPath(doc.Data, aggField); exists {
+			if n, ok := toFloat64(value); ok {
+				bucket.add(n)
+			}
+		}
+	}
+
+	results := make(map[string]float64, len(buckets))
+	for key, bucket := range buckets {
+		if op == AggCount {
+			results[key] = float64(bucket.count)
+			continue
+		}
+		results[key] = bucket.result()
+	}
+
+	return results, nil
+}
+
+// groupKey returns the string form of a group value. Numbers are normalized
+// so that 30 and 30.0 share a bucket.
+func groupKey(v interface{}) string {
+	if n, ok := toFloat64(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// Histogram counts the numeric values of field in buckets of bucketWidth,
+// keyed by the start of each bucket. Missing and non-numeric values are
+// skipped. A non-positive bucketWidth yields an empty histogram.
+func (c *Collection) Histogram(field string, bucketWidth float64) map[float64]int {
+	buckets := make(map[float64]int)
+	if bucketWidth <= 0 {
+		return buckets
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	for _, doc := range c.Documents {
+		if doc.expired(now) {
+			continue
+		}
+
+		value, exists := lookupPath(doc.Data, field)
+		if !exists {
+			continue
+		}
+		if n, ok := toFloat64(value); ok {
+			buckets[math.Floor(n/bucketWidth)*bucketWidth]++
+		}
+	}
+
+	return buckets
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCollection_Aggregate(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"age": 30})
+	collection.Insert("user2", map[string]interface{}{"age": float64(20)})
+	collection.Insert("user3", map[string]interface{}{"age": 40})
+	collection.Insert("user4", map[string]interface{}{"age": "unknown"})
+	collection.Insert("user5", map[string]interface{}{"name": "No age"})
+
+	tests := map[string]float64{
+		AggSum: 90,
+		AggAvg: 30,
+		AggMin: 20,
+		AggMax: 40,
+	}
+
+	for op, expected := range tests {
+		result, err := collection.Aggregate("age", op)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", op, err)
+		}
+		if result != expected {
+			t.Fatalf("Expected %s to be %v, got %v", op, expected, result)
+		}
+	}
+
+	if _, err := collection.Aggregate("age", "median"); err == nil {
+		t.Fatal("Expected error for unknown operator")
+	}
+
+	if _, err := collection.Aggregate("name", AggSum); err == nil {
+		t.Fatal("Expected error when no numeric values are found")
+	}
+}
+
+func TestCollection_AggregateWhere(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"city": "NYC", "age": 20})
+	collection.Insert("user3", map[string]interface{}{"city": "Boston", "age": 70})
+	collection.Insert("user4", map[string]interface{}{"city": "NYC", "age": "unknown"})
+
+	avg, err := collection.AggregateWhere("age", AggAvg)
+	if err != nil || avg != 40 {
+		t.Fatalf("Expected average 40 over every document, got %v, %v", avg, err)
+	}
+
+	avg, err = collection.AggregateWhere("age", AggAvg, Filter{Field: "city", Value: "NYC"})
+	if err != nil || avg != 25 {
+		t.Fatalf("Expected average 25 over NYC documents, got %v, %v", avg, err)
+	}
+
+	max, err := collection.AggregateWhere("age", AggMax, Filter{Field: "city", Op: OpLike, Value: "n"}, Filter{Field: "age", Value: 70})
+	if err != nil || max != 70 {
+		t.Fatalf("Expected max 70 over documents matching both filters, got %v, %v", max, err)
+	}
+
+	if _, err := collection.AggregateWhere("age", AggSum, Filter{Field: "city", Value: "Chicago"}); err == nil {
+		t.Fatal("Expected error when no documents match")
+	}
+	if _, err := collection.AggregateWhere("age", AggSum, Filter{Field: "city", Op: "between"}); err == nil {
+		t.Fatal("Expected error for an invalid filter")
+	}
+	if _, err := collection.AggregateWhere("age", "median"); err == nil {
+		t.Fatal("Expected error for an unknown operator")
+	}
+}
+
+func TestCollection_GroupBy(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"city": "NYC", "age": float64(20)})
+	collection.Insert("user3", map[string]interface{}{"city": "Boston", "age": 40})
+	collection.Insert("user4", map[string]interface{}{"age": 50})
+
+	counts, err := collection.GroupBy("city", "", AggCount)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if counts["NYC"] != 2 || counts["Boston"] != 1 || counts[""] != 1 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+
+	averages, err := collection.GroupBy("city", "age", AggAvg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if averages["NYC"] != 25 || averages["Boston"] != 40 || averages[""] != 50 {
+		t.Fatalf("Unexpected averages: %v", averages)
+	}
+
+	if _, err := collection.GroupBy("city", "age", "median"); err == nil {
+		t.Fatal("Expected error for unknown operator")
+	}
+}
+
+func TestCollection_Histogram(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	for i, age := range []interface{}{3, 7, 10, 15, 19, float64(25), -1, "unknown"} {
+		collection.Insert(strconv.Itoa(i), map[string]interface{}{"age": age})
+	}
+
+	histogram := collection.Histogram("age", 10)
+	expected := map[float64]int{-10: 1, 0: 2, 10: 3, 20: 1}
+
+	if len(histogram) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, histogram)
+	}
+	for start, count := range expected {
+		if histogram[start] != count {
+			t.Fatalf("Expected %d in bucket %v, got %d", count, start, histogram[start])
+		}
+	}
+
+	if empty := collection.Histogram("age", 0); len(empty) != 0 {
+		t.Fatalf("Expected empty histogram for zero width, got %v", empty)
+	}
+}
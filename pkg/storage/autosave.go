@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// markDirty records that the database has changes not yet saved to disk
+func (db *Database) markDirty() {
+	db.dirty.Store(true)
+}
+
+// isDirty reports whether the database has unsaved changes
+func (db *Database) isDirty() bool {
+	return db.dirty.Load()
+}
+
+// markDirty records that the collection has unsaved changes: in its shard
+// file when it has its own save interval, or else in the data file. Callers
+// must hold c.mu.
+func (c *Collection) markDirty() {
+	if c.SaveInterval > 0 {
+		c.dirty.Store(true)
+		return
+	}
+	if c.db != nil {
+		c.db.markDirty()
+	}
+}
+
+// StartAutoSave saves the database to disk every interval in a background
+// goroutine, skipping intervals in which nothing changed. Collections with
+// their own save interval are saved only once it has passed; see
+// Collection.SetSaveInterval. A failed save leaves its changes dirty, so it
+// is retried on the next interval. The returned function stops auto-saving
+// and waits for any in-progress save to finish.
+func (db *Database) StartAutoSave(interval time.Duration) (stop func()) {
+	failures := 0
+	return runPeriodically(interval, &db.autoSavers, func() {
+		if err := db.saveDue(); err != nil {
+			failures++
+			// Log the first failure and then each time the run of failures
+			// doubles, so that a full disk does not flood the log
+			if failures&(failures-1) == 0 {
+				log.Printf("Auto-save failed (%d consecutive failures): %v", failures, err)
+			}
+			return
+		}
+		if failures > 0 {
+			log.Printf("Auto-save succeeded after %d failures", failures)
+			failures = 0
+		}
+	})
+}
+
+// BackgroundJobs reports whether the auto-save and expiry sweeper goroutines
+// are running
+func (db *Database) BackgroundJobs() map[string]bool {
+	return map[string]bool{
+		"autosave":       db.autoSavers.Load() > 0,
+		"expiry_sweeper": db.sweepers.Load() > 0,
+	}
+}
+
+// runPeriodically calls fn every interval in a background goroutine, counting
+// it in running while it is alive. The returned function stops the goroutine
+// and waits for any in-progress call to finish.
+func runPeriodically(interval time.Duration, running *atomic.Int32, fn func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	running.Add(1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer running.Add(-1)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
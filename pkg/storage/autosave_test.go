@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDatabase_DirtyTracking(t *testing.T) {
+	tempFile := "test_dirty.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	if db.isDirty() {
+		t.Fatal("Expected new database to be clean")
+	}
+
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	db.SaveToDisk()
+
+	if db.isDirty() {
+		t.Fatal("Expected database to be clean after save")
+	}
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	if !db.isDirty() {
+		t.Fatal("Expected insert to mark the database dirty")
+	}
+
+	db.SaveToDisk()
+	collection.Update("user1", map[string]interface{}{"name": "Jane"})
+	if !db.isDirty() {
+		t.Fatal("Expected update to mark the database dirty")
+	}
+
+	db.SaveToDisk()
+	collection.Delete("user1")
+	if !db.isDirty() {
+		t.Fatal("Expected delete to mark the database dirty")
+	}
+}
+
+func TestDatabase_StartAutoSave(t *testing.T) {
+	tempFile := "test_autosave.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	stop := db.StartAutoSave(10 * time.Millisecond)
+
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for db.isDirty() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for auto-save")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !db.BackgroundJobs()["autosave"] {
+		t.Fatal("Expected auto-save to be reported as running")
+	}
+
+	stop()
+	stop() // stopping twice must be safe
+
+	if db.BackgroundJobs()["autosave"] {
+		t.Fatal("Expected auto-save to be reported as stopped")
+	}
+
+	db2 := NewDatabaseWithPath(tempFile)
+	if err := db2.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading auto-saved data, got %v", err)
+	}
+
+	if _, err := db2.GetCollection("users"); err != nil {
+		t.Fatalf("Expected auto-saved collection, got %v", err)
+	}
+
+	// Nothing changed, so the file must not be rewritten
+	info, _ := os.Stat(tempFile)
+	stop = db.StartAutoSave(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	after, _ := os.Stat(tempFile)
+	if !after.ModTime().Equal(info.ModTime()) {
+		t.Fatal("Expected clean database not to be re-saved")
+	}
+}
+
+func TestDatabase_SaveCoalescing(t *testing.T) {
+	db := NewDatabaseWithOptions(Options{DataFile: filepath.Join(t.TempDir(), "data.json"), SaveDebounce: 50 * time.Millisecond})
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	// Every successful write records a new save time, so the number of
+	// distinct times seen is the number of writes
+	saves := make(chan time.Time, 10)
+	for i := 0; i < cap(saves); i++ {
+		go func() {
+			if err := db.SaveToDisk(); err != nil {
+				t.Errorf("Expected no error saving, got %v", err)
+			}
+			saves <- db.LastSave()
+		}()
+	}
+
+	written := make(map[time.Time]bool)
+	for i := 0; i < cap(saves); i++ {
+		written[<-saves] = true
+	}
+	if len(written) != 1 {
+		t.Fatalf("Expected saves within the debounce window to be written once, got %d writes", len(written))
+	}
+
+	// A save requested after a change writes again
+	first := db.LastSave()
+	collection.Insert("user2", map[string]interface{}{"name": "Jane"})
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	if !db.LastSave().After(first) {
+		t.Fatal("Expected a save after a change to write")
+	}
+
+	loaded := NewDatabaseWithPath(db.DataFile())
+	loaded.LoadFromDisk()
+	users, _ := loaded.GetCollection("users")
+	if _, err := users.Get("user2"); err != nil {
+		t.Fatalf("Expected the second save to include user2, got %v", err)
+	}
+}
+
+// benchmarkSaveUnderWrites has every goroutine write a document and then ask
+// for a save, as a write-heavy workload with frequent saves does
+// fullDisk fails every write, as a disk without free space would
+type fullDisk struct{}
+
+func (fullDisk) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+func TestDatabase_SaveFailures(t *testing.T) {
+	db := NewDatabaseWithPath(filepath.Join(t.TempDir(), "data.json"))
+	var full atomic.Bool
+	full.Store(true)
+	db.writeFile = func(path string, write func(w io.Writer) error) error {
+		if full.Load() {
+			return write(fullDisk{})
+		}
+		return writeFileAtomic(path, write)
+	}
+
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	if err := db.SaveToDisk(); err == nil {
+		t.Fatal("Expected save to a full disk to fail")
+	}
+	if !db.isDirty() {
+		t.Fatal("Expected a failed save to leave the database dirty")
+	}
+
+	// Auto-save keeps retrying while the disk is full
+	stop := db.StartAutoSave(5 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for db.SaveStatus().ConsecutiveFailures < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for auto-save failures")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stats := db.StatsStruct()
+	if stats.SaveErrors < 3 || stats.ConsecutiveFailures < 3 || stats.LastSaveTime != nil {
+		t.Fatalf("Expected counted failures and no successful save, got %+v", stats.SaveStatus)
+	}
+	if stats.LastSaveError == "" || stats.LastErrorTime == nil {
+		t.Fatalf("Expected the last save error, got %+v", stats.SaveStatus)
+	}
+
+	// Once space frees up the next auto-save succeeds and the run ends
+	full.Store(false)
+	deadline = time.Now().Add(2 * time.Second)
+	for db.SaveStatus().ConsecutiveFailures > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for auto-save to recover")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+
+	status := db.SaveStatus()
+	if status.LastSaveTime == nil || status.LastSaveError != "" || status.SaveErrors < 3 {
+		t.Fatalf("Expected a successful save with the error count kept, got %+v", status)
+	}
+	if db.Stats()["save_errors"] != status.SaveErrors {
+		t.Fatalf("Expected save errors in the stats map, got %v", db.Stats())
+	}
+}
+
+func benchmarkSaveUnderWrites(b *testing.B, debounce time.Duration) {
+	db := NewDatabaseWithOptions(Options{DataFile: filepath.Join(b.TempDir(), "data.json"), SaveDebounce: debounce})
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+	for i := 0; i < 1000; i++ {
+		collection.Insert(strconv.Itoa(i), map[string]interface{}{"name": "Test User", "age": i})
+	}
+
+	var next atomic.Int64
+	var mu sync.Mutex
+	written := make(map[int64]bool)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := "w" + strconv.FormatInt(next.Add(1), 10)
+			collection.Insert(id, map[string]interface{}{"name": "Writer"})
+			if err := db.SaveToDisk(); err != nil {
+				b.Errorf("Save failed: %v", err)
+			}
+
+			mu.Lock()
+			written[db.lastSave.Load()] = true
+			mu.Unlock()
+		}
+	})
+	b.ReportMetric(float64(len(written))/float64(b.N), "writes/op")
+}
+
+func BenchmarkSaveUnderWrites(b *testing.B) {
+	benchmarkSaveUnderWrites(b, 0)
+}
+
+func BenchmarkSaveUnderWritesDebounced(b *testing.B) {
+	benchmarkSaveUnderWrites(b, 5*time.Millisecond)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup writes a consistent snapshot of the whole database to w, in the
+// same format as the data file. Writes are blocked only while the snapshot
+// is taken, not while it is written out.
+func (db *Database) Backup(w io.Writer) error {
+	data, err := db.marshalSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to marshal database: %w", err)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// Restore replaces every collection with those in a snapshot written by
+// Backup or SaveToDisk, plain or gzip-compressed. The snapshot is fully
+// parsed and validated before anything is replaced, so a bad snapshot
+// leaves the database untouched. The operations log records the whole
+// snapshot, so replaying it restores the same state.
+func (db *Database) Restore(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	data, err = decompress(data)
+	if err != nil {
+		return fmt.Errorf("failed to decompress snapshot: %w", err)
+	}
+
+	collections, shards, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		return fmt.Errorf("invalid snapshot: collections %s are stored in separate files; restore a backup instead", strings.Join(shards, ", "))
+	}
+	if err := validateSnapshot(collections); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	backfillCreatedAt(collections, time.Now())
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.GlobalIDUniqueness() {
+		names := make([]string, 0, len(collections))
+		for name := range collections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		restored := &Database{Collections: collections}
+		if _, err := restored.buildIDOwnersLocked(names); err != nil {
+			return fmt.Errorf("invalid snapshot: %w", err)
+		}
+	}
+
+	db.installCollectionsLocked(collections)
+	db.record(Operation{Op: OpRestore, Data: map[string]interface{}{"snapshot": json.RawMessage(data)}})
+	db.markDirty()
+	return nil
+}
+
+// validateSnapshot checks that decoded collections are complete and that
+// every document still matches its checksum
+func validateSnapshot(collections map[string]*Collection) error {
+	for name, collection := range collections {
+		if err := validateCollectionName(name); err != nil {
+			return err
+		}
+		if collection == nil {
+			return fmt.Errorf("collection '%s' is empty", name)
+		}
+		if collection.Name != name {
+			return fmt.Errorf("collection '%s' is named '%s'", name, collection.Name)
+		}
+		if collection.Documents == nil {
+			collection.Documents = make(map[string]*Document)
+		}
+
+		for id, doc := range collection.Documents {
+			if doc == nil {
+				return fmt.Errorf("document '%s' in collection '%s' is empty", id, name)
+			}
+			if doc.ID != id {
+				return fmt.Errorf("document '%s' in collection '%s' has ID '%s'", id, name, doc.ID)
+			}
+			if doc.Checksum != "" && checksumData(doc.Data) != doc.Checksum {
+				return fmt.Errorf("document '%s' in collection '%s' does not match its checksum", id, name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDatabase_BackupRestore(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	users.AddLabels("user1", "vip")
+
+	var backup bytes.Buffer
+	if err := db.Backup(&backup); err != nil {
+		t.Fatalf("Expected no error backing up, got %v", err)
+	}
+
+	// Changes after the backup are undone by restoring it
+	db.CreateCollection("orders")
+	users.Delete("user1")
+
+	if err := db.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Expected no error restoring, got %v", err)
+	}
+	if names := db.ListCollections(); len(names) != 1 || names[0] != "users" {
+		t.Fatalf("Expected only the users collection, got %v", names)
+	}
+
+	restored, _ := db.GetCollection("users")
+	if doc, err := restored.Get("user1"); err != nil || doc.Data["name"] != "John" {
+		t.Fatalf("Expected restored document, got %v (%v)", doc, err)
+	}
+	if docs := restored.FindByLabel("vip"); len(docs) != 1 {
+		t.Errorf("Expected restored label index, got %d documents", len(docs))
+	}
+	if !db.isDirty() {
+		t.Error("Expected restore to mark the database dirty")
+	}
+}
+
+func TestDatabase_RestoreRejectsInvalidSnapshot(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+
+	for name, snapshot := range map[string]string{
+		"malformed JSON":   `{"collections": {"users": `,
+		"mismatched name":  `{"collections": {"users": {"name": "other", "documents": {}}}}`,
+		"mismatched ID":    `{"collections": {"users": {"name": "users", "documents": {"a": {"id": "b", "data": {}}}}}}`,
+		"bad checksum":     `{"collections": {"users": {"name": "users", "documents": {"a": {"id": "a", "data": {"x": 1}, "checksum": "bogus"}}}}}`,
+		"empty collection": `{"collections": {"users": null}}`,
+		"empty document":   `{"collections": {"users": {"name": "users", "documents": {"a": null}}}}`,
+		"invalid name":     `{"collections": {"../users": {"name": "../users", "documents": {}}}}`,
+	} {
+		if err := db.Restore(strings.NewReader(snapshot)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// The database is untouched
+	if _, err := users.Get("user1"); err != nil {
+		t.Fatalf("Expected original data after failed restores, got %v", err)
+	}
+	current, _ := db.GetCollection("users")
+	if current != users {
+		t.Fatal("Expected the original collection to remain in place")
+	}
+}
+
+func TestDatabase_RestoreIsReplayed(t *testing.T) {
+	var ops bytes.Buffer
+	db := NewDatabase()
+	db.RecordOperations(&ops)
+
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+
+	var backup bytes.Buffer
+	if err := db.Backup(&backup); err != nil {
+		t.Fatalf("Expected no error backing up, got %v", err)
+	}
+	users.Insert("user2", map[string]interface{}{"name": "Jane"})
+	if err := db.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Expected no error restoring, got %v", err)
+	}
+
+	// Replaying the log ends in the restored state, not the one before it
+	replayed := NewDatabase()
+	if _, err := replayed.ReplayOperations(bytes.NewReader(ops.Bytes())); err != nil {
+		t.Fatalf("Expected no error replaying, got %v", err)
+	}
+	restored, err := replayed.GetCollection("users")
+	if err != nil {
+		t.Fatalf("Expected the restored collection, got %v", err)
+	}
+	if _, err := restored.Get("user1"); err != nil {
+		t.Errorf("Expected the restored document, got %v", err)
+	}
+	if _, err := restored.Get("user2"); err == nil {
+		t.Error("Expected the document written after the backup to be gone")
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBatchAborted is reported for the operations of an atomic batch that
+// were not applied because another operation in it failed
+var ErrBatchAborted = errors.New("not applied: another operation in the batch failed")
+
+// BatchOperation is one document write in a collection batch. Op is one of
+// ChangeInsert, ChangeUpdate or ChangeDelete.
+type BatchOperation struct {
+	Op   string                 `json:"op"`
+	ID   string                 `json:"id"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Batch applies operations to the collection under a single lock
+// acquisition and returns each operation's error, nil for those that
+// succeeded. When atomic is set the batch is all-or-nothing: if any
+// operation would fail, none are applied, the failing operation reports its
+// error and the rest report ErrBatchAborted. Otherwise each operation is
+// applied independently, in order.
+func (c *Collection) Batch(ops []BatchOperation, atomic bool) []error {
+	return c.BatchAs("", ops, atomic)
+}
+
+// BatchAs is Batch with the documents written by principal
+func (c *Collection) BatchAs(principal string, ops []BatchOperation, atomic bool) []error {
+	results := make([]error, len(ops))
+	invalid := false
+	for i, op := range ops {
+		switch op.Op {
+		case ChangeInsert, ChangeUpdate, ChangeDelete:
+		default:
+			results[i] = fmt.Errorf("unknown operation type '%s'", op.Op)
+			invalid = true
+		}
+	}
+	if invalid && atomic {
+		return abortBatch(results)
+	}
+
+	c.write(func() error {
+		if atomic {
+			tx := &Transaction{db: c.db, principal: principal, ops: make([]TxOperation, len(ops))}
+			for i, op := range ops {
+				tx.ops[i] = TxOperation{Op: op.Op, Collection: c.Name, ID: op.ID, Data: op.Data}
+			}
+
+			err := tx.applyLocked(map[string]*Collection{c.Name: c})
+			var opErr *OperationError
+			if errors.As(err, &opErr) {
+				results[opErr.Index] = opErr.Err
+				abortBatch(results)
+			} else if err != nil {
+				for i := range results {
+					results[i] = err
+				}
+			}
+			return nil
+		}
+
+		for i, op := range ops {
+			if results[i] == nil {
+				results[i] = c.applyBatchOperationLocked(op, principal)
+			}
+		}
+		return nil
+	})
+
+	return results
+}
+
+// applyBatchOperationLocked applies one operation of a best-effort batch.
+// Callers must hold c.mu.
+func (c *Collection) applyBatchOperationLocked(op BatchOperation, principal string) error {
+	if c.normalizeID(op.ID) == "" {
+		return fmt.Errorf("document ID is required")
+	}
+
+	switch op.Op {
+	case ChangeInsert:
+		return c.insertLocked(op.ID, op.Data, principal)
+	case ChangeUpdate:
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+		return c.updateLocked(op.ID, op.Data, principal)
+	default:
+		return c.deleteLocked(op.ID)
+	}
+}
+
+// abortBatch marks every operation without an error as aborted
+func abortBatch(results []error) []error {
+	for i, err := range results {
+		if err == nil {
+			results[i] = ErrBatchAborted
+		}
+	}
+	return results
+}
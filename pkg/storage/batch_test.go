@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCollection_BatchBestEffort(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("b", map[string]interface{}{"name": "Bob"})
+
+	errs := collection.Batch([]BatchOperation{
+		{Op: ChangeInsert, ID: "a", Data: map[string]interface{}{"name": "Alice"}},
+		{Op: ChangeDelete, ID: "missing"},
+		{Op: ChangeUpdate, ID: "b", Data: map[string]interface{}{"name": "Robert"}},
+		{Op: "upsert", ID: "c"},
+		{Op: ChangeDelete, ID: "a"},
+	}, false)
+
+	if errs[0] != nil || errs[2] != nil || errs[4] != nil {
+		t.Fatalf("Expected operations 1, 3 and 5 to succeed, got %v", errs)
+	}
+	if !errors.Is(errs[1], ErrDocumentNotFound) {
+		t.Fatalf("Expected ErrDocumentNotFound deleting a missing document, got %v", errs[1])
+	}
+	if errs[3] == nil {
+		t.Fatal("Expected an error for an unknown operation")
+	}
+
+	bob, _ := collection.Get("b")
+	if bob.Data["name"] != "Robert" {
+		t.Fatalf("Expected update to apply, got %v", bob.Data["name"])
+	}
+	if _, err := collection.Get("a"); err == nil {
+		t.Fatal("Expected a to be inserted then deleted")
+	}
+}
+
+func TestCollection_BatchAtomic(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("b", map[string]interface{}{"name": "Bob"})
+
+	errs := collection.Batch([]BatchOperation{
+		{Op: ChangeInsert, ID: "a", Data: map[string]interface{}{"name": "Alice"}},
+		{Op: ChangeUpdate, ID: "missing", Data: map[string]interface{}{}},
+		{Op: ChangeDelete, ID: "b"},
+	}, true)
+
+	if !errors.Is(errs[0], ErrBatchAborted) || !errors.Is(errs[2], ErrBatchAborted) {
+		t.Fatalf("Expected the other operations to be aborted, got %v", errs)
+	}
+	if !errors.Is(errs[1], ErrDocumentNotFound) {
+		t.Fatalf("Expected ErrDocumentNotFound for the failing operation, got %v", errs[1])
+	}
+	if _, err := collection.Get("a"); err == nil {
+		t.Fatal("Expected no partial insert")
+	}
+	if _, err := collection.Get("b"); err != nil {
+		t.Fatal("Expected no partial delete")
+	}
+
+	errs = collection.Batch([]BatchOperation{
+		{Op: ChangeInsert, ID: "a", Data: map[string]interface{}{"name": "Alice"}},
+		{Op: ChangeDelete, ID: "b"},
+	}, true)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("Expected the batch to apply, got %v", errs)
+	}
+	if _, err := collection.Get("a"); err != nil {
+		t.Fatal("Expected a to be inserted")
+	}
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Change event types
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeTruncate removes every document in the collection and has no ID
+	ChangeTruncate = "truncate"
+)
+
+// ErrTooManySubscribers is returned by Subscribe when a subscriber limit has
+// been reached
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+// ChangeEvent describes a write to a document
+type ChangeEvent struct {
+	Type       string                 `json:"type"`
+	Collection string                 `json:"collection"`
+	ID         string                 `json:"id"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// changeHub fans change events out to subscribers. Publishing never blocks:
+// a subscriber whose buffer is full misses the event rather than stalling
+// the writer.
+type changeHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan ChangeEvent]struct{}
+	total       int
+	// Limits on concurrent subscribers; zero means unlimited
+	maxPerCollection int
+	maxTotal         int
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{
+		subscribers: make(map[string]map[chan ChangeEvent]struct{}),
+	}
+}
+
+func (h *changeHub) subscribe(collection string, buffer int) (<-chan ChangeEvent, func(), error) {
+	h.mu.Lock()
+	if h.maxTotal > 0 && h.total >= h.maxTotal {
+		h.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: limit of %d reached", ErrTooManySubscribers, h.maxTotal)
+	}
+	if h.maxPerCollection > 0 && len(h.subscribers[collection]) >= h.maxPerCollection {
+		h.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: limit of %d reached for collection '%s'", ErrTooManySubscribers, h.maxPerCollection, collection)
+	}
+
+	ch := make(chan ChangeEvent, buffer)
+	subs, exists := h.subscribers[collection]
+	if !exists {
+		subs = make(map[chan ChangeEvent]struct{})
+		h.subscribers[collection] = subs
+	}
+	subs[ch] = struct{}{}
+	h.total++
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			delete(h.subscribers[collection], ch)
+			if len(h.subscribers[collection]) == 0 {
+				delete(h.subscribers, collection)
+			}
+			h.total--
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe, nil
+}
+
+func (h *changeHub) publish(event ChangeEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[event.Collection] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (h *changeHub) count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.total
+}
+
+// Subscribe registers for change events on a collection. Events are
+// delivered on the returned channel, which holds up to buffer pending events;
+// events arriving while the buffer is full are dropped. The returned function
+// unsubscribes and closes the channel and must be called when done. An error
+// wrapping ErrTooManySubscribers is returned when a subscriber limit is
+// reached.
+func (db *Database) Subscribe(collection string, buffer int) (<-chan ChangeEvent, func(), error) {
+	return db.hub.subscribe(collection, buffer)
+}
+
+// SetSubscriberLimits caps the number of concurrent change subscribers per
+// collection and across the database. Zero means unlimited. Existing
+// subscribers are unaffected.
+func (db *Database) SetSubscriberLimits(perCollection, total int) {
+	db.hub.mu.Lock()
+	defer db.hub.mu.Unlock()
+
+	db.hub.maxPerCollection = perCollection
+	db.hub.maxTotal = total
+}
+
+// SubscriberCount returns the number of active change subscribers
+func (db *Database) SubscriberCount() int {
+	return db.hub.count()
+}
+
+// notify records a change to a document in the collection, marking it
+// dirty, appending it to the operations log and publishing the event to
+// subscribers
+func (c *Collection) notify(eventType, id string, data map[string]interface{}) {
+	if c.db == nil {
+		return
+	}
+
+	c.markDirty()
+	c.db.record(Operation{Op: eventType, Collection: c.Name, ID: id, Data: data})
+	c.db.hub.publish(ChangeEvent{
+		Type:       eventType,
+		Collection: c.Name,
+		ID:         id,
+		Data:       copyMap(data),
+	})
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDatabase_Subscribe(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	events, unsubscribe, err := db.Subscribe("test", 10)
+	if err != nil {
+		t.Fatalf("Expected no error subscribing, got %v", err)
+	}
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Update("user1", map[string]interface{}{"name": "Jane"})
+	collection.Delete("user1")
+
+	expected := []string{ChangeInsert, ChangeUpdate, ChangeDelete}
+	for _, eventType := range expected {
+		event := <-events
+		if event.Type != eventType || event.ID != "user1" || event.Collection != "test" {
+			t.Fatalf("Expected %s event for user1, got %+v", eventType, event)
+		}
+	}
+
+	unsubscribe()
+	if _, open := <-events; open {
+		t.Fatal("Expected channel to be closed after unsubscribe")
+	}
+
+	if db.SubscriberCount() != 0 {
+		t.Fatalf("Expected no subscribers, got %d", db.SubscriberCount())
+	}
+}
+
+func TestDatabase_SubscribeSlowConsumer(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	events, unsubscribe, err := db.Subscribe("test", 1)
+	if err != nil {
+		t.Fatalf("Expected no error subscribing, got %v", err)
+	}
+	defer unsubscribe()
+
+	// Writers must not block when the subscriber's buffer is full
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane"})
+
+	if event := <-events; event.ID != "user1" {
+		t.Fatalf("Expected first event to be delivered, got %+v", event)
+	}
+}
+
+func TestDatabase_SubscriberLimits(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	db.CreateCollection("orders")
+	users, _ := db.GetCollection("users")
+	db.SetSubscriberLimits(1, 2)
+
+	events, unsubscribe, err := db.Subscribe("users", 10)
+	if err != nil {
+		t.Fatalf("Expected no error subscribing, got %v", err)
+	}
+	defer unsubscribe()
+
+	if _, _, err := db.Subscribe("users", 10); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("Expected per-collection limit error, got %v", err)
+	}
+
+	_, unsubscribeOrders, err := db.Subscribe("orders", 10)
+	if err != nil {
+		t.Fatalf("Expected no error subscribing to another collection, got %v", err)
+	}
+
+	if _, _, err := db.Subscribe("other", 10); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("Expected global limit error, got %v", err)
+	}
+
+	// Existing subscribers keep receiving events
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	if event := <-events; event.ID != "user1" {
+		t.Fatalf("Expected event for user1, got %+v", event)
+	}
+
+	// Unsubscribing frees a slot
+	unsubscribeOrders()
+	_, unsubscribeOther, err := db.Subscribe("other", 10)
+	if err != nil {
+		t.Fatalf("Expected a freed slot to be reusable, got %v", err)
+	}
+	unsubscribeOther()
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// checksumData returns the SHA-256 of the canonical JSON encoding of data.
+// encoding/json sorts map keys, so equal maps always produce the same bytes.
+func checksumData(data map[string]interface{}) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChecksums returns the IDs of documents whose data no longer matches
+// their stored checksum. Documents without a checksum are skipped.
+func (c *Collection) VerifyChecksums() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	corrupted := []string{}
+	for id, doc := range c.Documents {
+		if doc.Checksum == "" {
+			continue
+		}
+		if checksumData(doc.Data) != doc.Checksum {
+			corrupted = append(corrupted, id)
+		}
+	}
+
+	sort.Strings(corrupted)
+	return corrupted
+}
+
+// VerifyChecksums verifies every collection, returning the corrupted
+// document IDs keyed by collection name. Collections without corruption are
+// omitted.
+func (db *Database) VerifyChecksums() map[string][]string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	results := make(map[string][]string)
+	for name, collection := range db.Collections {
+		if corrupted := collection.VerifyChecksums(); len(corrupted) > 0 {
+			results[name] = corrupted
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCollection_VerifyChecksums(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane", "age": 25})
+	collection.Merge("user2", map[string]interface{}{"age": 26})
+
+	if corrupted := collection.VerifyChecksums(); len(corrupted) != 0 {
+		t.Fatalf("Expected no corruption, got %v", corrupted)
+	}
+
+	// Tamper with the stored data behind the collection's back
+	collection.Documents["user1"].Data["age"] = 99
+
+	corrupted := collection.VerifyChecksums()
+	if len(corrupted) != 1 || corrupted[0] != "user1" {
+		t.Fatalf("Expected user1 to be reported as corrupted, got %v", corrupted)
+	}
+
+	if results := db.VerifyChecksums(); len(results["test"]) != 1 {
+		t.Fatalf("Expected database verification to report user1, got %v", results)
+	}
+}
+
+func TestChecksum_SurvivesPersistence(t *testing.T) {
+	tempFile := "test_checksum.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabase()
+	db.dataFile = tempFile
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": 30, "score": 1.5})
+	db.SaveToDisk()
+
+	db2 := NewDatabase()
+	db2.dataFile = tempFile
+	db2.LoadFromDisk()
+	collection2, _ := db2.GetCollection("test")
+
+	if corrupted := collection2.VerifyChecksums(); len(corrupted) != 0 {
+		t.Fatalf("Expected checksums to match after reload, got %v", corrupted)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import "time"
+
+// Clone returns a deep copy of the document so callers can freely modify it
+// without affecting the stored version
+func (d *Document) Clone() *Document {
+	if d == nil {
+		return nil
+	}
+
+	clone := *d
+	clone.Data = copyMap(d.Data)
+	if d.Labels != nil {
+		clone.Labels = append([]string(nil), d.Labels...)
+	}
+	if d.ExpiresAt != nil {
+		expiresAt := *d.ExpiresAt
+		clone.ExpiresAt = &expiresAt
+	}
+	if d.FieldTimes != nil {
+		clone.FieldTimes = make(map[string]time.Time, len(d.FieldTimes))
+		for field, t := range d.FieldTimes {
+			clone.FieldTimes[field] = t
+		}
+	}
+
+	return &clone
+}
+
+// cloneDocuments deep-copies a slice of documents
+func cloneDocuments(docs []*Document) []*Document {
+	for i, doc := range docs {
+		docs[i] = doc.Clone()
+	}
+	return docs
+}
+
+// copyMap deep-copies a document data map
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		out[key] = copyValue(value)
+	}
+	return out
+}
+
+// copyValue deep-copies the nested maps and slices that make up JSON data
+func copyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return copyMap(value)
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, elem := range value {
+			out[i] = copyValue(elem)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// writeBatcher coalesces single-document writes to a collection so that a
+// burst of writes is applied under one lock acquisition instead of one each
+type writeBatcher struct {
+	ops      chan writeOp
+	window   time.Duration
+	maxBatch int
+	stop     chan struct{}
+	stopped  chan struct{}
+	// waiting counts writers that have submitted or are about to submit a
+	// write and have not yet received its result
+	waiting atomic.Int64
+}
+
+// writeOp is a pending write. apply runs with the collection lock held and
+// its result is delivered on result.
+type writeOp struct {
+	apply  func() error
+	result chan error
+}
+
+// EnableWriteCoalescing batches single-document writes (Insert, Update,
+// Upsert, Merge and Delete) arriving within window of each other, up to
+// maxBatch writes, and applies each batch under a single acquisition of the
+// collection lock. A batch is applied as soon as it is full, the window has
+// elapsed, or every writer currently waiting is part of it. Writers still
+// block until their write is applied, so a write may take up to window longer
+// to return. Coalescing is not persisted.
+func (c *Collection) EnableWriteCoalescing(window time.Duration, maxBatch int) {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+
+	b := &writeBatcher{
+		ops:      make(chan writeOp),
+		window:   window,
+		maxBatch: maxBatch,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go c.runBatcher(b)
+
+	if previous := c.batcher.Swap(b); previous != nil {
+		previous.close()
+	}
+}
+
+// DisableWriteCoalescing returns the collection to applying each write as it
+// arrives. Writes already batched are applied before it returns.
+func (c *Collection) DisableWriteCoalescing() {
+	if b := c.batcher.Swap(nil); b != nil {
+		b.close()
+	}
+}
+
+// stopCoalescingLocked stops the write batcher of every collection, before
+// they are dropped or replaced. Callers must hold db.mu for writing.
+func (db *Database) stopCoalescingLocked() {
+	for _, collection := range db.Collections {
+		collection.DisableWriteCoalescing()
+	}
+}
+
+func (b *writeBatcher) close() {
+	close(b.stop)
+	<-b.stopped
+}
+
+// write applies a single-document write, through the batcher when
+// coalescing is enabled
+func (c *Collection) write(apply func() error) error {
+	if b := c.batcher.Load(); b != nil {
+		op := writeOp{apply: apply, result: make(chan error, 1)}
+		b.waiting.Add(1)
+		select {
+		case b.ops <- op:
+			err := <-op.result
+			b.waiting.Add(-1)
+			return err
+		case <-b.stopped:
+			// Coalescing was disabled while we were submitting; apply directly
+			b.waiting.Add(-1)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return apply()
+}
+
+func (c *Collection) runBatcher(b *writeBatcher) {
+	defer close(b.stopped)
+
+	for {
+		var batch []writeOp
+		select {
+		case op := <-b.ops:
+			batch = append(batch, op)
+		case <-b.stop:
+			return
+		}
+
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(batch) < b.maxBatch && int64(len(batch)) < b.waiting.Load() {
+			select {
+			case op := <-b.ops:
+				batch = append(batch, op)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		c.mu.Lock()
+		for _, op := range batch {
+			op.result <- op.apply()
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteCoalescing_AppliesAllWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("events")
+	collection, _ := db.GetCollection("events")
+
+	collection.EnableWriteCoalescing(5*time.Millisecond, 64)
+	defer collection.DisableWriteCoalescing()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			if err := collection.Insert(id, map[string]interface{}{"n": i}); err != nil {
+				t.Errorf("Expected no error inserting %s, got %v", id, err)
+			}
+			if i%2 == 0 {
+				if err := collection.Update(id, map[string]interface{}{"n": i, "even": true}); err != nil {
+					t.Errorf("Expected no error updating %s, got %v", id, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Errors are reported back to the individual writer
+	if err := collection.Insert("0", map[string]interface{}{}); err == nil {
+		t.Fatal("Expected duplicate insert to fail while coalescing")
+	}
+
+	created, err := collection.Upsert("new", map[string]interface{}{"n": -1})
+	if err != nil || !created {
+		t.Fatalf("Expected upsert to create document, got created=%v err=%v", created, err)
+	}
+
+	if err := collection.Delete("new"); err != nil {
+		t.Fatalf("Expected no error deleting, got %v", err)
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	reloaded := NewDatabaseWithPath(path)
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading from disk, got %v", err)
+	}
+	events, _ := reloaded.GetCollection("events")
+
+	if len(events.Documents) != 200 {
+		t.Fatalf("Expected 200 documents after reload, got %d", len(events.Documents))
+	}
+	if doc := events.Documents["42"]; doc.Data["even"] != true {
+		t.Fatalf("Expected coalesced update to persist, got %v", doc.Data)
+	}
+}
+
+func TestWriteCoalescing_Disable(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("events")
+	collection, _ := db.GetCollection("events")
+
+	collection.EnableWriteCoalescing(time.Millisecond, 8)
+	collection.Insert("a", map[string]interface{}{})
+	collection.DisableWriteCoalescing()
+
+	if err := collection.Insert("b", map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected no error after disabling coalescing, got %v", err)
+	}
+	if len(collection.List()) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(collection.List()))
+	}
+}
+
+func TestWriteCoalescing_StoppedWithCollection(t *testing.T) {
+	db := NewDatabase()
+	enable := func(name string) *Collection {
+		db.CreateCollection(name)
+		collection, _ := db.GetCollection(name)
+		collection.EnableWriteCoalescing(time.Millisecond, 8)
+		return collection
+	}
+
+	deleted := enable("deleted")
+	if err := db.DeleteCollection("deleted"); err != nil {
+		t.Fatalf("Expected no error deleting, got %v", err)
+	}
+	if deleted.batcher.Load() != nil {
+		t.Fatal("Expected the batcher to stop when its collection is deleted")
+	}
+
+	reset := enable("reset")
+	db.Reset()
+	if reset.batcher.Load() != nil {
+		t.Fatal("Expected the batcher to stop when the database is reset")
+	}
+
+	restored := enable("restored")
+	var snapshot bytes.Buffer
+	if err := db.Backup(&snapshot); err != nil {
+		t.Fatalf("Expected no error backing up, got %v", err)
+	}
+	if err := db.Restore(&snapshot); err != nil {
+		t.Fatalf("Expected no error restoring, got %v", err)
+	}
+	if restored.batcher.Load() != nil {
+		t.Fatal("Expected the batcher to stop when its collection is replaced by a restore")
+	}
+}
+
+func benchmarkParallelInsert(b *testing.B, coalesce bool) {
+	db := NewDatabase()
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+
+	if coalesce {
+		collection.EnableWriteCoalescing(100*time.Microsecond, 256)
+		defer collection.DisableWriteCoalescing()
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := strconv.FormatInt(next.Add(1), 10)
+			if err := collection.Insert(id, map[string]interface{}{"value": id}); err != nil {
+				b.Errorf("Insert %s failed: %v", id, err)
+			}
+		}
+	})
+}
+
+func BenchmarkInsertParallel(b *testing.B) {
+	benchmarkParallelInsert(b, false)
+}
+
+func BenchmarkInsertParallelCoalesced(b *testing.B) {
+	benchmarkParallelInsert(b, true)
+}
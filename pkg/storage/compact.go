@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCompactionRatio is the share of the data file that must be wasted
+// before background compaction rewrites it
+const DefaultCompactionRatio = 0.5
+
+// WastedRatio returns the share of the data file and collection files, from
+// 0 to 1, taken by data the database no longer holds, such as documents
+// deleted since the files were written. Whitespace is not counted, so
+// formatting is never mistaken for waste. It is 0 when there is no data file.
+func (db *Database) WastedRatio() (float64, error) {
+	stored, err := db.storedSize()
+	if err != nil {
+		return 0, err
+	}
+
+	snapshot, err := db.marshalSnapshot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal database: %w", err)
+	}
+	live, err := compactSize(snapshot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure database: %w", err)
+	}
+
+	if stored == 0 || live >= stored {
+		return 0, nil
+	}
+	return float64(stored-live) / float64(stored), nil
+}
+
+// storedSize returns the size of the data file and the collection files it
+// lists without insignificant whitespace, or 0 when there is no data file
+func (db *Database) storedSize() (int, error) {
+	data, err := os.ReadFile(db.dataFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read data file: %w", err)
+	}
+	data, err = decompress(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decompress data file: %w", err)
+	}
+	size, err := compactSize(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure data file: %w", err)
+	}
+
+	var snapshot struct {
+		Shards []string `json:"shards"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("failed to measure data file: %w", err)
+	}
+	for _, name := range snapshot.Shards {
+		data, err := os.ReadFile(db.shardPath(name))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read collection file '%s': %w", name, err)
+		}
+		data, err = decompress(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress collection file '%s': %w", name, err)
+		}
+		n, err := compactSize(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to measure collection file '%s': %w", name, err)
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// compactSize returns the size of JSON data without insignificant whitespace
+func compactSize(data []byte) (int, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return 0, err
+	}
+	return buf.Len(), nil
+}
+
+// Compact rewrites the data file when at least ratio of it is wasted and
+// reports whether it did
+func (db *Database) Compact(ratio float64) (bool, error) {
+	wasted, err := db.WastedRatio()
+	if err != nil || wasted == 0 || wasted < ratio {
+		return false, err
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StartCompaction checks the data file every interval in a background
+// goroutine and compacts it once at least ratio of it is wasted. The returned
+// function stops checking and waits for any in-progress compaction to finish.
+func (db *Database) StartCompaction(interval time.Duration, ratio float64) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := db.Compact(ratio); err != nil {
+					log.Printf("Compaction failed: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillForCompaction saves a collection of sizable documents and deletes most
+// of them, leaving the data file mostly wasted
+func fillForCompaction(t *testing.T, db *Database) {
+	t.Helper()
+
+	db.CreateCollection("events")
+	events, _ := db.GetCollection("events")
+	payload := strings.Repeat("x", 200)
+	for i := 0; i < 50; i++ {
+		events.Insert(fmt.Sprintf("event%d", i), map[string]interface{}{"payload": payload})
+	}
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	for i := 0; i < 40; i++ {
+		events.Delete(fmt.Sprintf("event%d", i))
+	}
+}
+
+func TestDatabase_Compact(t *testing.T) {
+	tempFile := "test_compact.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	if wasted, err := db.WastedRatio(); err != nil || wasted != 0 {
+		t.Fatalf("Expected no waste without a data file, got %v (%v)", wasted, err)
+	}
+
+	fillForCompaction(t, db)
+	before, _ := os.Stat(tempFile)
+
+	wasted, err := db.WastedRatio()
+	if err != nil {
+		t.Fatalf("Expected no error measuring waste, got %v", err)
+	}
+	if wasted < 0.7 {
+		t.Fatalf("Expected most of the file to be wasted, got %v", wasted)
+	}
+
+	// Below the threshold nothing is rewritten
+	if compacted, err := db.Compact(0.9); err != nil || compacted {
+		t.Fatalf("Expected no compaction below the ratio, got %v (%v)", compacted, err)
+	}
+
+	if compacted, err := db.Compact(0.5); err != nil || !compacted {
+		t.Fatalf("Expected compaction, got %v (%v)", compacted, err)
+	}
+	after, _ := os.Stat(tempFile)
+	if after.Size() >= before.Size()/2 {
+		t.Fatalf("Expected the data file to shrink from %d bytes, got %d", before.Size(), after.Size())
+	}
+	if wasted, _ := db.WastedRatio(); wasted != 0 {
+		t.Errorf("Expected no waste after compaction, got %v", wasted)
+	}
+
+	loaded := NewDatabaseWithPath(tempFile)
+	if err := loaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	events, _ := loaded.GetCollection("events")
+	if docs := events.List(); len(docs) != 10 {
+		t.Errorf("Expected 10 documents after compaction, got %d", len(docs))
+	}
+}
+
+func TestDatabase_StartCompaction(t *testing.T) {
+	tempFile := "test_compact_scheduler.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	fillForCompaction(t, db)
+	before, _ := os.Stat(tempFile)
+
+	stop := db.StartCompaction(10*time.Millisecond, DefaultCompactionRatio)
+	defer stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if info, err := os.Stat(tempFile); err == nil && info.Size() > 0 && info.Size() < before.Size()/2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected the scheduler to compact the data file")
+}
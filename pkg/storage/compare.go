@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// toFloat64 converts any Go numeric type to float64. Documents decoded from
+// JSON always hold float64, while documents inserted in-process may hold
+// ints, so comparisons need a common representation.
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// typeRank orders values of different kinds so that sorting a field with
+// mixed types is deterministic: numbers, then strings, then booleans, then
+// anything else.
+func typeRank(v interface{}) int {
+	if _, ok := toFloat64(v); ok {
+		return 0
+	}
+	switch v.(type) {
+	case string:
+		return 1
+	case bool:
+		return 2
+	}
+	return 3
+}
+
+// compareValues compares two field values, returning -1, 0 or 1. Numbers are
+// compared numerically and strings lexically; values of different kinds are
+// ordered by typeRank.
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch ra {
+	case 0:
+		fa, _ := toFloat64(a)
+		fb, _ := toFloat64(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case 1:
+		return strings.Compare(a.(string), b.(string))
+	case 2:
+		ba, bb := a.(bool), b.(bool)
+		switch {
+		case ba == bb:
+			return 0
+		case !ba:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvMetaColumns are the document metadata columns that precede the data
+// fields in CSV exports
+var csvMetaColumns = []string{"id", "created_at", "updated_at"}
+
+// ExportCSV writes the collection's documents to w as CSV, ordered by
+// creation time. The header row holds the metadata columns followed by the
+// union of top-level data fields, sorted. Missing fields are left blank and
+// nested objects and arrays are JSON-encoded into their cell. Rows are
+// written one document at a time rather than buffered, so documents deleted
+// during the export are skipped.
+func (c *Collection) ExportCSV(w io.Writer) error {
+	ids, fields := c.csvLayout()
+
+	out := csv.NewWriter(w)
+	if err := out.Write(append(append([]string{}, csvMetaColumns...), fields...)); err != nil {
+		return err
+	}
+
+	row := make([]string, len(csvMetaColumns)+len(fields))
+	for _, id := range ids {
+		doc, err := c.Get(id)
+		if err != nil {
+			continue
+		}
+
+		row[0] = doc.ID
+		row[1] = doc.CreatedAt.Format(time.RFC3339Nano)
+		row[2] = doc.UpdatedAt.Format(time.RFC3339Nano)
+		for i, field := range fields {
+			cell, err := csvCell(doc.Data[field])
+			if err != nil {
+				return fmt.Errorf("document '%s' field '%s': %w", id, field, err)
+			}
+			row[len(csvMetaColumns)+i] = cell
+		}
+
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvLayout returns the IDs of live documents in creation order and the
+// sorted union of their top-level data fields
+func (c *Collection) csvLayout() ([]string, []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(c.Documents))
+	for _, doc := range c.Documents {
+		docs = append(docs, doc)
+	}
+	docs = liveDocuments(docs)
+	sortByCreation(docs)
+
+	ids := make([]string, len(docs))
+	seen := make(map[string]struct{})
+	fields := []string{}
+	for i, doc := range docs {
+		ids[i] = doc.ID
+		for field := range doc.Data {
+			if _, exists := seen[field]; !exists {
+				seen[field] = struct{}{}
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+
+	return ids, fields
+}
+
+// csvCell formats a data value for a CSV cell
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
+
+// ImportCSV imports documents from CSV with a header row. An "id" column
+// supplies document IDs, generated for rows where it is blank, and the
+// created_at and updated_at columns written by ExportCSV are ignored. Cells
+// are type-inferred: numbers, booleans and JSON objects or arrays are
+// decoded, blank cells are omitted and anything else stays a string. It
+// returns how many documents were imported; rows that fail are skipped and
+// reported as RowErrors joined into the returned error.
+func (c *Collection) ImportCSV(r io.Reader) (int, error) {
+	return c.ImportCSVAs("", r)
+}
+
+// ImportCSVAs is ImportCSV with the documents written by principal
+func (c *Collection) ImportCSVAs(principal string, r io.Reader) (int, error) {
+	return c.ImportCSVAsContext(context.Background(), principal, r)
+}
+
+// ImportCSVContext is ImportCSV that stops before the next row once ctx is
+// done, returning the context's error joined with any row errors
+func (c *Collection) ImportCSVContext(ctx context.Context, r io.Reader) (int, error) {
+	return c.ImportCSVAsContext(ctx, "", r)
+}
+
+// ImportCSVAsContext is ImportCSVContext with the documents written by
+// principal
+func (c *Collection) ImportCSVAsContext(ctx context.Context, principal string, r io.Reader) (int, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+
+	header, err := in.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	imported := 0
+	var errs []error
+	for row := 1; ; row++ {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, &RowError{Row: row, Err: err})
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			break
+		}
+		if len(record) != len(header) {
+			errs = append(errs, &RowError{Row: row, Err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+
+		id := ""
+		data := make(map[string]interface{})
+		for i, column := range header {
+			switch column {
+			case "id":
+				id = record[i]
+			case "created_at", "updated_at":
+			default:
+				if record[i] != "" {
+					data[column] = inferCSVValue(record[i])
+				}
+			}
+		}
+
+		if err := c.importRow(principal, id, data); err != nil {
+			errs = append(errs, &RowError{Row: row, Err: err})
+			continue
+		}
+		imported++
+	}
+
+	return imported, errors.Join(errs...)
+}
+
+// inferCSVValue decodes a CSV cell into a number, boolean, or JSON object or
+// array when it looks like one. Numbers with leading zeros, such as postal
+// codes, stay strings, as do NaN and infinities, which JSON cannot store.
+func inferCSVValue(cell string) interface{} {
+	switch cell {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if n, err := strconv.ParseFloat(cell, 64); err == nil && !hasLeadingZero(cell) && !math.IsInf(n, 0) && !math.IsNaN(n) {
+		return n
+	}
+
+	if cell[0] == '{' || cell[0] == '[' {
+		var v interface{}
+		if err := json.Unmarshal([]byte(cell), &v); err == nil {
+			return v
+		}
+	}
+
+	return cell
+}
+
+// hasLeadingZero reports whether a numeric string starts with a zero that
+// would be lost by parsing it, like "007"
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
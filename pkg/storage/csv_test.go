@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollection_ExportCSV(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": float64(30), "active": true})
+	time.Sleep(time.Millisecond)
+	collection.Insert("user2", map[string]interface{}{
+		"name":    "Jane, Jr.",
+		"address": map[string]interface{}{"city": "Paris"},
+		"tags":    []interface{}{"a", "b"},
+	})
+	collection.InsertWithTTL("gone", map[string]interface{}{"name": "Expired"}, -time.Second)
+
+	var buf bytes.Buffer
+	if err := collection.ExportCSV(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d records", len(records))
+	}
+
+	header := []string{"id", "created_at", "updated_at", "active", "address", "age", "name", "tags"}
+	if !reflect.DeepEqual(records[0], header) {
+		t.Fatalf("Expected header %v, got %v", header, records[0])
+	}
+
+	first := records[1]
+	if first[0] != "user1" || first[3] != "true" || first[4] != "" || first[5] != "30" || first[6] != "John" || first[7] != "" {
+		t.Errorf("Unexpected first row %v", first)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, first[1]); err != nil {
+		t.Errorf("Expected an RFC 3339 created_at, got %q", first[1])
+	}
+
+	second := records[2]
+	if second[0] != "user2" || second[4] != `{"city":"Paris"}` || second[6] != "Jane, Jr." || second[7] != `["a","b"]` {
+		t.Errorf("Unexpected second row %v", second)
+	}
+}
+
+func TestCollection_ImportCSV(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	input := "id,name,age,active,zip,tags,note\n" +
+		"user1,John,30,true,02134,\"[\"\"a\"\"]\",\n" +
+		",Anonymous,1.5,false,,,plain text\n" +
+		"user3,Short\n"
+
+	imported, err := collection.ImportCSV(strings.NewReader(input))
+	if imported != 2 {
+		t.Errorf("Expected 2 documents imported, got %d", imported)
+	}
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 {
+		t.Fatalf("Expected an error for row 3, got %v", err)
+	}
+
+	user1, _ := collection.Get("user1")
+	expected := map[string]interface{}{
+		"name":   "John",
+		"age":    float64(30),
+		"active": true,
+		"zip":    "02134",
+		"tags":   []interface{}{"a"},
+	}
+	if !reflect.DeepEqual(user1.Data, expected) {
+		t.Errorf("Expected %v, got %v", expected, user1.Data)
+	}
+
+	docs := collection.List()
+	if len(docs) != 2 || docs[1].ID == "" || docs[1].Data["age"] != 1.5 || docs[1].Data["active"] != false {
+		t.Errorf("Expected a generated-ID document with inferred types, got %+v", docs)
+	}
+}
+
+func TestCollection_ExportImportCSVRoundTrip(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("source")
+	db.CreateCollection("target")
+	source, _ := db.GetCollection("source")
+	target, _ := db.GetCollection("target")
+
+	source.Insert("user1", map[string]interface{}{"name": "John", "age": float64(30), "address": map[string]interface{}{"city": "Paris"}})
+
+	var buf bytes.Buffer
+	source.ExportCSV(&buf)
+	if imported, err := target.ImportCSV(&buf); imported != 1 || err != nil {
+		t.Fatalf("Expected 1 document imported, got %d: %v", imported, err)
+	}
+
+	original, _ := source.Get("user1")
+	copied, err := target.Get("user1")
+	if err != nil || !reflect.DeepEqual(original.Data, copied.Data) {
+		t.Errorf("Expected %v, got %v (%v)", original.Data, copied, err)
+	}
+}
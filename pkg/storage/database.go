@@ -0,0 +1,1418 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Document represents a document in the database
+type Document struct {
+	ID            string                 `json:"id"`
+	Data          map[string]interface{} `json:"data"`
+	Labels        []string               `json:"labels,omitempty"`
+	Checksum      string                 `json:"checksum,omitempty"`
+	FieldTimes    map[string]time.Time   `json:"field_times,omitempty"`
+	ExpiresAt     *time.Time             `json:"expires_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	CreatedBy     string                 `json:"created_by,omitempty"`
+	UpdatedBy     string                 `json:"updated_by,omitempty"`
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	Version       int                    `json:"version"`
+}
+
+// Collection represents a collection of documents
+type Collection struct {
+	Name             string                 `json:"name"`
+	Documents        map[string]*Document   `json:"documents"`
+	AppendOnly       bool                   `json:"append_only,omitempty"`
+	TrimIDs          bool                   `json:"trim_ids,omitempty"`
+	StrictQueries    bool                   `json:"strict_queries,omitempty"`
+	FieldResolution  map[string]string      `json:"field_resolution,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	IndexDefinitions []IndexDefinition      `json:"indexes,omitempty"`
+	SaveInterval     time.Duration          `json:"save_interval,omitempty"`
+	mu               sync.RWMutex
+	labelIndex       map[string]map[string]struct{}
+	indexes          map[string]*index
+	db               *Database
+	migrations       map[int]MigrationFunc
+	batcher          atomic.Pointer[writeBatcher]
+	// Changes not yet saved to the collection's shard file, when it has its
+	// own save interval
+	dirty atomic.Bool
+	// When and under which name the shard file was last written, guarded by
+	// the database's saveMu
+	savedAt time.Time
+	savedAs string
+}
+
+// Database represents the main database.
+//
+// Locks are always acquired in the same order to rule out deadlocks: first
+// db.mu, then collection locks, several at once only in collection name
+// order, then leaf locks such as those guarding global IDs, subscribers and
+// the operations log, which never acquire another lock. Collection methods
+// therefore never take db.mu, and database methods that need a collection
+// lock take db.mu first. Saves hold saveMu, which comes before db.mu.
+type Database struct {
+	Collections map[string]*Collection `json:"collections"`
+	mu          sync.RWMutex
+	dataFile    string
+	hub         *changeHub
+	dirty       atomic.Bool
+	// Number of running auto-save and expiry sweeper goroutines
+	autoSavers atomic.Int32
+	sweepers   atomic.Int32
+	ids        globalIDIndex
+	oplog      atomic.Pointer[opLog]
+	compress   bool
+	// Unix nanoseconds of the last successful save
+	lastSave atomic.Int64
+	// saveMu serializes saves. lastSnapshot, guarded by it, is when the
+	// last successful save took its snapshot.
+	saveMu       sync.Mutex
+	saveDebounce time.Duration
+	lastSnapshot time.Time
+	// writeFile writes the data file; tests replace it to simulate a full
+	// disk
+	writeFile func(path string, write func(w io.Writer) error) error
+	// Outcome of failed saves, guarded by saveStatusMu, a leaf lock
+	saveStatusMu sync.Mutex
+	saveErrors   int64
+	saveFailures int
+	saveErr      string
+	saveErrAt    time.Time
+}
+
+// Options configures a database
+type Options struct {
+	// DataFile is the path the database is persisted to. Defaults to
+	// DefaultDataFile, with a .gz suffix when Compress is set.
+	DataFile string
+	// Compress gzips the snapshot written by SaveToDisk. LoadFromDisk reads
+	// compressed and plain snapshots either way.
+	Compress bool
+	// SaveDebounce delays each SaveToDisk by this long so that saves
+	// requested within the window are written once. Zero saves immediately.
+	SaveDebounce time.Duration
+}
+
+// Errors returned, wrapped with the collection name or document ID, by
+// storage operations. Match them with errors.Is.
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("collection already exists")
+	ErrDocumentNotFound   = errors.New("document not found")
+	ErrDocumentExists     = errors.New("document already exists")
+)
+
+// ErrFieldNotFound is returned when removing a field a document does not have
+var ErrFieldNotFound = errors.New("field not found")
+
+// DefaultDataFile is the data file used when no path is configured
+const DefaultDataFile = "rafdb_data.json"
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// NewDatabase creates a new database instance
+func NewDatabase() *Database {
+	return NewDatabaseWithPath(DefaultDataFile)
+}
+
+// NewDatabaseWithPath creates a new database instance persisted to path
+func NewDatabaseWithPath(path string) *Database {
+	return NewDatabaseWithOptions(Options{DataFile: path})
+}
+
+// NewDatabaseWithOptions creates a new database instance configured by opts
+func NewDatabaseWithOptions(opts Options) *Database {
+	path := opts.DataFile
+	if path == "" {
+		path = DefaultDataFile
+		if opts.Compress {
+			path += ".gz"
+		}
+	}
+
+	return &Database{
+		Collections:  make(map[string]*Collection),
+		dataFile:     path,
+		hub:          newChangeHub(),
+		compress:     opts.Compress,
+		saveDebounce: opts.SaveDebounce,
+		writeFile:    writeFileAtomic,
+	}
+}
+
+// DataFile returns the path the database is persisted to
+func (db *Database) DataFile() string {
+	return db.dataFile
+}
+
+// MaxCollectionNameLength is the longest collection name allowed, in bytes
+const MaxCollectionNameLength = 128
+
+// validateCollectionName rejects names that cannot be used safely in URL
+// paths or as file names: blank names, names containing slashes or "..",
+// names starting with a dot and names with non-printable characters
+func validateCollectionName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("collection name is required")
+	}
+	if len(name) > MaxCollectionNameLength {
+		return fmt.Errorf("collection name is longer than %d bytes", MaxCollectionNameLength)
+	}
+	if strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("collection name '%s' must not contain slashes", name)
+	}
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("collection name '%s' must not contain '..'", name)
+	}
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("collection name '%s' must not start with a dot", name)
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("collection name %q must not contain non-printable characters", name)
+		}
+	}
+	return nil
+}
+
+// CreateCollection creates a new collection
+func (db *Database) CreateCollection(name string) error {
+	if err := validateCollectionName(name); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.Collections[name]; exists {
+		return fmt.Errorf("%w: '%s'", ErrCollectionExists, name)
+	}
+
+	db.Collections[name] = &Collection{
+		Name:      name,
+		Documents: make(map[string]*Document),
+		CreatedAt: time.Now(),
+		db:        db,
+	}
+
+	db.record(Operation{Op: OpCreateCollection, Collection: name})
+	db.markDirty()
+	return nil
+}
+
+// GetCollection returns a collection by name
+func (db *Database) GetCollection(name string) (*Collection, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	collection, exists := db.Collections[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, name)
+	}
+
+	return collection, nil
+}
+
+// ListCollections returns all collection names
+func (db *Database) ListCollections() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	names := make([]string, 0, len(db.Collections))
+	for name := range db.Collections {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// CollectionInfo summarizes a collection for listings
+type CollectionInfo struct {
+	Name      string                 `json:"name"`
+	Count     int                    `json:"count"`
+	CreatedAt time.Time              `json:"created_at"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ListCollectionInfo returns a summary of every collection, ordered by name
+func (db *Database) ListCollectionInfo() []CollectionInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	infos := make([]CollectionInfo, 0, len(db.Collections))
+	for name, collection := range db.Collections {
+		collection.mu.RLock()
+		infos = append(infos, CollectionInfo{
+			Name:      name,
+			Count:     len(collection.Documents),
+			CreatedAt: collection.CreatedAt,
+			Metadata:  copyMap(collection.Metadata),
+		})
+		collection.mu.RUnlock()
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// DeleteCollection deletes a collection
+func (db *Database) DeleteCollection(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	collection, exists := db.Collections[name]
+	if !exists {
+		return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, name)
+	}
+
+	collection.DisableWriteCoalescing()
+	delete(db.Collections, name)
+	db.releaseCollectionIDs(name)
+	db.record(Operation{Op: OpDeleteCollection, Collection: name})
+	db.markDirty()
+	return nil
+}
+
+// CopyCollection creates collection dst as a deep copy of src, including its
+// settings and index definitions. Later changes to either collection do not
+// affect the other.
+func (db *Database) CopyCollection(src, dst string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	source, err := db.checkCollectionMoveLocked(src, dst)
+	if err != nil {
+		return err
+	}
+
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+
+	if len(source.Documents) > 0 && db.GlobalIDUniqueness() {
+		return fmt.Errorf("%w: cannot copy collection '%s' while IDs must be unique across collections", ErrDuplicateID, src)
+	}
+
+	copied := &Collection{
+		Name:          dst,
+		Documents:     make(map[string]*Document, len(source.Documents)),
+		AppendOnly:    source.AppendOnly,
+		TrimIDs:       source.TrimIDs,
+		StrictQueries: source.StrictQueries,
+		Metadata:      copyMap(source.Metadata),
+		SaveInterval:  source.SaveInterval,
+		CreatedAt:     time.Now(),
+		db:            db,
+	}
+	for id, doc := range source.Documents {
+		copied.Documents[id] = doc.Clone()
+	}
+	if source.FieldResolution != nil {
+		copied.FieldResolution = make(map[string]string, len(source.FieldResolution))
+		for field, strategy := range source.FieldResolution {
+			copied.FieldResolution[field] = strategy
+		}
+	}
+	if source.migrations != nil {
+		copied.migrations = make(map[int]MigrationFunc, len(source.migrations))
+		for from, fn := range source.migrations {
+			copied.migrations[from] = fn
+		}
+	}
+	if source.indexes != nil {
+		copied.indexes = make(map[string]*index, len(source.indexes))
+		for field, idx := range source.indexes {
+			copied.indexes[field] = &index{field: field, unique: idx.unique}
+		}
+		copied.syncIndexDefinitionsLocked()
+	}
+	copied.rebuildLabelIndex()
+	copied.rebuildIndexes()
+
+	db.Collections[dst] = copied
+	db.record(Operation{Op: OpCopyCollection, Collection: src, Target: dst})
+	db.markDirty()
+	return nil
+}
+
+// RenameCollection renames collection oldName to newName, keeping its
+// documents and settings
+func (db *Database) RenameCollection(oldName, newName string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	collection, err := db.checkCollectionMoveLocked(oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	collection.mu.Lock()
+	collection.Name = newName
+	collection.mu.Unlock()
+
+	delete(db.Collections, oldName)
+	db.Collections[newName] = collection
+	db.renameCollectionIDs(oldName, newName)
+	db.record(Operation{Op: OpRenameCollection, Collection: oldName, Target: newName})
+	db.markDirty()
+	return nil
+}
+
+// checkCollectionMoveLocked returns collection src if it exists and dst is
+// free. Callers must hold db.mu.
+func (db *Database) checkCollectionMoveLocked(src, dst string) (*Collection, error) {
+	collection, exists := db.Collections[src]
+	if !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, src)
+	}
+	if err := validateCollectionName(dst); err != nil {
+		return nil, err
+	}
+	if _, exists := db.Collections[dst]; exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrCollectionExists, dst)
+	}
+	return collection, nil
+}
+
+// SetAppendOnly marks the collection as append-only. Documents in an
+// append-only collection can be inserted but never updated or deleted.
+func (c *Collection) SetAppendOnly(appendOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.AppendOnly = appendOnly
+	c.markDirty()
+}
+
+// IsAppendOnly reports whether the collection is append-only
+func (c *Collection) IsAppendOnly() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.AppendOnly
+}
+
+// SetTrimIDs enables or disables trimming of surrounding whitespace from
+// document IDs on every operation, so that "u1 " and "u1" refer to the same
+// document. Enabling it re-keys existing documents to their trimmed IDs and
+// fails without changes if two existing IDs would collide.
+func (c *Collection) SetTrimIDs(enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !enabled || c.TrimIDs {
+		if c.TrimIDs != enabled {
+			c.TrimIDs = enabled
+			c.markDirty()
+		}
+		return nil
+	}
+
+	trimmed := make(map[string]string, len(c.Documents))
+	renames := make(map[string]string)
+	for id := range c.Documents {
+		key := strings.TrimSpace(id)
+		if other, exists := trimmed[key]; exists {
+			return fmt.Errorf("cannot trim IDs: '%s' and '%s' collide", other, id)
+		}
+		trimmed[key] = id
+		if key != id {
+			renames[id] = key
+		}
+	}
+	if err := c.renameIDs(renames); err != nil {
+		return fmt.Errorf("cannot trim IDs: %w", err)
+	}
+
+	for key, id := range trimmed {
+		if key != id {
+			doc := c.Documents[id]
+			delete(c.Documents, id)
+			doc.ID = key
+			c.Documents[key] = doc
+		}
+	}
+
+	c.TrimIDs = true
+	c.rebuildLabelIndex()
+	c.rebuildIndexes()
+	c.markDirty()
+	return nil
+}
+
+// normalizeID applies the collection's ID normalization. Callers must hold
+// c.mu.
+func (c *Collection) normalizeID(id string) string {
+	if c.TrimIDs {
+		return strings.TrimSpace(id)
+	}
+	return id
+}
+
+// checkWritable returns an error if documents in the collection may not be
+// modified. Callers must hold c.mu.
+func (c *Collection) checkWritable() error {
+	if c.AppendOnly {
+		return fmt.Errorf("collection '%s' is append-only", c.Name)
+	}
+	return nil
+}
+
+// Reset drops every collection, leaving an empty database. The data file
+// path and other database configuration are preserved.
+func (db *Database) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.stopCoalescingLocked()
+	db.Collections = make(map[string]*Collection)
+	db.rebuildIDIndexLocked()
+	db.record(Operation{Op: OpReset})
+	db.markDirty()
+}
+
+// Insert inserts a document into a collection
+func (c *Collection) Insert(id string, data map[string]interface{}) error {
+	return c.InsertAs("", id, data)
+}
+
+// InsertAs inserts a document, recording principal as its creator
+func (c *Collection) InsertAs(principal, id string, data map[string]interface{}) error {
+	return c.write(func() error {
+		return c.insertLocked(id, data, principal)
+	})
+}
+
+// insertLocked inserts a document written by principal. Nil data is stored
+// as an empty map. Callers must hold c.mu for writing.
+func (c *Collection) insertLocked(id string, data map[string]interface{}, principal string) error {
+	return c.insertExpiringLocked(id, data, principal, nil)
+}
+
+// insertExpiringLocked inserts a document that expires at expiresAt, or
+// never when it is nil. The expiry is set before the insert is recorded and
+// published. Callers must hold c.mu for writing.
+func (c *Collection) insertExpiringLocked(id string, data map[string]interface{}, principal string, expiresAt *time.Time) error {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data = withoutDocumentID(data)
+	id = c.normalizeID(id)
+	if existing, exists := c.Documents[id]; exists {
+		if !existing.expired(time.Now()) {
+			return fmt.Errorf("%w: '%s'", ErrDocumentExists, id)
+		}
+		c.removeLocked(existing)
+	}
+	if err := c.checkUniqueLocked(id, data); err != nil {
+		return err
+	}
+	if err := c.claimID(id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	doc := &Document{
+		ID:            id,
+		Data:          data,
+		Checksum:      checksumData(data),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		CreatedBy:     principal,
+		UpdatedBy:     principal,
+		SchemaVersion: c.schemaVersionLocked(),
+		Version:       1,
+		ExpiresAt:     expiresAt,
+	}
+	c.Documents[id] = doc
+	c.indexDocumentLocked(doc)
+
+	c.notify(ChangeInsert, id, data)
+	return nil
+}
+
+// DocumentInput is a document to be written as part of a batch
+type DocumentInput struct {
+	ID   string                 `json:"id"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// DocumentError associates a failed batch operation with its document ID
+type DocumentError struct {
+	ID  string
+	Err error
+}
+
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.ID, e.Err)
+}
+
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// InsertMany inserts a batch of documents under a single write lock. Failed
+// documents do not prevent the rest of the batch from being inserted; each
+// failure is reported as a *DocumentError.
+func (c *Collection) InsertMany(docs []DocumentInput) (int, []error) {
+	return c.InsertManyAs("", docs)
+}
+
+// InsertManyAs inserts a batch of documents, recording principal as their
+// creator
+func (c *Collection) InsertManyAs(principal string, docs []DocumentInput) (int, []error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inserted := 0
+	var errs []error
+
+	for _, doc := range docs {
+		if doc.ID == "" {
+			errs = append(errs, &DocumentError{ID: doc.ID, Err: fmt.Errorf("document ID is required")})
+			continue
+		}
+
+		if err := c.insertLocked(doc.ID, doc.Data, principal); err != nil {
+			errs = append(errs, &DocumentError{ID: doc.ID, Err: err})
+			continue
+		}
+		inserted++
+	}
+
+	return inserted, errs
+}
+
+// UpsertMany inserts or replaces a batch of documents keyed by ID under a
+// single write lock and reports how many were created and updated. The batch
+// is validated first and applied all-or-nothing: if any document would fail,
+// none are written and each failure is reported as a *DocumentError.
+func (c *Collection) UpsertMany(docs map[string]map[string]interface{}) (int, int, []error) {
+	return c.UpsertManyAs("", docs)
+}
+
+// UpsertManyAs applies a batch upsert, recording principal as the writer
+func (c *Collection) UpsertManyAs(principal string, docs map[string]map[string]interface{}) (int, int, []error) {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	claims, errs := c.checkUpsertLocked(ids, docs)
+	if len(errs) > 0 {
+		return 0, 0, errs
+	}
+	if c.db != nil {
+		if err := c.db.claimIDs(claims); err != nil {
+			return 0, 0, []error{err}
+		}
+	}
+
+	created, updated := 0, 0
+	now := time.Now()
+	for _, id := range ids {
+		normalized := c.normalizeID(id)
+		if doc, exists := c.Documents[normalized]; exists && !doc.expired(now) {
+			if err := c.updateLocked(normalized, docs[id], principal); err != nil {
+				errs = append(errs, &DocumentError{ID: id, Err: err})
+				continue
+			}
+			updated++
+			continue
+		}
+
+		if err := c.insertLocked(normalized, docs[id], principal); err != nil {
+			errs = append(errs, &DocumentError{ID: id, Err: err})
+			continue
+		}
+		created++
+	}
+
+	return created, updated, errs
+}
+
+// checkUpsertLocked verifies that every document of a batch upsert, applied
+// in ids order, would be written, and returns the IDs the collection would
+// claim by inserting. Like a transaction, it checks reserved fields, global
+// ID uniqueness and unique index values both against stored documents and
+// within the batch. Callers must hold c.mu for writing.
+func (c *Collection) checkUpsertLocked(ids []string, docs map[string]map[string]interface{}) (map[string]string, []error) {
+	type valueKey struct {
+		field string
+		key   interface{}
+	}
+	claims := make(map[string]string)
+	// Unique index values as they stand after the documents checked so
+	// far. An empty owner marks a released value.
+	owners := make(map[valueKey]string)
+	now := time.Now()
+
+	var errs []error
+	for _, id := range ids {
+		normalized := c.normalizeID(id)
+		if normalized == "" {
+			errs = append(errs, &DocumentError{ID: id, Err: fmt.Errorf("document ID is required")})
+			continue
+		}
+
+		doc, present := c.Documents[normalized]
+		present = present && !doc.expired(now)
+		if present {
+			if err := c.checkWritable(); err != nil {
+				errs = append(errs, &DocumentError{ID: id, Err: err})
+				continue
+			}
+		} else if c.db != nil {
+			c.db.ids.mu.Lock()
+			err := c.checkIDLocked(normalized)
+			c.db.ids.mu.Unlock()
+			if err != nil {
+				errs = append(errs, &DocumentError{ID: id, Err: err})
+				continue
+			}
+			claims[normalized] = c.Name
+		}
+
+		if !c.hasUniqueIndexLocked() {
+			continue
+		}
+		if present {
+			for field, value := range c.uniqueKeys(doc.Data) {
+				owners[valueKey{field, value}] = ""
+			}
+		}
+		for field, value := range c.uniqueKeys(docs[id]) {
+			vk := valueKey{field, value}
+			owner, tracked := owners[vk]
+			if !tracked {
+				owner = c.uniqueOwnerLocked(field, value, normalized)
+			}
+			if owner != "" && owner != normalized {
+				errs = append(errs, &DocumentError{ID: id, Err: uniqueViolation(field, value, owner)})
+				continue
+			}
+			owners[vk] = normalized
+		}
+	}
+
+	return claims, errs
+}
+
+// InsertAuto inserts a document under a newly generated UUIDv4 and returns
+// the generated ID
+func (c *Collection) InsertAuto(data map[string]interface{}) (string, error) {
+	return c.InsertAutoAs("", data)
+}
+
+// InsertAutoAs inserts a document under a generated ID, recording principal
+// as its creator
+func (c *Collection) InsertAutoAs(principal string, data map[string]interface{}) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := uuid.NewString()
+	for {
+		if _, exists := c.Documents[id]; !exists {
+			break
+		}
+		id = uuid.NewString()
+	}
+
+	if err := c.insertLocked(id, data, principal); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Get retrieves a copy of a document by ID
+func (c *Collection) Get(id string) (*Document, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	return c.readDocument(doc), nil
+}
+
+// Update updates a document
+func (c *Collection) Update(id string, data map[string]interface{}) error {
+	return c.UpdateAs("", id, data)
+}
+
+// UpdateAs updates a document, recording principal as its last writer
+func (c *Collection) UpdateAs(principal, id string, data map[string]interface{}) error {
+	return c.write(func() error {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+
+		return c.updateLocked(id, data, principal)
+	})
+}
+
+// updateLocked replaces a document's data on behalf of principal. Nil data
+// is stored as an empty map. Callers must hold c.mu for writing.
+func (c *Collection) updateLocked(id string, data map[string]interface{}, principal string) error {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data = withoutDocumentID(data)
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+	if err := c.checkUniqueLocked(id, data); err != nil {
+		return err
+	}
+
+	c.unindexDocumentLocked(doc)
+	doc.Data = data
+	doc.SchemaVersion = c.schemaVersionLocked()
+	doc.FieldTimes = nil
+	doc.Checksum = checksumData(data)
+	c.indexDocumentLocked(doc)
+	doc.UpdatedAt = time.Now()
+	doc.UpdatedBy = principal
+	doc.Version++
+
+	c.notify(ChangeUpdate, id, data)
+	return nil
+}
+
+// Upsert inserts a document when absent or replaces its data when present,
+// preserving CreatedAt. It reports whether the document was created.
+func (c *Collection) Upsert(id string, data map[string]interface{}) (bool, error) {
+	return c.UpsertAs("", id, data)
+}
+
+// UpsertAs inserts or updates a document, recording principal as its writer
+func (c *Collection) UpsertAs(principal, id string, data map[string]interface{}) (bool, error) {
+	var created bool
+	err := c.write(func() error {
+		id = c.normalizeID(id)
+		// An expired document is replaced by a fresh one without its expiry
+		if doc, exists := c.Documents[id]; !exists || doc.expired(time.Now()) {
+			created = true
+			return c.insertLocked(id, data, principal)
+		}
+
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+
+		return c.updateLocked(id, data, principal)
+	})
+
+	return created, err
+}
+
+// Merge applies a partial update to a document. Keys present in patch
+// overwrite existing keys, other keys are left intact, and nested maps are
+// merged recursively rather than replaced.
+func (c *Collection) Merge(id string, patch map[string]interface{}) error {
+	return c.MergeAs("", id, patch)
+}
+
+// MergeAs applies a partial update, recording principal as the document's
+// last writer
+func (c *Collection) MergeAs(principal, id string, patch map[string]interface{}) error {
+	return c.write(func() error {
+		return c.mergeLocked(id, patch, principal)
+	})
+}
+
+func (c *Collection) mergeLocked(id string, patch map[string]interface{}, principal string) error {
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+	patch = withoutDocumentID(patch)
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	if doc.Data == nil {
+		doc.Data = make(map[string]interface{})
+	}
+	c.unindexDocumentLocked(doc)
+	// Bring old data up to date before patching it with current-version fields
+	c.migrateLocked(doc)
+	if c.hasUniqueIndexLocked() {
+		merged := copyMap(doc.Data)
+		mergeMaps(merged, patch)
+		if err := c.checkUniqueLocked(id, merged); err != nil {
+			c.indexDocumentLocked(doc)
+			return err
+		}
+	}
+	mergeMaps(doc.Data, patch)
+	for field := range patch {
+		delete(doc.FieldTimes, field)
+	}
+	doc.Checksum = checksumData(doc.Data)
+	c.indexDocumentLocked(doc)
+	doc.UpdatedAt = time.Now()
+	doc.UpdatedBy = principal
+	doc.Version++
+
+	c.notify(ChangeUpdate, id, doc.Data)
+	return nil
+}
+
+// DeleteField removes a single field, which may be a dot-notation path, from
+// a document. An error wrapping ErrFieldNotFound is returned when the
+// document has no such field.
+func (c *Collection) DeleteField(id, field string) error {
+	return c.DeleteFieldAs("", id, field)
+}
+
+// DeleteFieldAs removes a field, recording principal as the document's last
+// writer
+func (c *Collection) DeleteFieldAs(principal, id, field string) error {
+	return c.write(func() error {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+
+		id = c.normalizeID(id)
+		doc, exists := c.Documents[id]
+		if !exists || doc.expired(time.Now()) {
+			return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+		}
+
+		c.migrateLocked(doc)
+		if _, exists := lookupPath(doc.Data, field); !exists {
+			return fmt.Errorf("%w: document '%s' has no field '%s'", ErrFieldNotFound, id, field)
+		}
+
+		c.unindexDocumentLocked(doc)
+		deletePath(doc.Data, field)
+		delete(doc.FieldTimes, field)
+		doc.Checksum = checksumData(doc.Data)
+		c.indexDocumentLocked(doc)
+		doc.UpdatedAt = time.Now()
+		doc.UpdatedBy = principal
+		doc.Version++
+
+		c.notify(ChangeUpdate, id, doc.Data)
+		return nil
+	})
+}
+
+// mergeMaps recursively merges src into dst
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+
+		// A nil nested map cannot be written to, so it is replaced instead
+		if srcIsMap && dstIsMap && dstMap != nil {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+
+		dst[key] = srcValue
+	}
+}
+
+// Delete deletes a document
+func (c *Collection) Delete(id string) error {
+	return c.write(func() error {
+		return c.deleteLocked(id)
+	})
+}
+
+func (c *Collection) deleteLocked(id string) error {
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	c.removeLocked(doc)
+	return nil
+}
+
+// removeLocked deletes a document and its index entries. Callers must hold
+// c.mu for writing.
+func (c *Collection) removeLocked(doc *Document) {
+	c.unindexLabelsLocked(doc)
+	c.unindexDocumentLocked(doc)
+	delete(c.Documents, doc.ID)
+	c.releaseID(doc.ID)
+
+	c.notify(ChangeDelete, doc.ID, nil)
+}
+
+// Truncate removes every document from the collection, keeping its
+// settings, migrations and index definitions. Subscribers receive a single
+// ChangeTruncate event rather than one delete per document.
+func (c *Collection) Truncate() error {
+	return c.write(func() error {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+
+		if c.db != nil {
+			c.db.releaseCollectionIDs(c.Name)
+		}
+		c.Documents = make(map[string]*Document)
+		c.labelIndex = make(map[string]map[string]struct{})
+		c.rebuildIndexes()
+
+		c.notify(ChangeTruncate, "", nil)
+		return nil
+	})
+}
+
+// List returns all documents in the collection ordered by creation time
+func (c *Collection) List() []*Document {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(c.Documents))
+	for _, doc := range c.Documents {
+		docs = append(docs, doc)
+	}
+
+	docs = liveDocuments(docs)
+	sortByCreation(docs)
+	return c.readDocuments(docs)
+}
+
+// Each calls fn for every document in the collection, in creation order,
+// until fn returns false. Documents are copied one at a time as they are
+// visited rather than all up front. The read lock is held throughout, so
+// writers wait until Each returns.
+func (c *Collection) Each(fn func(*Document) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(c.Documents))
+	for _, doc := range c.Documents {
+		docs = append(docs, doc)
+	}
+
+	docs = liveDocuments(docs)
+	sortByCreation(docs)
+	for _, doc := range docs {
+		if !fn(c.readDocument(doc)) {
+			return
+		}
+	}
+}
+
+// ListSorted returns all documents in the collection ordered by a field in
+// their data, which may be a dot-notation path. Numbers compare numerically
+// and strings lexically. Documents
+// missing the field always sort last, regardless of direction.
+func (c *Collection) ListSorted(field string, desc bool) []*Document {
+	docs := c.List()
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		vi, iok := lookupPath(docs[i].Data, field)
+		vj, jok := lookupPath(docs[j].Data, field)
+		if !iok || !jok {
+			return iok && !jok
+		}
+
+		cmp := compareValues(vi, vj)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	return docs
+}
+
+// Count returns how many documents the collection holds
+func (c *Collection) Count() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.Documents)
+}
+
+// sortByCreation orders documents by CreatedAt, breaking ties by ID so the
+// order is stable across calls.
+func sortByCreation(docs []*Document) {
+	sort.Slice(docs, func(i, j int) bool {
+		if !docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+			return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+		}
+		return docs[i].ID < docs[j].ID
+	})
+}
+
+// Query returns documents whose field equals value, using an index on the
+// field when one exists
+func (c *Collection) Query(field string, value interface{}) []*Document {
+	results, _ := c.QueryContext(context.Background(), field, value)
+	return results
+}
+
+// QueryContext is Query that stops scanning and returns the context's error
+// once ctx is done
+func (c *Collection) QueryContext(ctx context.Context, field string, value interface{}) ([]*Document, error) {
+	if err := checkQueryField(field); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	f := Filter{Field: field, Value: value}
+
+	if candidates, ok := c.indexedCandidates(f); ok {
+		return c.readDocuments(liveDocuments(candidates)), nil
+	}
+
+	var results []*Document
+	scanned := 0
+	for _, doc := range c.Documents {
+		if scanned%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scanned++
+
+		if f.matches(doc) {
+			results = append(results, doc)
+		}
+	}
+
+	return c.readDocuments(liveDocuments(results)), nil
+}
+
+// SaveToDisk saves the database to disk, including every collection with
+// its own save interval.
+//
+// Saves are written one at a time. A save that was waiting while another
+// took its snapshot returns without writing, since that snapshot already
+// holds every change made before it was requested; later changes are left to
+// later saves. With Options.SaveDebounce set, each save first waits out the
+// debounce window so that a burst of saves coalesces into a single write.
+func (db *Database) SaveToDisk() error {
+	requested := time.Now()
+	if db.saveDebounce > 0 {
+		time.Sleep(db.saveDebounce)
+	}
+
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+
+	if db.lastSnapshot.After(requested) {
+		return nil
+	}
+
+	snapshot := time.Now()
+	if _, err := db.saveLocked(true); err != nil {
+		return err
+	}
+	db.lastSnapshot = snapshot
+	return nil
+}
+
+// marshalSnapshot serializes a consistent snapshot of the whole database,
+// including collections saved to their own files
+func (db *Database) marshalSnapshot() ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Hold every collection's read lock so documents can't change while
+	// they are being serialized
+	for _, name := range db.collectionNamesLocked() {
+		collection := db.Collections[name]
+		collection.mu.RLock()
+		defer collection.mu.RUnlock()
+	}
+
+	return json.MarshalIndent(db, "", "  ")
+}
+
+// LoadFromDisk loads the database from disk
+func (db *Database) LoadFromDisk() error {
+	data, err := os.ReadFile(db.dataFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // File doesn't exist, start with empty database
+		}
+		return fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	collections, shards, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if err := db.loadShards(collections, shards); err != nil {
+		return err
+	}
+	repairSnapshot(collections)
+
+	// Snapshots written before collections recorded their creation time
+	// fall back to the data file's modification time
+	var modified time.Time
+	if info, err := os.Stat(db.dataFile); err == nil {
+		modified = info.ModTime()
+	}
+	backfillCreatedAt(collections, modified)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.installCollectionsLocked(collections)
+	return nil
+}
+
+// repairSnapshot fills in the parts of loaded collections that a hand-edited
+// or truncated data file may leave null, so later writes do not hit nil
+// maps: null collections become empty ones, null document maps and document
+// data become empty maps, and null documents are dropped.
+func repairSnapshot(collections map[string]*Collection) {
+	for name, collection := range collections {
+		if collection == nil {
+			collection = &Collection{}
+			collections[name] = collection
+		}
+		if collection.Name == "" {
+			collection.Name = name
+		}
+		if collection.Documents == nil {
+			collection.Documents = make(map[string]*Document)
+		}
+
+		for id, doc := range collection.Documents {
+			if doc == nil {
+				delete(collection.Documents, id)
+				continue
+			}
+			if doc.Data == nil {
+				// Keep a checksum of the null data valid for the empty map
+				if doc.Checksum == checksumData(nil) {
+					doc.Checksum = checksumData(map[string]interface{}{})
+				}
+				doc.Data = make(map[string]interface{})
+			}
+		}
+	}
+}
+
+// backfillCreatedAt sets a creation time on collections loaded without one:
+// the creation time of their oldest document, or fallback when they are
+// empty
+func backfillCreatedAt(collections map[string]*Collection, fallback time.Time) {
+	for _, collection := range collections {
+		if !collection.CreatedAt.IsZero() {
+			continue
+		}
+
+		var oldest time.Time
+		for _, doc := range collection.Documents {
+			if oldest.IsZero() || doc.CreatedAt.Before(oldest) {
+				oldest = doc.CreatedAt
+			}
+		}
+		if oldest.IsZero() {
+			oldest = fallback
+		}
+		collection.CreatedAt = oldest
+	}
+}
+
+// decodeSnapshot parses a snapshot written by SaveToDisk, returning its
+// collections and the names of those saved to their own files
+func decodeSnapshot(data []byte) (map[string]*Collection, []string, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress data file: %w", err)
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal database: %w", err)
+	}
+	if snapshot.Collections == nil {
+		snapshot.Collections = make(map[string]*Collection)
+	}
+
+	return snapshot.Collections, snapshot.Shards, nil
+}
+
+// decompress returns data ungzipped if it is gzip-compressed. Compressed
+// files are detected by the gzip magic number, so a database can switch
+// between compressed and plain files.
+func decompress(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(gz)
+}
+
+// installCollectionsLocked replaces the database's collections with loaded
+// ones. Callers must hold db.mu for writing.
+func (db *Database) installCollectionsLocked(collections map[string]*Collection) {
+	db.stopCoalescingLocked()
+	db.Collections = collections
+
+	// Initialize mutexes for collections (they don't serialize)
+	for _, collection := range db.Collections {
+		collection.mu = sync.RWMutex{}
+		collection.db = db
+		collection.rebuildLabelIndex()
+		collection.loadIndexesLocked()
+	}
+	db.rebuildIDIndexLocked()
+}
+
+// collectionNamesLocked returns the names of every collection in the order
+// their locks must be taken when holding several. Callers must hold db.mu.
+func (db *Database) collectionNamesLocked() []string {
+	names := make([]string, 0, len(db.Collections))
+	for name := range db.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DocumentCount returns the number of documents across all collections
+func (db *Database) DocumentCount() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	total := 0
+	for _, collection := range db.Collections {
+		collection.mu.RLock()
+		total += len(collection.Documents)
+		collection.mu.RUnlock()
+	}
+	return total
+}
+
+// Stats is a snapshot of database statistics
+type Stats struct {
+	Collections       int                          `json:"collections"`
+	TotalDocuments    int                          `json:"total_documents"`
+	CollectionStats   map[string]int               `json:"collection_stats"`
+	CollectionDetails map[string]CollectionDetails `json:"collection_details"`
+	SaveStatus
+}
+
+// Stats returns database statistics as a map, in the shape served by the
+// stats endpoint. StatsStruct returns the same statistics with typed fields.
+func (db *Database) Stats() map[string]interface{} {
+	stats := db.StatsStruct()
+	return map[string]interface{}{
+		"collections":               stats.Collections,
+		"total_documents":           stats.TotalDocuments,
+		"collection_stats":          stats.CollectionStats,
+		"collection_details":        stats.CollectionDetails,
+		"last_save_time":            stats.LastSaveTime,
+		"last_save_error":           stats.LastSaveError,
+		"save_errors":               stats.SaveErrors,
+		"consecutive_save_failures": stats.ConsecutiveFailures,
+	}
+}
+
+// StatsStruct returns database statistics
+func (db *Database) StatsStruct() Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stats := Stats{
+		Collections:       len(db.Collections),
+		CollectionStats:   make(map[string]int, len(db.Collections)),
+		CollectionDetails: make(map[string]CollectionDetails, len(db.Collections)),
+		SaveStatus:        db.SaveStatus(),
+	}
+
+	for name, collection := range db.Collections {
+		details := collection.details()
+		stats.CollectionStats[name] = details.Documents
+		stats.CollectionDetails[name] = details
+		stats.TotalDocuments += details.Documents
+	}
+
+	return stats
+}
+
+// CollectionDetails describes a collection's size and document ages
+type CollectionDetails struct {
+	Documents int       `json:"documents"`
+	CreatedAt time.Time `json:"created_at"`
+	// SizeBytes approximates the collection's size as the total length of
+	// its documents encoded as JSON
+	SizeBytes     int        `json:"size_bytes"`
+	OldestCreated *time.Time `json:"oldest_created_at,omitempty"`
+	NewestCreated *time.Time `json:"newest_created_at,omitempty"`
+	LastUpdated   *time.Time `json:"last_updated_at,omitempty"`
+}
+
+// details measures the collection's documents
+func (c *Collection) details() CollectionDetails {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	details := CollectionDetails{Documents: len(c.Documents), CreatedAt: c.CreatedAt}
+	for _, doc := range c.Documents {
+		if encoded, err := json.Marshal(doc); err == nil {
+			details.SizeBytes += len(encoded)
+		}
+
+		created, updated := doc.CreatedAt, doc.UpdatedAt
+		if details.OldestCreated == nil || created.Before(*details.OldestCreated) {
+			details.OldestCreated = &created
+		}
+		if details.NewestCreated == nil || created.After(*details.NewestCreated) {
+			details.NewestCreated = &created
+		}
+		if details.LastUpdated == nil || updated.After(*details.LastUpdated) {
+			details.LastUpdated = &updated
+		}
+	}
+
+	return details
+}
@@ -0,0 +1,1412 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDatabase_CreateCollection(t *testing.T) {
+	db := NewDatabase()
+
+	err := db.CreateCollection("test")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Test duplicate collection
+	err = db.CreateCollection("test")
+	if err == nil {
+		t.Fatal("Expected error for duplicate collection")
+	}
+}
+
+func TestDatabase_CollectionCreatedAt(t *testing.T) {
+	db := NewDatabaseWithPath(filepath.Join(t.TempDir(), "data.json"))
+	before := time.Now()
+	db.CreateCollection("users")
+
+	users, _ := db.GetCollection("users")
+	if users.CreatedAt.IsZero() || users.CreatedAt.Before(before) {
+		t.Fatalf("Expected a creation time after %v, got %v", before, users.CreatedAt)
+	}
+
+	// Legacy snapshots without creation times are backfilled on load, from
+	// the oldest document or else the data file's modification time
+	legacy := `{"collections": {
+		"users": {"name": "users", "documents": {"u1": {"id": "u1", "data": {}, "created_at": "2020-01-02T00:00:00Z", "updated_at": "2020-01-02T00:00:00Z"}}},
+		"empty": {"name": "empty", "documents": {}}
+	}}`
+	os.WriteFile(db.DataFile(), []byte(legacy), 0644)
+	modified := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(db.DataFile(), modified, modified)
+
+	if err := db.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	users, _ = db.GetCollection("users")
+	if want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC); !users.CreatedAt.Equal(want) {
+		t.Fatalf("Expected creation time %v from the oldest document, got %v", want, users.CreatedAt)
+	}
+	empty, _ := db.GetCollection("empty")
+	if !empty.CreatedAt.Equal(modified) {
+		t.Fatalf("Expected creation time %v from the file, got %v", modified, empty.CreatedAt)
+	}
+
+	if details := db.StatsStruct().CollectionDetails; !details["empty"].CreatedAt.Equal(modified) {
+		t.Fatalf("Expected stats to include the creation time, got %v", details["empty"].CreatedAt)
+	}
+}
+
+func TestDatabase_GetCollection(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+
+	collection, err := db.GetCollection("test")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if collection.Name != "test" {
+		t.Fatalf("Expected collection name 'test', got %s", collection.Name)
+	}
+
+	// Test non-existent collection
+	_, err = db.GetCollection("nonexistent")
+	if err == nil {
+		t.Fatal("Expected error for non-existent collection")
+	}
+}
+
+func TestCollection_Insert(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	data := map[string]interface{}{
+		"name": "John",
+		"age":  30,
+	}
+
+	err := collection.Insert("user1", data)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Test duplicate ID
+	err = collection.Insert("user1", data)
+	if err == nil {
+		t.Fatal("Expected error for duplicate ID")
+	}
+}
+
+func TestCollection_InsertAuto(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	id, err := collection.InsertAuto(map[string]interface{}{"name": "John"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(id) != 36 {
+		t.Fatalf("Expected a UUID, got %q", id)
+	}
+
+	doc, err := collection.Get(id)
+	if err != nil {
+		t.Fatalf("Expected generated document to exist, got %v", err)
+	}
+
+	if doc.CreatedAt.IsZero() || doc.UpdatedAt.IsZero() {
+		t.Fatal("Expected timestamps to be set")
+	}
+
+	other, _ := collection.InsertAuto(map[string]interface{}{"name": "Jane"})
+	if other == id {
+		t.Fatal("Expected distinct generated IDs")
+	}
+}
+
+func TestCollection_InsertMany(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	inserted, errs := collection.InsertMany([]DocumentInput{
+		{ID: "user1", Data: map[string]interface{}{"name": "Duplicate"}},
+		{ID: "user2", Data: map[string]interface{}{"name": "Jane"}},
+		{ID: "", Data: map[string]interface{}{"name": "Nobody"}},
+		{ID: "user3", Data: map[string]interface{}{"name": "Bob"}},
+	})
+
+	if inserted != 2 {
+		t.Fatalf("Expected 2 inserted documents, got %d", inserted)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %d", len(errs))
+	}
+
+	var docErr *DocumentError
+	if !errors.As(errs[0], &docErr) || docErr.ID != "user1" {
+		t.Fatalf("Expected error for user1, got %v", errs[0])
+	}
+
+	if docs := collection.List(); len(docs) != 3 {
+		t.Fatalf("Expected 3 documents, got %d", len(docs))
+	}
+}
+
+func TestCollection_Get(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	data := map[string]interface{}{
+		"name": "John",
+		"age":  30,
+	}
+
+	collection.Insert("user1", data)
+
+	doc, err := collection.Get("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if doc.ID != "user1" {
+		t.Fatalf("Expected ID 'user1', got %s", doc.ID)
+	}
+
+	if doc.Data["name"] != "John" {
+		t.Fatalf("Expected name 'John', got %v", doc.Data["name"])
+	}
+
+	// Test non-existent document
+	_, err = collection.Get("nonexistent")
+	if err == nil {
+		t.Fatal("Expected error for non-existent document")
+	}
+}
+
+func TestCollection_GetReturnsCopy(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{
+		"name":    "John",
+		"address": map[string]interface{}{"city": "New York"},
+		"tags":    []interface{}{"a", "b"},
+	})
+
+	doc, _ := collection.Get("user1")
+	doc.Data["name"] = "Mallory"
+	doc.Data["address"].(map[string]interface{})["city"] = "Nowhere"
+	doc.Data["tags"].([]interface{})[0] = "z"
+
+	for _, docs := range [][]*Document{collection.List(), collection.Query("name", "John")} {
+		if len(docs) > 0 {
+			docs[0].Data["name"] = "Mallory"
+		}
+	}
+
+	stored, _ := collection.Get("user1")
+	if stored.Data["name"] != "John" {
+		t.Fatalf("Expected stored name to be unchanged, got %v", stored.Data["name"])
+	}
+
+	if city := stored.Data["address"].(map[string]interface{})["city"]; city != "New York" {
+		t.Fatalf("Expected stored nested data to be unchanged, got %v", city)
+	}
+
+	if tag := stored.Data["tags"].([]interface{})[0]; tag != "a" {
+		t.Fatalf("Expected stored array to be unchanged, got %v", tag)
+	}
+}
+
+func TestCollection_Update(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	originalData := map[string]interface{}{
+		"name": "John",
+		"age":  30,
+	}
+
+	collection.Insert("user1", originalData)
+
+	updatedData := map[string]interface{}{
+		"name": "John Doe",
+		"age":  31,
+	}
+
+	err := collection.Update("user1", updatedData)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "John Doe" {
+		t.Fatalf("Expected updated name 'John Doe', got %v", doc.Data["name"])
+	}
+
+	// Test non-existent document
+	err = collection.Update("nonexistent", updatedData)
+	if err == nil {
+		t.Fatal("Expected error for non-existent document")
+	}
+}
+
+func TestCollection_Merge(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{
+		"name": "John",
+		"age":  30,
+		"address": map[string]interface{}{
+			"city": "New York",
+			"zip":  "10001",
+		},
+	})
+
+	before, _ := collection.Get("user1")
+	createdAt := before.CreatedAt
+
+	err := collection.Merge("user1", map[string]interface{}{
+		"age": 31,
+		"address": map[string]interface{}{
+			"city": "Boston",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "John" {
+		t.Fatalf("Expected name to be preserved, got %v", doc.Data["name"])
+	}
+
+	if doc.Data["age"] != 31 {
+		t.Fatalf("Expected age 31, got %v", doc.Data["age"])
+	}
+
+	address := doc.Data["address"].(map[string]interface{})
+	if address["city"] != "Boston" || address["zip"] != "10001" {
+		t.Fatalf("Expected nested address to be merged, got %v", address)
+	}
+
+	if !doc.CreatedAt.Equal(createdAt) {
+		t.Fatal("Expected CreatedAt to be preserved")
+	}
+
+	// Test non-existent document
+	err = collection.Merge("nonexistent", map[string]interface{}{"age": 1})
+	if err == nil {
+		t.Fatal("Expected error for non-existent document")
+	}
+
+	// Test append-only collection
+	collection.SetAppendOnly(true)
+	if err := collection.Merge("user1", map[string]interface{}{"age": 32}); err == nil {
+		t.Fatal("Expected error merging into append-only collection")
+	}
+}
+
+func TestCollection_Upsert(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	created, err := collection.Upsert("user1", map[string]interface{}{"name": "John"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !created {
+		t.Fatal("Expected upsert of a new ID to create the document")
+	}
+
+	before, _ := collection.Get("user1")
+	createdAt := before.CreatedAt
+
+	created, err = collection.Upsert("user1", map[string]interface{}{"name": "John Doe"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created {
+		t.Fatal("Expected upsert of an existing ID to update the document")
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "John Doe" {
+		t.Fatalf("Expected updated name 'John Doe', got %v", doc.Data["name"])
+	}
+	if !doc.CreatedAt.Equal(createdAt) {
+		t.Fatal("Expected CreatedAt to be preserved")
+	}
+}
+
+func TestCollection_AuditFields(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.InsertAs("alice", "user1", map[string]interface{}{"name": "John"})
+	collection.UpdateAs("bob", "user1", map[string]interface{}{"name": "Jane"})
+
+	doc, _ := collection.Get("user1")
+	if doc.CreatedBy != "alice" || doc.UpdatedBy != "bob" {
+		t.Fatalf("Expected created_by alice and updated_by bob, got %q and %q", doc.CreatedBy, doc.UpdatedBy)
+	}
+
+	collection.MergeAs("carol", "user1", map[string]interface{}{"age": 30})
+	doc, _ = collection.Get("user1")
+	if doc.CreatedBy != "alice" || doc.UpdatedBy != "carol" {
+		t.Fatalf("Expected created_by alice and updated_by carol, got %q and %q", doc.CreatedBy, doc.UpdatedBy)
+	}
+}
+
+func TestCollection_Delete(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	data := map[string]interface{}{
+		"name": "John",
+		"age":  30,
+	}
+
+	collection.Insert("user1", data)
+
+	err := collection.Delete("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Verify document is deleted
+	_, err = collection.Get("user1")
+	if err == nil {
+		t.Fatal("Expected error for deleted document")
+	}
+
+	// Test non-existent document
+	err = collection.Delete("nonexistent")
+	if err == nil {
+		t.Fatal("Expected error for non-existent document")
+	}
+}
+
+func TestCollection_Query(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	// Insert test data
+	collection.Insert("user1", map[string]interface{}{
+		"name": "John",
+		"age":  30,
+		"city": "New York",
+	})
+
+	collection.Insert("user2", map[string]interface{}{
+		"name": "Jane",
+		"age":  25,
+		"city": "New York",
+	})
+
+	collection.Insert("user3", map[string]interface{}{
+		"name": "Bob",
+		"age":  35,
+		"city": "San Francisco",
+	})
+
+	// Query by city
+	results := collection.Query("city", "New York")
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	// Query by age
+	results = collection.Query("age", 30)
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0].Data["name"] != "John" {
+		t.Fatalf("Expected name 'John', got %v", results[0].Data["name"])
+	}
+}
+
+func TestDatabase_Persistence(t *testing.T) {
+	// Use a temporary file for testing
+	tempFile := "test_rafdb_data.json"
+	defer os.Remove(tempFile)
+
+	// Create database and add data
+	db := NewDatabase()
+	db.dataFile = tempFile
+
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{
+		"name": "John",
+		"age":  30,
+	})
+
+	// Save to disk
+	err := db.SaveToDisk()
+	if err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	// Create new database and load from disk
+	db2 := NewDatabase()
+	db2.dataFile = tempFile
+
+	err = db2.LoadFromDisk()
+	if err != nil {
+		t.Fatalf("Expected no error loading from disk, got %v", err)
+	}
+
+	// Verify data was loaded
+	collection2, err := db2.GetCollection("users")
+	if err != nil {
+		t.Fatalf("Expected collection to exist after loading, got %v", err)
+	}
+
+	doc, err := collection2.Get("user1")
+	if err != nil {
+		t.Fatalf("Expected document to exist after loading, got %v", err)
+	}
+
+	if doc.Data["name"] != "John" {
+		t.Fatalf("Expected name 'John' after loading, got %v", doc.Data["name"])
+	}
+}
+
+func TestNewDatabaseWithPath(t *testing.T) {
+	tempFile := "test_custom_path.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	db.CreateCollection("users")
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	if _, err := os.Stat(tempFile); err != nil {
+		t.Fatalf("Expected data file at custom path, got %v", err)
+	}
+
+	if NewDatabase().DataFile() != DefaultDataFile {
+		t.Fatalf("Expected NewDatabase to use the default path")
+	}
+}
+
+func TestDatabase_Reset(t *testing.T) {
+	tempFile := "test_reset.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabaseWithPath(tempFile)
+	db.CreateCollection("users")
+	db.CreateCollection("products")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	db.SaveToDisk()
+
+	db.Reset()
+
+	if collections := db.ListCollections(); len(collections) != 0 {
+		t.Fatalf("Expected no collections after reset, got %v", collections)
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	db2 := NewDatabaseWithPath(tempFile)
+	db2.LoadFromDisk()
+	if collections := db2.ListCollections(); len(collections) != 0 {
+		t.Fatalf("Expected saved file to be empty after reset, got %v", collections)
+	}
+
+	if db.DataFile() != tempFile {
+		t.Fatal("Expected reset to preserve the data file configuration")
+	}
+}
+
+func TestDatabase_Stats(t *testing.T) {
+	db := NewDatabase()
+
+	// Create collections and add documents
+	db.CreateCollection("users")
+	db.CreateCollection("products")
+
+	users, _ := db.GetCollection("users")
+	products, _ := db.GetCollection("products")
+
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	users.Insert("user2", map[string]interface{}{"name": "Jane"})
+
+	products.Insert("prod1", map[string]interface{}{"name": "Laptop"})
+
+	stats := db.StatsStruct()
+
+	if stats.Collections != 2 {
+		t.Fatalf("Expected 2 collections, got %d", stats.Collections)
+	}
+
+	if stats.TotalDocuments != 3 {
+		t.Fatalf("Expected 3 total documents, got %d", stats.TotalDocuments)
+	}
+
+	if stats.CollectionStats["users"] != 2 {
+		t.Fatalf("Expected 2 users, got %d", stats.CollectionStats["users"])
+	}
+
+	if stats.CollectionStats["products"] != 1 {
+		t.Fatalf("Expected 1 product, got %d", stats.CollectionStats["products"])
+	}
+
+	if stats := db.Stats(); stats["total_documents"] != 3 {
+		t.Fatalf("Expected the stats map to report 3 total documents, got %v", stats["total_documents"])
+	}
+
+	details := stats.CollectionDetails
+	user1, _ := users.Get("user1")
+	user2, _ := users.Get("user2")
+	if d := details["users"]; d.Documents != 2 || d.SizeBytes <= details["products"].SizeBytes {
+		t.Fatalf("Expected users to be larger than products, got %+v and %+v", d, details["products"])
+	}
+	if d := details["users"]; !d.OldestCreated.Equal(user1.CreatedAt) || !d.NewestCreated.Equal(user2.CreatedAt) || !d.LastUpdated.Equal(user2.UpdatedAt) {
+		t.Fatalf("Expected document ages from user1 and user2, got %+v", d)
+	}
+
+	db.CreateCollection("empty")
+	if d := db.StatsStruct().CollectionDetails["empty"]; d.SizeBytes != 0 || d.OldestCreated != nil {
+		t.Fatalf("Expected no details for an empty collection, got %+v", d)
+	}
+}
+
+func TestCollection_AppendOnly(t *testing.T) {
+	tempFile := "test_append_only.json"
+	defer os.Remove(tempFile)
+
+	db := NewDatabase()
+	db.dataFile = tempFile
+	db.CreateCollection("events")
+	collection, _ := db.GetCollection("events")
+	collection.SetAppendOnly(true)
+
+	err := collection.Insert("evt1", map[string]interface{}{"type": "login"})
+	if err != nil {
+		t.Fatalf("Expected insert to succeed on append-only collection, got %v", err)
+	}
+
+	if err := collection.Update("evt1", map[string]interface{}{"type": "logout"}); err == nil {
+		t.Fatal("Expected error updating document in append-only collection")
+	}
+
+	if err := collection.Delete("evt1"); err == nil {
+		t.Fatal("Expected error deleting document in append-only collection")
+	}
+
+	doc, _ := collection.Get("evt1")
+	if doc.Data["type"] != "login" {
+		t.Fatalf("Expected document to be unchanged, got %v", doc.Data["type"])
+	}
+
+	// The setting should survive a save/load cycle
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	db2 := NewDatabase()
+	db2.dataFile = tempFile
+	if err := db2.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading from disk, got %v", err)
+	}
+
+	collection2, _ := db2.GetCollection("events")
+	if !collection2.IsAppendOnly() {
+		t.Fatal("Expected append-only setting to be persisted")
+	}
+}
+
+func TestCollection_TrimIDs(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert(" u2\t", map[string]interface{}{"name": "Jane"})
+
+	if err := collection.SetTrimIDs(true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := collection.Get("u2"); err != nil {
+		t.Fatalf("Expected existing ID to be re-keyed, got %v", err)
+	}
+
+	collection.Insert("u1", map[string]interface{}{"name": "John"})
+
+	doc, err := collection.Get("u1 ")
+	if err != nil {
+		t.Fatalf("Expected to find u1 with trailing whitespace, got %v", err)
+	}
+	if doc.ID != "u1" {
+		t.Fatalf("Expected ID 'u1', got %q", doc.ID)
+	}
+
+	if err := collection.Insert(" u1", map[string]interface{}{}); err == nil {
+		t.Fatal("Expected error inserting a whitespace variant of an existing ID")
+	}
+
+	if err := collection.Delete("u1\n"); err != nil {
+		t.Fatalf("Expected delete with whitespace to succeed, got %v", err)
+	}
+}
+
+func TestCollection_TrimIDsCollision(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("u1", map[string]interface{}{"name": "John"})
+	collection.Insert("u1 ", map[string]interface{}{"name": "Duplicate"})
+
+	if err := collection.SetTrimIDs(true); err == nil {
+		t.Fatal("Expected error enabling trimming with colliding IDs")
+	}
+
+	if _, err := collection.Get("u1 "); err != nil {
+		t.Fatalf("Expected documents to be untouched after failed enable, got %v", err)
+	}
+}
+
+func TestCollection_ListOrder(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	for _, id := range []string{"c", "a", "b", "d"} {
+		collection.Insert(id, map[string]interface{}{"name": id})
+	}
+
+	first := collection.List()
+	for i := 0; i < 10; i++ {
+		docs := collection.List()
+		for j := range docs {
+			if docs[j].ID != first[j].ID {
+				t.Fatalf("Expected stable ordering, got %s at %d, previously %s", docs[j].ID, j, first[j].ID)
+			}
+		}
+	}
+
+	for i := 1; i < len(first); i++ {
+		if first[i].CreatedAt.Before(first[i-1].CreatedAt) {
+			t.Fatalf("Expected documents ordered by creation time")
+		}
+	}
+}
+
+func TestCollection_Each(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	for _, id := range []string{"c", "a", "b"} {
+		collection.Insert(id, map[string]interface{}{"name": id})
+	}
+
+	var ids []string
+	collection.Each(func(doc *Document) bool {
+		ids = append(ids, doc.ID)
+		doc.Data["name"] = "changed"
+		return true
+	})
+	if strings.Join(ids, ",") != "c,a,b" {
+		t.Fatalf("Expected documents in creation order, got %v", ids)
+	}
+	if doc, _ := collection.Get("c"); doc.Data["name"] != "c" {
+		t.Fatalf("Expected Each to visit copies, got %v", doc.Data["name"])
+	}
+
+	visited := 0
+	collection.Each(func(doc *Document) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("Expected Each to stop after the first document, visited %d", visited)
+	}
+}
+
+func TestCollection_ListSorted(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane", "age": 25.5})
+	collection.Insert("user3", map[string]interface{}{"name": "Bob"})
+	collection.Insert("user4", map[string]interface{}{"name": "Alice", "age": 41})
+
+	expectOrder := func(docs []*Document, ids ...string) {
+		t.Helper()
+		if len(docs) != len(ids) {
+			t.Fatalf("Expected %d documents, got %d", len(ids), len(docs))
+		}
+		for i, id := range ids {
+			if docs[i].ID != id {
+				t.Fatalf("Expected %s at position %d, got %s", id, i, docs[i].ID)
+			}
+		}
+	}
+
+	expectOrder(collection.ListSorted("age", false), "user2", "user1", "user4", "user3")
+	expectOrder(collection.ListSorted("age", true), "user4", "user1", "user2", "user3")
+	expectOrder(collection.ListSorted("name", false), "user4", "user3", "user2", "user1")
+}
+
+func TestCollection_UpsertMany(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.CreateIndex("city")
+
+	collection.Insert("user1", map[string]interface{}{"city": "NYC"})
+	collection.Insert("user2", map[string]interface{}{"city": "NYC"})
+
+	created, updated, errs := collection.UpsertMany(map[string]map[string]interface{}{
+		"user1": {"city": "Boston"},
+		"user3": {"city": "Boston"},
+		"user4": {"city": "Chicago"},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	if created != 2 || updated != 1 {
+		t.Fatalf("Expected 2 created and 1 updated, got %d and %d", created, updated)
+	}
+
+	if results := collection.Query("city", "Boston"); len(results) != 2 {
+		t.Fatalf("Expected index to reflect 2 Boston documents, got %d", len(results))
+	}
+	if results := collection.Query("city", "NYC"); len(results) != 1 {
+		t.Fatalf("Expected index to reflect 1 NYC document, got %d", len(results))
+	}
+}
+
+func TestCollection_UpsertManyAllOrNothing(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.SetAppendOnly(true)
+
+	created, updated, errs := collection.UpsertMany(map[string]map[string]interface{}{
+		"user1": {"name": "Jane"},
+		"user2": {"name": "Bob"},
+	})
+	if len(errs) != 1 || created != 0 || updated != 0 {
+		t.Fatalf("Expected the batch to be rejected, got %d created, %d updated, %v", created, updated, errs)
+	}
+
+	if _, err := collection.Get("user2"); err == nil {
+		t.Fatal("Expected no documents written from a rejected batch")
+	}
+}
+
+func TestCollection_UpsertManyRejectsInvalidDocuments(t *testing.T) {
+	db := NewDatabase()
+	db.SetGlobalIDUniqueness(true)
+	db.CreateCollection("test")
+	db.CreateCollection("other")
+	collection, _ := db.GetCollection("test")
+	other, _ := db.GetCollection("other")
+	collection.CreateUniqueIndex("email")
+
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+	other.Insert("taken", map[string]interface{}{})
+
+	tests := []struct {
+		name string
+		docs map[string]map[string]interface{}
+		err  error
+	}{
+		{"unique value stored", map[string]map[string]interface{}{
+			"user2": {"email": "john@example.com"},
+			"user3": {"email": "bob@example.com"},
+		}, ErrUniqueViolation},
+		{"unique value within batch", map[string]map[string]interface{}{
+			"user2": {"email": "same@example.com"},
+			"user3": {"email": "same@example.com"},
+		}, ErrUniqueViolation},
+		{"global ID", map[string]map[string]interface{}{
+			"taken": {"email": "taken@example.com"},
+			"user3": {"email": "bob@example.com"},
+		}, ErrDuplicateID},
+	}
+
+	for _, tt := range tests {
+		created, updated, errs := collection.UpsertMany(tt.docs)
+		if len(errs) != 1 || !errors.Is(errs[0], tt.err) || created != 0 || updated != 0 {
+			t.Fatalf("%s: expected the batch to be rejected with %v, got %d created, %d updated, %v", tt.name, tt.err, created, updated, errs)
+		}
+		if collection.Count() != 1 {
+			t.Fatalf("%s: expected no documents written from a rejected batch, got %d", tt.name, collection.Count())
+		}
+	}
+
+	// Values released earlier in the batch may be taken by later documents
+	created, updated, errs := collection.UpsertMany(map[string]map[string]interface{}{
+		"user1": {"email": "john@new.example.com"},
+		"user2": {"email": "john@example.com"},
+	})
+	if len(errs) != 0 || created != 1 || updated != 1 {
+		t.Fatalf("Expected the batch to apply, got %d created, %d updated, %v", created, updated, errs)
+	}
+}
+
+func TestCollection_UpdateIfVersion(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	doc, _ := collection.Get("user1")
+	if doc.Version != 1 {
+		t.Fatalf("Expected new document at version 1, got %d", doc.Version)
+	}
+
+	if err := collection.UpdateIfVersion("user1", map[string]interface{}{"name": "Jane"}, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A second writer still holding version 1 must not clobber the update
+	err := collection.UpdateIfVersion("user1", map[string]interface{}{"name": "Bob"}, 1)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected version conflict, got %v", err)
+	}
+
+	collection.Merge("user1", map[string]interface{}{"age": 30})
+	doc, _ = collection.Get("user1")
+	if doc.Version != 3 || doc.Data["name"] != "Jane" {
+		t.Fatalf("Expected version 3 with Jane, got %d: %v", doc.Version, doc.Data)
+	}
+}
+
+func TestCollection_DeleteField(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{
+		"name":    "John",
+		"age":     30,
+		"address": map[string]interface{}{"city": "NYC", "zip": "10001"},
+	})
+	before, _ := collection.Get("user1")
+
+	if err := collection.DeleteField("user1", "age"); err != nil {
+		t.Fatalf("Expected no error deleting top-level field, got %v", err)
+	}
+	if err := collection.DeleteField("user1", "address.zip"); err != nil {
+		t.Fatalf("Expected no error deleting nested field, got %v", err)
+	}
+
+	doc, _ := collection.Get("user1")
+	if _, exists := doc.Data["age"]; exists {
+		t.Fatal("Expected age to be removed")
+	}
+	address := doc.Data["address"].(map[string]interface{})
+	if _, exists := address["zip"]; exists || address["city"] != "NYC" {
+		t.Fatalf("Expected only zip to be removed, got %v", address)
+	}
+	if doc.UpdatedAt.Before(before.UpdatedAt) {
+		t.Fatal("Expected UpdatedAt to be bumped")
+	}
+	if doc.Version != 3 || doc.Checksum == before.Checksum {
+		t.Fatalf("Expected version and checksum to change, got version %d", doc.Version)
+	}
+
+	if err := collection.DeleteField("user1", "age"); !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf("Expected ErrFieldNotFound for an absent field, got %v", err)
+	}
+	if err := collection.DeleteField("user1", "name.first"); !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf("Expected ErrFieldNotFound through a non-object, got %v", err)
+	}
+}
+
+func TestDatabase_CopyCollection(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John", "address": map[string]interface{}{"city": "Paris"}})
+	users.AddLabels("user1", "vip")
+	users.CreateIndex("name")
+	users.SetAppendOnly(true)
+
+	if err := db.CopyCollection("users", "users_copy"); err != nil {
+		t.Fatalf("Expected no error copying, got %v", err)
+	}
+	if err := db.CopyCollection("users", "users_copy"); err == nil {
+		t.Error("Expected error copying onto an existing collection")
+	}
+	if err := db.CopyCollection("missing", "other"); err == nil {
+		t.Error("Expected error copying a missing collection")
+	}
+
+	copied, _ := db.GetCollection("users_copy")
+	if !copied.IsAppendOnly() {
+		t.Error("Expected the copy to keep collection settings")
+	}
+	if docs := copied.FindByLabel("vip"); len(docs) != 1 {
+		t.Errorf("Expected copied label index, got %d documents", len(docs))
+	}
+	if results := copied.Query("name", "John"); len(results) != 1 {
+		t.Errorf("Expected copied index to find the document, got %d", len(results))
+	}
+
+	// Edits to the copy must not leak into the source
+	copied.SetAppendOnly(false)
+	copied.Merge("user1", map[string]interface{}{"name": "Changed"})
+	copied.Documents["user1"].Data["address"].(map[string]interface{})["city"] = "Berlin"
+
+	original, _ := users.Get("user1")
+	if original.Data["name"] != "John" || original.Data["address"].(map[string]interface{})["city"] != "Paris" {
+		t.Errorf("Expected source document to be unchanged, got %v", original.Data)
+	}
+}
+
+func TestDatabase_RenameCollection(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	db.CreateCollection("orders")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+
+	if err := db.RenameCollection("users", "orders"); err == nil {
+		t.Error("Expected error renaming onto an existing collection")
+	}
+	if err := db.RenameCollection("missing", "other"); err == nil {
+		t.Error("Expected error renaming a missing collection")
+	}
+
+	if err := db.RenameCollection("users", "people"); err != nil {
+		t.Fatalf("Expected no error renaming, got %v", err)
+	}
+	if _, err := db.GetCollection("users"); err == nil {
+		t.Error("Expected the old name to be gone")
+	}
+
+	people, err := db.GetCollection("people")
+	if err != nil || people.Name != "people" {
+		t.Fatalf("Expected renamed collection, got %v", err)
+	}
+	if _, err := people.Get("user1"); err != nil {
+		t.Errorf("Expected documents to move with the collection, got %v", err)
+	}
+}
+
+func TestCollection_Truncate(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.CreateIndex("city")
+
+	collection.Insert("user1", map[string]interface{}{"city": "Paris"})
+	collection.Insert("user2", map[string]interface{}{"city": "Paris"})
+	collection.AddLabels("user1", "vip")
+
+	events, unsubscribe, _ := db.Subscribe("test", 4)
+	defer unsubscribe()
+
+	if err := collection.Truncate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(collection.List()) != 0 {
+		t.Fatalf("Expected empty collection, got %d documents", len(collection.List()))
+	}
+	if event := <-events; event.Type != ChangeTruncate {
+		t.Fatalf("Expected a truncate event, got %s", event.Type)
+	}
+
+	// Indexes and labels are emptied but the index definition is kept
+	results, _ := collection.QueryFilter(Filter{Field: "city", Value: "Paris"})
+	if len(results) != 0 {
+		t.Fatalf("Expected no indexed results, got %d", len(results))
+	}
+	if len(collection.FindByLabel("vip")) != 0 {
+		t.Fatal("Expected label index to be cleared")
+	}
+
+	collection.Insert("user1", map[string]interface{}{"city": "Paris"})
+	results, _ = collection.QueryFilter(Filter{Field: "city", Value: "Paris"})
+	if len(results) != 1 {
+		t.Fatalf("Expected index to keep working, got %d results", len(results))
+	}
+
+	collection.SetAppendOnly(true)
+	if err := collection.Truncate(); err == nil {
+		t.Fatal("Expected error truncating an append-only collection")
+	}
+}
+
+func TestDatabase_CreateCollectionValidatesName(t *testing.T) {
+	db := NewDatabase()
+
+	invalid := []string{
+		"",
+		"   ",
+		"a/b",
+		"a\\b",
+		"..",
+		"a..b",
+		".hidden",
+		"tab\tname",
+		"bell\x07",
+		strings.Repeat("a", MaxCollectionNameLength+1),
+	}
+	for _, name := range invalid {
+		if err := db.CreateCollection(name); err == nil {
+			t.Errorf("Expected error creating collection %q", name)
+		}
+	}
+	if len(db.ListCollections()) != 0 {
+		t.Fatalf("Expected no collections to be created, got %v", db.ListCollections())
+	}
+
+	valid := []string{"users", "user-events_2024", "a.b", "café", strings.Repeat("a", MaxCollectionNameLength)}
+	for _, name := range valid {
+		if err := db.CreateCollection(name); err != nil {
+			t.Errorf("Expected collection %q to be created, got %v", name, err)
+		}
+	}
+
+	if err := db.RenameCollection("users", "../users"); err == nil {
+		t.Fatal("Expected error renaming to an invalid name")
+	}
+}
+
+func TestDatabase_SentinelErrors(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+
+	if _, err := db.GetCollection("missing"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if err := db.CreateCollection("users"); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+	if _, err := collection.Get("missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound from Get, got %v", err)
+	}
+	if err := collection.Delete("missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound from Delete, got %v", err)
+	}
+	if err := collection.Insert("user1", map[string]interface{}{}); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("Expected ErrDocumentExists, got %v", err)
+	}
+
+	tx := db.Begin()
+	tx.Update("users", "missing", map[string]interface{}{})
+	if err := tx.Commit(); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound from a transaction, got %v", err)
+	}
+}
+
+func TestDatabase_ListCollectionInfo(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	db.CreateCollection("orders")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	users.SetMetadata(map[string]interface{}{"owner": "growth"})
+
+	infos := db.ListCollectionInfo()
+	if len(infos) != 2 || infos[0].Name != "orders" || infos[1].Name != "users" {
+		t.Fatalf("Expected orders and users in name order, got %+v", infos)
+	}
+	if infos[1].Count != 1 || infos[1].Metadata["owner"] != "growth" {
+		t.Fatalf("Expected users to have 1 document and its metadata, got %+v", infos[1])
+	}
+	if infos[1].CreatedAt.IsZero() {
+		t.Fatal("Expected a creation time")
+	}
+}
+
+func TestCollection_InsertNilData(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.CreateIndex("name")
+
+	if err := collection.Insert("doc1", nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	doc, _ := collection.Get("doc1")
+	if doc.Data == nil || len(doc.Data) != 0 {
+		t.Fatalf("Expected nil data to be stored as an empty map, got %#v", doc.Data)
+	}
+
+	if results := collection.Query("name", "John"); len(results) != 0 {
+		t.Fatalf("Expected no results, got %d", len(results))
+	}
+	if results, err := collection.QueryFilter(Filter{Field: "profile.name", Op: OpExists}); err != nil || len(results) != 0 {
+		t.Fatalf("Expected no results, got %v, %v", results, err)
+	}
+
+	if err := collection.Merge("doc1", map[string]interface{}{"name": "John"}); err != nil {
+		t.Fatalf("Expected no error merging, got %v", err)
+	}
+	if results := collection.Query("name", "John"); len(results) != 1 {
+		t.Fatalf("Expected the merged document to be indexed, got %d", len(results))
+	}
+
+	// Nested nil maps are replaced rather than written into
+	collection.Update("doc1", map[string]interface{}{"profile": map[string]interface{}(nil)})
+	if err := collection.Merge("doc1", map[string]interface{}{"profile": map[string]interface{}{"city": "Boston"}}); err != nil {
+		t.Fatalf("Expected no error merging into a nil map, got %v", err)
+	}
+	doc, _ = collection.Get("doc1")
+	if city, _ := lookupPath(doc.Data, "profile.city"); city != "Boston" {
+		t.Fatalf("Expected profile.city to be Boston, got %v", city)
+	}
+
+	if err := collection.Update("doc1", nil); err != nil {
+		t.Fatalf("Expected no error updating with nil data, got %v", err)
+	}
+	if doc, _ := collection.Get("doc1"); doc.Data == nil {
+		t.Fatal("Expected nil update data to be stored as an empty map")
+	}
+}
+
+func TestDatabase_StatsDuringCollectionChurn(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("a")
+	db.CreateCollection("b")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				fn(i)
+			}
+		}()
+	}
+
+	run(func(i int) {
+		name := "churn" + strconv.Itoa(i%4)
+		db.CreateCollection(name)
+		if c, err := db.GetCollection(name); err == nil {
+			c.Insert(strconv.Itoa(i), map[string]interface{}{"n": i})
+		}
+		db.DeleteCollection(name)
+	})
+	run(func(int) {
+		stats := db.StatsStruct()
+		if len(stats.CollectionStats) != len(stats.CollectionDetails) {
+			t.Errorf("Expected consistent stats, got %d counts and %d details", len(stats.CollectionStats), len(stats.CollectionDetails))
+		}
+		db.Stats()
+		db.ListCollectionInfo()
+	})
+	// Transactions lock several collections while snapshots read them all
+	run(func(i int) {
+		tx := db.Begin()
+		tx.Insert("b", strconv.Itoa(i), map[string]interface{}{"n": i})
+		tx.Insert("a", strconv.Itoa(i), map[string]interface{}{"n": i})
+		tx.Commit()
+	})
+	run(func(int) {
+		db.Backup(io.Discard)
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected concurrent stats, churn, transactions and backups to finish, possible deadlock")
+	}
+}
+
+func TestDatabase_LoadNullMaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	snapshot := `{"collections": {
+		"users": {"name": "users", "documents": null},
+		"orders": null,
+		"products": {"name": "products", "documents": {
+			"p1": {"id": "p1", "data": null, "version": 1},
+			"p2": null
+		}}
+	}}`
+	if err := os.WriteFile(path, []byte(snapshot), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	db := NewDatabaseWithPath(path)
+	if err := db.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	if db.DataFile() != path {
+		t.Fatalf("Expected the data file to stay %s, got %s", path, db.DataFile())
+	}
+
+	for _, name := range []string{"users", "orders"} {
+		collection, err := db.GetCollection(name)
+		if err != nil {
+			t.Fatalf("Expected collection '%s' to load, got %v", name, err)
+		}
+		if err := collection.Insert("doc1", map[string]interface{}{"name": "John"}); err != nil {
+			t.Fatalf("Expected insert into '%s' to succeed, got %v", name, err)
+		}
+	}
+
+	products, _ := db.GetCollection("products")
+	if ids := products.List(); len(ids) != 1 || ids[0].ID != "p1" {
+		t.Fatalf("Expected only p1 to load, got %v", ids)
+	}
+	if err := products.Merge("p1", map[string]interface{}{"price": 10}); err != nil {
+		t.Fatalf("Expected merge into null data to succeed, got %v", err)
+	}
+	if stats := db.StatsStruct(); stats.TotalDocuments != 3 {
+		t.Fatalf("Expected 3 documents, got %d", stats.TotalDocuments)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("concurrent")
+	collection, _ := db.GetCollection("concurrent")
+
+	// Test concurrent writes
+	done := make(chan error)
+
+	for i := 0; i < 10; i++ {
+		go func(id int) {
+			data := map[string]interface{}{
+				"id":    id,
+				"value": id * 10,
+			}
+			done <- collection.Insert("user"+strconv.Itoa(id), data)
+		}(i)
+	}
+
+	// Wait for all goroutines to complete
+	for i := 0; i < 10; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Expected concurrent insert to succeed, got %v", err)
+		}
+	}
+
+	// Verify all documents were inserted
+	docs := collection.List()
+	if len(docs) != 10 {
+		t.Fatalf("Expected 10 documents, got %d", len(docs))
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	db := NewDatabase()
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+
+	data := map[string]interface{}{
+		"name":  "Test User",
+		"email": "test@example.com",
+		"age":   25,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := collection.Insert(strconv.Itoa(i), data); err != nil {
+			b.Fatalf("Insert %d failed: %v", i, err)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	db := NewDatabase()
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+
+	// Pre-populate with data
+	data := map[string]interface{}{
+		"name":  "Test User",
+		"email": "test@example.com",
+		"age":   25,
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := collection.Insert(strconv.Itoa(i), data); err != nil {
+			b.Fatalf("Insert %d failed: %v", i, err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := collection.Get(strconv.Itoa(i % 1000)); err != nil {
+			b.Fatalf("Get %d failed: %v", i%1000, err)
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	db := NewDatabase()
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+
+	// Pre-populate with data
+	cities := []string{"New York", "San Francisco", "Chicago", "Boston", "Seattle"}
+
+	for i := 0; i < 1000; i++ {
+		data := map[string]interface{}{
+			"name": "User " + strconv.Itoa(i),
+			"age":  20 + (i % 50),
+			"city": cities[i%len(cities)],
+		}
+		if err := collection.Insert(strconv.Itoa(i), data); err != nil {
+			b.Fatalf("Insert %d failed: %v", i, err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collection.Query("city", cities[i%len(cities)])
+	}
+}
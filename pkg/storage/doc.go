@@ -0,0 +1,26 @@
+// Package storage is RAFDB's thread-safe, in-memory document store with
+// JSON persistence. The HTTP server is built on it, and it can be embedded
+// directly in another program:
+//
+//	db := storage.NewDatabaseWithPath("app.json")
+//	if err := db.LoadFromDisk(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	if err := db.CreateCollection("users"); err != nil && !errors.Is(err, storage.ErrCollectionExists) {
+//		log.Fatal(err)
+//	}
+//	users, _ := db.GetCollection("users")
+//	users.Insert("user1", map[string]interface{}{"name": "John", "role": "admin"})
+//
+//	for _, doc := range users.Query("role", "admin") {
+//		fmt.Println(doc.ID, doc.Data["name"])
+//	}
+//
+//	if err := db.SaveToDisk(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Every exported method is safe for concurrent use. Errors for missing or
+// existing collections and documents wrap the Err* sentinels defined here.
+package storage
@@ -0,0 +1,36 @@
+package storage_test
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"rafdb/pkg/storage"
+)
+
+func Example() {
+	dir, err := os.MkdirTemp("", "rafdb-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := storage.NewDatabaseWithPath(filepath.Join(dir, "app.json"))
+	if err := db.CreateCollection("users"); err != nil {
+		log.Fatal(err)
+	}
+
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John", "role": "admin"})
+	users.Insert("user2", map[string]interface{}{"name": "Jane", "role": "member"})
+
+	for _, doc := range users.Query("role", "admin") {
+		fmt.Println(doc.ID, doc.Data["name"])
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		log.Fatal(err)
+	}
+	// Output: user1 John
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// DocumentExportFormat is the version of the single-document export format
+const DocumentExportFormat = 1
+
+// DocumentExport is a self-contained, portable copy of one document with
+// all of its metadata, suitable for recreating it in any collection
+type DocumentExport struct {
+	Format     int       `json:"format"`
+	Collection string    `json:"collection"`
+	ExportedAt time.Time `json:"exported_at"`
+	Document   *Document `json:"document"`
+}
+
+// ExportDocument returns a portable copy of a document as stored
+func (c *Collection) ExportDocument(id string) (*DocumentExport, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	return &DocumentExport{
+		Format:     DocumentExportFormat,
+		Collection: c.Name,
+		ExportedAt: time.Now(),
+		Document:   doc.Clone(),
+	}, nil
+}
+
+// ImportDocument recreates an exported document in this collection,
+// preserving its labels, timestamps, writers, expiry and versions. The
+// document must not already exist, and its data must still match the
+// exported checksum.
+func (c *Collection) ImportDocument(export *DocumentExport) error {
+	if export == nil || export.Document == nil {
+		return fmt.Errorf("export does not contain a document")
+	}
+	if export.Format != DocumentExportFormat {
+		return fmt.Errorf("unsupported document export format %d", export.Format)
+	}
+
+	doc := export.Document.Clone()
+	if doc.Checksum != "" && checksumData(doc.Data) != doc.Checksum {
+		return fmt.Errorf("document '%s' does not match its checksum", doc.ID)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	doc.ID = c.normalizeID(doc.ID)
+	if doc.ID == "" {
+		return fmt.Errorf("document ID is required")
+	}
+	if existing, exists := c.Documents[doc.ID]; exists {
+		if !existing.expired(time.Now()) {
+			return fmt.Errorf("%w: '%s'", ErrDocumentExists, doc.ID)
+		}
+		c.removeLocked(existing)
+	}
+	if _, exists := doc.Data[documentIDField]; exists {
+		doc.Data = withoutDocumentID(doc.Data)
+		doc.Checksum = ""
+	}
+	if err := c.checkUniqueLocked(doc.ID, doc.Data); err != nil {
+		return err
+	}
+	if err := c.claimID(doc.ID); err != nil {
+		return err
+	}
+
+	if doc.Checksum == "" {
+		doc.Checksum = checksumData(doc.Data)
+	}
+
+	c.Documents[doc.ID] = doc
+	c.indexDocumentLocked(doc)
+	for _, label := range doc.Labels {
+		c.indexLabel(label, doc.ID)
+	}
+
+	c.notify(ChangeInsert, doc.ID, doc.Data)
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollection_ExportImportDocument(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	db.CreateCollection("archive")
+	users, _ := db.GetCollection("users")
+	archive, _ := db.GetCollection("archive")
+	archive.CreateIndex("city")
+
+	users.InsertWithTTLAs("alice", "user1", map[string]interface{}{"name": "John", "city": "NYC"}, time.Hour)
+	users.AddLabels("user1", "vip")
+	users.Merge("user1", map[string]interface{}{"age": 30})
+
+	export, err := users.ExportDocument("user1")
+	if err != nil {
+		t.Fatalf("Expected no error exporting, got %v", err)
+	}
+
+	// Round-trip through JSON as a file would
+	encoded, _ := json.Marshal(export)
+	var decoded DocumentExport
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Expected export to decode, got %v", err)
+	}
+
+	if err := archive.ImportDocument(&decoded); err != nil {
+		t.Fatalf("Expected no error importing, got %v", err)
+	}
+
+	original, _ := users.Get("user1")
+	imported, _ := archive.Get("user1")
+
+	if imported.Version != original.Version || imported.CreatedBy != "alice" || !imported.CreatedAt.Equal(original.CreatedAt) {
+		t.Fatalf("Expected metadata to be preserved, got %+v", imported)
+	}
+	if imported.ExpiresAt == nil || !imported.ExpiresAt.Equal(*original.ExpiresAt) {
+		t.Fatalf("Expected expiry to be preserved, got %v", imported.ExpiresAt)
+	}
+	if !reflect.DeepEqual(imported.Labels, original.Labels) || imported.Checksum != original.Checksum {
+		t.Fatalf("Expected labels and checksum to be preserved, got %v %s", imported.Labels, imported.Checksum)
+	}
+	if imported.Data["name"] != "John" || len(archive.FindByLabel("vip")) != 1 || len(archive.Query("city", "NYC")) != 1 {
+		t.Fatalf("Expected imported document to be indexed, got %v", imported.Data)
+	}
+
+	if err := archive.ImportDocument(&decoded); err == nil {
+		t.Fatal("Expected error importing an existing document")
+	}
+
+	decoded.Document.ID = "tampered"
+	decoded.Document.Data["name"] = "Mallory"
+	if err := archive.ImportDocument(&decoded); err == nil {
+		t.Fatal("Expected error importing data that does not match its checksum")
+	}
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultCheckpointEvery is how many records are processed between
+// checkpoint writes when ImportOptions.CheckpointEvery is unset
+const defaultCheckpointEvery = 1000
+
+// ImportOptions configures a bulk import from a newline-delimited JSON file
+type ImportOptions struct {
+	// Resume continues from the last checkpoint instead of starting over
+	Resume bool
+	// CheckpointEvery is the number of records between checkpoint writes
+	CheckpointEvery int
+}
+
+// ImportResult reports the outcome of a bulk import
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Line     int `json:"line"`
+}
+
+// importCheckpoint records how far an import has progressed through its
+// source file
+type importCheckpoint struct {
+	Line   int   `json:"line"`
+	Offset int64 `json:"offset"`
+}
+
+// importRecord is a single line of an import file
+type importRecord struct {
+	ID   string                 `json:"id"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// CheckpointPath returns the sidecar file used to track import progress
+func CheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// ImportFile imports documents from a newline-delimited JSON file where each
+// line is {"id": "...", "data": {...}}. Progress is periodically recorded to
+// a sidecar checkpoint file so that an interrupted import can be resumed with
+// opts.Resume. Inserts are idempotent by ID: records whose ID already exists
+// in the collection are skipped rather than failing the import. The
+// checkpoint file is removed once the import completes.
+func (c *Collection) ImportFile(path string, opts ImportOptions) (ImportResult, error) {
+	return c.ImportFileContext(context.Background(), path, opts)
+}
+
+// ImportFileContext is ImportFile that stops once ctx is done, saving a
+// checkpoint so the import can be resumed, and returns the context's error
+func (c *Collection) ImportFileContext(ctx context.Context, path string, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+
+	every := opts.CheckpointEvery
+	if every <= 0 {
+		every = defaultCheckpointEvery
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	checkpointFile := CheckpointPath(path)
+	var cp importCheckpoint
+
+	if opts.Resume {
+		data, err := os.ReadFile(checkpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &cp); err != nil {
+				return result, fmt.Errorf("failed to parse checkpoint: %w", err)
+			}
+			if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+				return result, fmt.Errorf("failed to seek to checkpoint: %w", err)
+			}
+		}
+	}
+
+	saveCheckpoint := func() error {
+		data, err := json.Marshal(cp)
+		if err != nil {
+			return fmt.Errorf("failed to marshal checkpoint: %w", err)
+		}
+		if err := os.WriteFile(checkpointFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to write checkpoint: %w", err)
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(file)
+	sinceCheckpoint := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			saveCheckpoint()
+			return result, err
+		}
+
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			saveCheckpoint()
+			return result, fmt.Errorf("failed to read import file: %w", readErr)
+		}
+
+		if len(line) > 0 {
+			lineNum := cp.Line + 1
+
+			if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+				var rec importRecord
+				if err := json.Unmarshal(trimmed, &rec); err != nil {
+					saveCheckpoint()
+					return result, fmt.Errorf("line %d: invalid JSON: %w", lineNum, err)
+				}
+				if rec.ID == "" {
+					saveCheckpoint()
+					return result, fmt.Errorf("line %d: document ID is required", lineNum)
+				}
+
+				c.mu.Lock()
+				if _, exists := c.Documents[c.normalizeID(rec.ID)]; exists {
+					result.Skipped++
+				} else if err := c.insertLocked(rec.ID, rec.Data, ""); err != nil {
+					c.mu.Unlock()
+					saveCheckpoint()
+					return result, fmt.Errorf("line %d: %w", lineNum, err)
+				} else {
+					result.Imported++
+				}
+				c.mu.Unlock()
+			}
+
+			cp.Line = lineNum
+			cp.Offset += int64(len(line))
+			result.Line = cp.Line
+
+			sinceCheckpoint++
+			if sinceCheckpoint >= every {
+				if err := saveCheckpoint(); err != nil {
+					return result, err
+				}
+				sinceCheckpoint = 0
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if err := os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+		return result, fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+
+	return result, nil
+}
+
+// RowError reports a row of an uploaded dataset that could not be imported
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportJSON imports documents from a JSON array. Each element is either
+// {"id": "...", "data": {...}} or a plain object whose optional "id" string
+// field becomes the document ID. Rows without an ID get a generated one. It
+// returns how many documents were imported; rows that fail are skipped and
+// reported as RowErrors joined into the returned error.
+func (c *Collection) ImportJSON(r io.Reader) (int, error) {
+	return c.ImportJSONAs("", r)
+}
+
+// ImportJSONAs is ImportJSON with the documents written by principal
+func (c *Collection) ImportJSONAs(principal string, r io.Reader) (int, error) {
+	return c.ImportJSONAsContext(context.Background(), principal, r)
+}
+
+// ImportJSONContext is ImportJSON that stops before the next row once ctx is
+// done, returning the context's error joined with any row errors
+func (c *Collection) ImportJSONContext(ctx context.Context, r io.Reader) (int, error) {
+	return c.ImportJSONAsContext(ctx, "", r)
+}
+
+// ImportJSONAsContext is ImportJSONContext with the documents written by
+// principal
+func (c *Collection) ImportJSONAsContext(ctx context.Context, principal string, r io.Reader) (int, error) {
+	var rows []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return 0, fmt.Errorf("invalid JSON array: %w", err)
+	}
+
+	imported := 0
+	var errs []error
+	for i, row := range rows {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		id, data := splitImportRow(row)
+		if err := c.importRow(principal, id, data); err != nil {
+			errs = append(errs, &RowError{Row: i + 1, Err: err})
+			continue
+		}
+		imported++
+	}
+
+	return imported, errors.Join(errs...)
+}
+
+// splitImportRow separates an uploaded JSON row into its ID and data
+func splitImportRow(row map[string]interface{}) (string, map[string]interface{}) {
+	if data, ok := row["data"].(map[string]interface{}); ok {
+		id, _ := row["id"].(string)
+		return id, data
+	}
+
+	id, ok := row["id"].(string)
+	if !ok {
+		return "", row
+	}
+	delete(row, "id")
+	return id, row
+}
+
+// importRow inserts one uploaded row, generating an ID when it has none
+func (c *Collection) importRow(principal, id string, data map[string]interface{}) error {
+	if data == nil {
+		return fmt.Errorf("document data is required")
+	}
+	if id == "" {
+		_, err := c.InsertAutoAs(principal, data)
+		return err
+	}
+	return c.InsertAs(principal, id, data)
+}
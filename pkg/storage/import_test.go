@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCollection_ImportFile(t *testing.T) {
+	importFile := "test_import.ndjson"
+	defer os.Remove(importFile)
+	defer os.Remove(CheckpointPath(importFile))
+
+	lines := []string{
+		`{"id": "user1", "data": {"name": "John"}}`,
+		`{"id": "user2", "data": {"name": "Jane"}}`,
+		`{"id": "user1", "data": {"name": "Duplicate"}}`,
+	}
+	os.WriteFile(importFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	result, err := collection.ImportFile(importFile, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.Imported != 2 || result.Skipped != 1 {
+		t.Fatalf("Expected 2 imported and 1 skipped, got %+v", result)
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "John" {
+		t.Fatalf("Expected existing document to be kept, got %v", doc.Data["name"])
+	}
+
+	if _, err := os.Stat(CheckpointPath(importFile)); !os.IsNotExist(err) {
+		t.Fatal("Expected checkpoint to be removed after a completed import")
+	}
+}
+
+func TestCollection_ImportFileResume(t *testing.T) {
+	importFile := "test_import_resume.ndjson"
+	defer os.Remove(importFile)
+	defer os.Remove(CheckpointPath(importFile))
+
+	good := []string{
+		`{"id": "doc1", "data": {"n": 1}}`,
+		`{"id": "doc2", "data": {"n": 2}}`,
+		`{"id": "doc3", "data": {"n": 3}}`,
+	}
+	rest := []string{
+		`{"id": "doc4", "data": {"n": 4}}`,
+		`{"id": "doc5", "data": {"n": 5}}`,
+	}
+
+	// A corrupt line interrupts the first attempt partway through
+	broken := append(append([]string{}, good...), `{"id": "doc4", "data":`)
+	os.WriteFile(importFile, []byte(strings.Join(broken, "\n")+"\n"), 0644)
+
+	db := NewDatabase()
+	db.CreateCollection("docs")
+	collection, _ := db.GetCollection("docs")
+
+	result, err := collection.ImportFile(importFile, ImportOptions{CheckpointEvery: 1})
+	if err == nil {
+		t.Fatal("Expected error for corrupt line")
+	}
+	if result.Imported != 3 {
+		t.Fatalf("Expected 3 documents imported before the failure, got %d", result.Imported)
+	}
+
+	// Repair the file and resume from the checkpoint
+	fixed := append(append([]string{}, good...), rest...)
+	os.WriteFile(importFile, []byte(strings.Join(fixed, "\n")+"\n"), 0644)
+
+	result, err = collection.ImportFile(importFile, ImportOptions{Resume: true, CheckpointEvery: 1})
+	if err != nil {
+		t.Fatalf("Expected no error on resume, got %v", err)
+	}
+
+	if result.Imported != 2 || result.Skipped != 0 {
+		t.Fatalf("Expected resume to import only the remaining 2 documents, got %+v", result)
+	}
+
+	if docs := collection.List(); len(docs) != 5 {
+		t.Fatalf("Expected 5 documents after resume, got %d", len(docs))
+	}
+}
+
+func TestCollection_ImportJSON(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.Insert("taken", map[string]interface{}{"name": "Existing"})
+
+	input := `[
+		{"id": "user1", "data": {"name": "John"}},
+		{"id": "user2", "name": "Jane", "age": 25},
+		{"name": "Anonymous"},
+		{"id": "taken", "name": "Duplicate"}
+	]`
+
+	imported, err := collection.ImportJSON(strings.NewReader(input))
+	if imported != 3 {
+		t.Errorf("Expected 3 documents imported, got %d", imported)
+	}
+
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 4 {
+		t.Fatalf("Expected an error for row 4, got %v", err)
+	}
+
+	user2, _ := collection.Get("user2")
+	if user2.Data["name"] != "Jane" || user2.Data["age"] != float64(25) {
+		t.Errorf("Expected plain object to become the data, got %v", user2.Data)
+	}
+	if _, hasID := user2.Data["id"]; hasID {
+		t.Error("Expected the id field to be removed from the data")
+	}
+	if len(collection.List()) != 4 {
+		t.Errorf("Expected 4 documents including a generated ID, got %d", len(collection.List()))
+	}
+
+	if _, err := collection.ImportJSON(strings.NewReader(`{"not": "an array"}`)); err == nil || errors.As(err, &rowErr) {
+		t.Errorf("Expected a whole-import error for invalid input, got %v", err)
+	}
+}
+
+func TestCollection_ImportContextCancelled(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	imported, err := collection.ImportJSONContext(ctx, strings.NewReader(`[{"id": "user1", "name": "John"}]`))
+	if !errors.Is(err, context.Canceled) || imported != 0 {
+		t.Fatalf("Expected cancelled JSON import of nothing, got %d, %v", imported, err)
+	}
+
+	imported, err = collection.ImportCSVContext(ctx, strings.NewReader("id,name\nuser1,John\n"))
+	if !errors.Is(err, context.Canceled) || imported != 0 {
+		t.Fatalf("Expected cancelled CSV import of nothing, got %d, %v", imported, err)
+	}
+
+	importFile := "test_import_cancel.ndjson"
+	defer os.Remove(importFile)
+	defer os.Remove(CheckpointPath(importFile))
+	os.WriteFile(importFile, []byte(`{"id": "user1", "data": {"name": "John"}}`+"\n"), 0644)
+
+	if _, err := collection.ImportFileContext(ctx, importFile, ImportOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected cancelled file import, got %v", err)
+	}
+	if _, err := os.Stat(CheckpointPath(importFile)); err != nil {
+		t.Fatalf("Expected a checkpoint to resume from, got %v", err)
+	}
+
+	if len(collection.List()) != 0 {
+		t.Fatal("Expected nothing to be imported")
+	}
+}
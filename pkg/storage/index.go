@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUniqueViolation is returned when a write would give two documents the
+// same value for a field with a unique index
+var ErrUniqueViolation = errors.New("unique constraint violated")
+
+// ErrIndexNotFound is returned when dropping an index that does not exist
+var ErrIndexNotFound = errors.New("index not found")
+
+// IndexDefinition is the persisted form of an index. Collections save only
+// which indexes exist; their contents are rebuilt from the documents on load.
+type IndexDefinition struct {
+	Field  string `json:"field"`
+	Unique bool   `json:"unique,omitempty"`
+}
+
+// IndexInfo describes an index on a collection
+type IndexInfo struct {
+	Field  string `json:"field"`
+	Unique bool   `json:"unique"`
+	// Cardinality is the number of distinct values indexed
+	Cardinality int `json:"cardinality"`
+}
+
+// index maps the values of a document field to the IDs of documents holding
+// that value, allowing equality queries without a full scan. A unique index
+// also rejects writes that would share a value between documents.
+type index struct {
+	field  string
+	unique bool
+	values map[interface{}][]string
+}
+
+// indexKey returns the key a field value is stored under. Numbers are
+// normalized to float64 so that int and float64 values index together.
+// Values that cannot be map keys, such as nested objects and arrays, are not
+// indexed.
+func indexKey(v interface{}) (interface{}, bool) {
+	if f, ok := toFloat64(v); ok {
+		return f, true
+	}
+
+	switch v.(type) {
+	case string, bool, nil:
+		return v, true
+	}
+
+	return nil, false
+}
+
+func (idx *index) add(doc *Document) {
+	value, exists := lookupPath(doc.Data, idx.field)
+	if !exists {
+		return
+	}
+
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+
+	idx.values[key] = append(idx.values[key], doc.ID)
+}
+
+func (idx *index) remove(doc *Document) {
+	value, exists := lookupPath(doc.Data, idx.field)
+	if !exists {
+		return
+	}
+
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+
+	ids := idx.values[key]
+	for i, id := range ids {
+		if id == doc.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+
+	if len(ids) == 0 {
+		delete(idx.values, key)
+	} else {
+		idx.values[key] = ids
+	}
+}
+
+// CreateIndex builds an index on a field. Equality queries on the field use
+// the index instead of scanning every document.
+func (c *Collection) CreateIndex(field string) error {
+	return c.createIndex(field, false)
+}
+
+// CreateUniqueIndex builds an index on a field that also requires every
+// document to hold a different value for it. Inserts and updates that would
+// duplicate a value fail with an error wrapping ErrUniqueViolation, as does
+// creating the index when existing documents already share a value.
+// Documents without the field, or with a nested object or array in it, are
+// not constrained.
+func (c *Collection) CreateUniqueIndex(field string) error {
+	return c.createIndex(field, true)
+}
+
+func (c *Collection) createIndex(field string, unique bool) error {
+	if field == "" {
+		return fmt.Errorf("index field is required")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.indexes[field]; exists {
+		return fmt.Errorf("index on '%s' already exists", field)
+	}
+
+	idx := &index{
+		field:  field,
+		unique: unique,
+		values: make(map[interface{}][]string),
+	}
+	for _, doc := range c.Documents {
+		idx.add(doc)
+	}
+	if unique {
+		if ids := c.duplicateIDsLocked(idx); len(ids) > 0 {
+			return fmt.Errorf("%w: field '%s' is shared by documents %s", ErrUniqueViolation, field, strings.Join(ids, ", "))
+		}
+	}
+
+	if c.indexes == nil {
+		c.indexes = make(map[string]*index)
+	}
+	c.indexes[field] = idx
+	c.syncIndexDefinitionsLocked()
+	c.markDirty()
+
+	return nil
+}
+
+// ListIndexes describes the collection's indexes, sorted by field
+func (c *Collection) ListIndexes() []IndexInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	infos := make([]IndexInfo, 0, len(c.indexes))
+	for field, idx := range c.indexes {
+		infos = append(infos, IndexInfo{
+			Field:       field,
+			Unique:      idx.unique,
+			Cardinality: len(idx.values),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Field < infos[j].Field
+	})
+	return infos
+}
+
+// DropIndex removes the index on a field. Queries on the field go back to
+// scanning every document, and a unique index stops constraining writes.
+func (c *Collection) DropIndex(field string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.indexes[field]; !exists {
+		return fmt.Errorf("%w: '%s'", ErrIndexNotFound, field)
+	}
+
+	delete(c.indexes, field)
+	c.syncIndexDefinitionsLocked()
+	c.markDirty()
+	return nil
+}
+
+// syncIndexDefinitionsLocked records the current indexes in
+// IndexDefinitions so they are saved with the collection. Callers must hold
+// c.mu for writing.
+func (c *Collection) syncIndexDefinitionsLocked() {
+	c.IndexDefinitions = nil
+	for field, idx := range c.indexes {
+		c.IndexDefinitions = append(c.IndexDefinitions, IndexDefinition{Field: field, Unique: idx.unique})
+	}
+	sort.Slice(c.IndexDefinitions, func(i, j int) bool {
+		return c.IndexDefinitions[i].Field < c.IndexDefinitions[j].Field
+	})
+}
+
+// loadIndexesLocked recreates the indexes listed in IndexDefinitions and
+// populates them from the documents, after the collection has been loaded
+// from a snapshot. Callers must hold c.mu for writing or own the collection
+// exclusively.
+func (c *Collection) loadIndexesLocked() {
+	c.indexes = make(map[string]*index, len(c.IndexDefinitions))
+	for _, def := range c.IndexDefinitions {
+		if def.Field == "" {
+			continue
+		}
+		c.indexes[def.Field] = &index{field: def.Field, unique: def.Unique}
+	}
+	c.rebuildIndexes()
+}
+
+// duplicateIDsLocked returns the sorted IDs of live documents that share a
+// value in idx with another live document. Callers must hold c.mu.
+func (c *Collection) duplicateIDsLocked(idx *index) []string {
+	now := time.Now()
+	var duplicates []string
+	for _, ids := range idx.values {
+		live := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if !c.Documents[id].expired(now) {
+				live = append(live, id)
+			}
+		}
+		if len(live) > 1 {
+			duplicates = append(duplicates, live...)
+		}
+	}
+
+	sort.Strings(duplicates)
+	return duplicates
+}
+
+// uniqueKeys returns the key data holds for each unique index, by field
+func (c *Collection) uniqueKeys(data map[string]interface{}) map[string]interface{} {
+	var keys map[string]interface{}
+	for field, idx := range c.indexes {
+		if !idx.unique {
+			continue
+		}
+		value, exists := lookupPath(data, field)
+		if !exists {
+			continue
+		}
+		key, ok := indexKey(value)
+		if !ok {
+			continue
+		}
+		if keys == nil {
+			keys = make(map[string]interface{})
+		}
+		keys[field] = key
+	}
+	return keys
+}
+
+// uniqueOwnerLocked returns the ID of a live document other than id that
+// holds key in the index on field, or "" if there is none. Callers must hold
+// c.mu.
+func (c *Collection) uniqueOwnerLocked(field string, key interface{}, id string) string {
+	now := time.Now()
+	for _, owner := range c.indexes[field].values[key] {
+		if owner != id && !c.Documents[owner].expired(now) {
+			return owner
+		}
+	}
+	return ""
+}
+
+// checkUniqueLocked verifies that storing data as document id would not
+// duplicate a value held by another document in a unique index. Callers must
+// hold c.mu.
+func (c *Collection) checkUniqueLocked(id string, data map[string]interface{}) error {
+	for field, key := range c.uniqueKeys(data) {
+		if owner := c.uniqueOwnerLocked(field, key, id); owner != "" {
+			return uniqueViolation(field, key, owner)
+		}
+	}
+	return nil
+}
+
+// hasUniqueIndexLocked reports whether any index on the collection is
+// unique. Callers must hold c.mu.
+func (c *Collection) hasUniqueIndexLocked() bool {
+	for _, idx := range c.indexes {
+		if idx.unique {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueViolation(field string, key interface{}, owner string) error {
+	return fmt.Errorf("%w: value %v for field '%s' is already used by document '%s'", ErrUniqueViolation, key, field, owner)
+}
+
+// indexDocumentLocked adds a document to every index. Callers must hold c.mu
+// for writing.
+func (c *Collection) indexDocumentLocked(doc *Document) {
+	for _, idx := range c.indexes {
+		idx.add(doc)
+	}
+}
+
+// unindexDocumentLocked removes a document from every index. Callers must
+// hold c.mu for writing.
+func (c *Collection) unindexDocumentLocked(doc *Document) {
+	for _, idx := range c.indexes {
+		idx.remove(doc)
+	}
+}
+
+// rebuildIndexes repopulates every index from the current documents
+func (c *Collection) rebuildIndexes() {
+	for _, idx := range c.indexes {
+		idx.values = make(map[interface{}][]string)
+		for _, doc := range c.Documents {
+			idx.add(doc)
+		}
+	}
+}
+
+// indexedCandidates returns the documents an equality filter can match
+// using an index, and false when no index applies. Indexes hold exact values,
+// so case-insensitive filters always scan. Callers must hold c.mu.
+func (c *Collection) indexedCandidates(f Filter) ([]*Document, bool) {
+	if (f.Op != "" && f.Op != OpEq) || f.CaseInsensitive {
+		return nil, false
+	}
+
+	idx, exists := c.indexes[f.Field]
+	if !exists {
+		return nil, false
+	}
+
+	key, ok := indexKey(f.Value)
+	if !ok {
+		return nil, false
+	}
+
+	ids := idx.values[key]
+	docs := make([]*Document, 0, len(ids))
+	for _, id := range ids {
+		docs = append(docs, c.Documents[id])
+	}
+
+	return docs, true
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCollection_CreateIndex(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "city": "New York", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane", "city": "New York", "age": 25})
+
+	if err := collection.CreateIndex("city"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := collection.CreateIndex("city"); err == nil {
+		t.Fatal("Expected error for duplicate index")
+	}
+
+	collection.Insert("user3", map[string]interface{}{"name": "Bob", "city": "Boston"})
+
+	if results := collection.Query("city", "New York"); len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	if results := collection.Query("city", "Boston"); len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	// Index follows updates, merges and deletes
+	collection.Update("user1", map[string]interface{}{"name": "John", "city": "Boston"})
+	collection.Merge("user2", map[string]interface{}{"city": "Chicago"})
+	collection.Delete("user3")
+
+	if results := collection.Query("city", "New York"); len(results) != 0 {
+		t.Fatalf("Expected 0 results, got %d", len(results))
+	}
+
+	results := collection.Query("city", "Boston")
+	if len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected only user1 in Boston, got %v", results)
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "city", Op: OpEq, Value: "Chicago"})
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected only user2 in Chicago, got %v", results)
+	}
+}
+
+func TestCollection_IndexNumericNormalization(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"age": 30})
+	collection.Insert("user2", map[string]interface{}{"age": float64(30)})
+	collection.CreateIndex("age")
+
+	if results := collection.Query("age", 30); len(results) != 2 {
+		t.Fatalf("Expected int and float64 values to match, got %d", len(results))
+	}
+}
+
+func TestCollection_CreateUniqueIndex(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+	collection.Insert("user2", map[string]interface{}{"email": "john@example.com"})
+	collection.Insert("user3", map[string]interface{}{"email": "jane@example.com"})
+
+	err := collection.CreateUniqueIndex("email")
+	if !errors.Is(err, ErrUniqueViolation) || !strings.Contains(err.Error(), "user1, user2") {
+		t.Fatalf("Expected a unique violation naming user1 and user2, got %v", err)
+	}
+
+	collection.Delete("user2")
+	if err := collection.CreateUniqueIndex("email"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := collection.Insert("user4", map[string]interface{}{"email": "jane@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected a unique violation on insert, got %v", err)
+	}
+	if err := collection.Update("user1", map[string]interface{}{"email": "jane@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected a unique violation on update, got %v", err)
+	}
+	if err := collection.Merge("user1", map[string]interface{}{"email": "jane@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected a unique violation on merge, got %v", err)
+	}
+	if results := collection.Query("email", "john@example.com"); len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected a rejected merge to leave user1 indexed, got %v", results)
+	}
+
+	// Rewriting a document's own value and leaving the field out are allowed
+	if err := collection.Update("user1", map[string]interface{}{"email": "john@example.com", "name": "John"}); err != nil {
+		t.Fatalf("Expected no error updating with the same value, got %v", err)
+	}
+	if err := collection.Insert("user5", map[string]interface{}{"name": "Bob"}); err != nil {
+		t.Fatalf("Expected no error without the field, got %v", err)
+	}
+	if err := collection.Insert("user6", map[string]interface{}{"name": "Alice"}); err != nil {
+		t.Fatalf("Expected no error without the field, got %v", err)
+	}
+
+	// A value freed by a delete can be reused
+	collection.Delete("user3")
+	if err := collection.Insert("user7", map[string]interface{}{"email": "jane@example.com"}); err != nil {
+		t.Fatalf("Expected no error reusing a freed value, got %v", err)
+	}
+}
+
+func TestTransaction_UniqueIndex(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.CreateUniqueIndex("email")
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+
+	tx := db.Begin()
+	tx.Insert("users", "user2", map[string]interface{}{"email": "jane@example.com"})
+	tx.Insert("users", "user3", map[string]interface{}{"email": "jane@example.com"})
+	if err := tx.Commit(); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected a unique violation, got %v", err)
+	}
+	if _, err := collection.Get("user2"); err == nil {
+		t.Fatal("Expected the failed transaction to insert nothing")
+	}
+
+	// Values can move between documents within a transaction
+	tx = db.Begin()
+	tx.Update("users", "user1", map[string]interface{}{"email": "old@example.com"})
+	tx.Insert("users", "user2", map[string]interface{}{"email": "john@example.com"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestCollection_ListAndDropIndexes(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com", "city": "Boston"})
+	collection.Insert("user2", map[string]interface{}{"email": "jane@example.com", "city": "Boston"})
+	collection.CreateUniqueIndex("email")
+	collection.CreateIndex("city")
+
+	infos := collection.ListIndexes()
+	expected := []IndexInfo{
+		{Field: "city", Unique: false, Cardinality: 1},
+		{Field: "email", Unique: true, Cardinality: 2},
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("Expected %d indexes, got %v", len(expected), infos)
+	}
+	for i := range expected {
+		if infos[i] != expected[i] {
+			t.Fatalf("Expected %+v at %d, got %+v", expected[i], i, infos[i])
+		}
+	}
+
+	if err := collection.DropIndex("email"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := collection.DropIndex("email"); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("Expected ErrIndexNotFound, got %v", err)
+	}
+
+	// Without the unique index duplicates are allowed and queries scan
+	if err := collection.Insert("user3", map[string]interface{}{"email": "jane@example.com"}); err != nil {
+		t.Fatalf("Expected no error after dropping the unique index, got %v", err)
+	}
+	if results := collection.Query("email", "jane@example.com"); len(results) != 2 {
+		t.Fatalf("Expected 2 results from a scan, got %d", len(results))
+	}
+	if infos := collection.ListIndexes(); len(infos) != 1 || infos[0].Field != "city" {
+		t.Fatalf("Expected only the city index, got %v", infos)
+	}
+}
+
+func TestDatabase_IndexesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"email": "john@example.com", "city": "Boston"})
+	users.Insert("user2", map[string]interface{}{"email": "jane@example.com", "city": "Boston"})
+	users.CreateUniqueIndex("email")
+	users.CreateIndex("city")
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+
+	loaded := NewDatabaseWithPath(path)
+	if err := loaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	users, _ = loaded.GetCollection("users")
+
+	infos := users.ListIndexes()
+	if len(infos) != 2 || infos[0] != (IndexInfo{Field: "city", Cardinality: 1}) || infos[1] != (IndexInfo{Field: "email", Unique: true, Cardinality: 2}) {
+		t.Fatalf("Expected the city and unique email indexes to be rebuilt, got %+v", infos)
+	}
+
+	if err := users.Insert("user3", map[string]interface{}{"email": "john@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected the unique constraint to survive a reload, got %v", err)
+	}
+
+	users.mu.RLock()
+	docs, indexed := users.indexedCandidates(Filter{Field: "email", Value: "jane@example.com"})
+	users.mu.RUnlock()
+	if !indexed || len(docs) != 1 || docs[0].ID != "user2" {
+		t.Fatalf("Expected an indexed lookup of user2, got %v, %v", docs, indexed)
+	}
+}
+
+func BenchmarkQueryIndexed(b *testing.B) {
+	db := NewDatabase()
+	db.CreateCollection("benchmark")
+	collection, _ := db.GetCollection("benchmark")
+
+	cities := []string{"New York", "San Francisco", "Chicago", "Boston", "Seattle"}
+
+	for i := 0; i < 1000; i++ {
+		collection.Insert(strconv.Itoa(i), map[string]interface{}{
+			"age":  20 + (i % 50),
+			"city": cities[i%len(cities)],
+		})
+	}
+	collection.CreateIndex("age")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collection.Query("age", 20+(i%50))
+	}
+}
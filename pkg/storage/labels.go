@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AddLabels attaches labels to a document
+func (c *Collection) AddLabels(id string, labels ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	if c.applyLabelsLocked(doc, labels, nil) {
+		doc.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// RemoveLabels detaches labels from a document
+func (c *Collection) RemoveLabels(id string, labels ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	if c.applyLabelsLocked(doc, nil, labels) {
+		doc.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// FindByLabel returns all documents carrying a label
+func (c *Collection) FindByLabel(label string) []*Document {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := c.labelIndex[label]
+	docs := make([]*Document, 0, len(ids))
+	for id := range ids {
+		docs = append(docs, c.Documents[id])
+	}
+
+	docs = liveDocuments(docs)
+	sortByCreation(docs)
+	return c.readDocuments(docs)
+}
+
+// LabelWhere adds and removes labels on every document matching the filter
+// under a single write lock, returning the number of documents matched
+func (c *Collection) LabelWhere(f Filter, add, remove []string) (int, error) {
+	if err := f.validate(); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	matched := 0
+	for _, doc := range c.Documents {
+		if !f.matches(doc) {
+			continue
+		}
+		matched++
+		if c.applyLabelsLocked(doc, add, remove) {
+			doc.UpdatedAt = now
+		}
+	}
+
+	return matched, nil
+}
+
+// applyLabelsLocked updates a document's labels and the label index,
+// reporting whether anything changed. Callers must hold c.mu for writing.
+func (c *Collection) applyLabelsLocked(doc *Document, add, remove []string) bool {
+	current := make(map[string]bool, len(doc.Labels))
+	for _, label := range doc.Labels {
+		current[label] = true
+	}
+
+	changed := false
+	for _, label := range remove {
+		if current[label] {
+			delete(current, label)
+			c.unindexLabel(label, doc.ID)
+			changed = true
+		}
+	}
+	for _, label := range add {
+		if label != "" && !current[label] {
+			current[label] = true
+			c.indexLabel(label, doc.ID)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	labels := make([]string, 0, len(current))
+	for label := range current {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	doc.Labels = labels
+
+	c.markDirty()
+	return true
+}
+
+func (c *Collection) indexLabel(label, id string) {
+	if c.labelIndex == nil {
+		c.labelIndex = make(map[string]map[string]struct{})
+	}
+	ids, exists := c.labelIndex[label]
+	if !exists {
+		ids = make(map[string]struct{})
+		c.labelIndex[label] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (c *Collection) unindexLabel(label, id string) {
+	ids := c.labelIndex[label]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(c.labelIndex, label)
+	}
+}
+
+// unindexLabelsLocked removes a document from the label index
+func (c *Collection) unindexLabelsLocked(doc *Document) {
+	for _, label := range doc.Labels {
+		c.unindexLabel(label, doc.ID)
+	}
+}
+
+// rebuildLabelIndex recreates the label index from document labels
+func (c *Collection) rebuildLabelIndex() {
+	c.labelIndex = make(map[string]map[string]struct{})
+	for _, doc := range c.Documents {
+		for _, label := range doc.Labels {
+			c.indexLabel(label, doc.ID)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import "testing"
+
+func TestCollection_Labels(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane"})
+
+	if err := collection.AddLabels("user1", "vip", "beta"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if docs := collection.FindByLabel("vip"); len(docs) != 1 || docs[0].ID != "user1" {
+		t.Fatalf("Expected user1 to be labeled vip, got %v", docs)
+	}
+
+	collection.RemoveLabels("user1", "vip")
+	if docs := collection.FindByLabel("vip"); len(docs) != 0 {
+		t.Fatalf("Expected no vip documents, got %d", len(docs))
+	}
+
+	collection.Delete("user1")
+	if docs := collection.FindByLabel("beta"); len(docs) != 0 {
+		t.Fatalf("Expected deleted document to be removed from label index, got %d", len(docs))
+	}
+
+	if err := collection.AddLabels("nonexistent", "vip"); err == nil {
+		t.Fatal("Expected error for non-existent document")
+	}
+}
+
+func TestCollection_LabelWhere(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"city": "New York"})
+	collection.Insert("user2", map[string]interface{}{"city": "New York"})
+	collection.Insert("user3", map[string]interface{}{"city": "Boston"})
+	collection.AddLabels("user3", "east")
+
+	matched, err := collection.LabelWhere(Filter{Field: "city", Value: "New York"}, []string{"east", "nyc"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if matched != 2 {
+		t.Fatalf("Expected 2 matched documents, got %d", matched)
+	}
+
+	if docs := collection.FindByLabel("nyc"); len(docs) != 2 {
+		t.Fatalf("Expected 2 nyc documents, got %d", len(docs))
+	}
+
+	if docs := collection.FindByLabel("east"); len(docs) != 3 {
+		t.Fatalf("Expected 3 east documents, got %d", len(docs))
+	}
+
+	doc, _ := collection.Get("user3")
+	if len(doc.Labels) != 1 {
+		t.Fatalf("Expected non-matching document to keep its labels only, got %v", doc.Labels)
+	}
+
+	// Removing by query keeps the index consistent
+	collection.LabelWhere(Filter{Field: "city", Value: "New York"}, nil, []string{"east"})
+	if docs := collection.FindByLabel("east"); len(docs) != 1 || docs[0].ID != "user3" {
+		t.Fatalf("Expected only user3 to remain labeled east, got %v", docs)
+	}
+}
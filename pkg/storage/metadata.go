@@ -0,0 +1,25 @@
+package storage
+
+// SetMetadata replaces the collection's metadata, such as a description or
+// owner. The metadata is copied, persisted with the collection and carried
+// over by CopyCollection. Passing nil clears it.
+func (c *Collection) SetMetadata(metadata map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(metadata) == 0 {
+		c.Metadata = nil
+	} else {
+		c.Metadata = copyMap(metadata)
+	}
+	c.markDirty()
+}
+
+// GetMetadata returns a copy of the collection's metadata, or nil when it
+// has none
+func (c *Collection) GetMetadata() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return copyMap(c.Metadata)
+}
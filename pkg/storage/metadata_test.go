@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCollection_Metadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	if metadata := collection.GetMetadata(); metadata != nil {
+		t.Fatalf("Expected no metadata, got %v", metadata)
+	}
+
+	metadata := map[string]interface{}{"owner": "growth", "description": "Signed up users"}
+	collection.SetMetadata(metadata)
+	metadata["owner"] = "changed"
+
+	if owner := collection.GetMetadata()["owner"]; owner != "growth" {
+		t.Fatalf("Expected stored metadata to be a copy, got owner %v", owner)
+	}
+	collection.GetMetadata()["owner"] = "changed"
+	if owner := collection.GetMetadata()["owner"]; owner != "growth" {
+		t.Fatalf("Expected returned metadata to be a copy, got owner %v", owner)
+	}
+
+	db.CopyCollection("users", "users_copy")
+	copied, _ := db.GetCollection("users_copy")
+	if owner := copied.GetMetadata()["owner"]; owner != "growth" {
+		t.Fatalf("Expected copy to keep metadata, got owner %v", owner)
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	loaded := NewDatabaseWithPath(path)
+	if err := loaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	reloaded, _ := loaded.GetCollection("users")
+	if description := reloaded.GetMetadata()["description"]; description != "Signed up users" {
+		t.Fatalf("Expected metadata to persist, got description %v", description)
+	}
+
+	collection.SetMetadata(nil)
+	if metadata := collection.GetMetadata(); metadata != nil {
+		t.Fatalf("Expected metadata to be cleared, got %v", metadata)
+	}
+}
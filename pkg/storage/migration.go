@@ -0,0 +1,98 @@
+package storage
+
+import "fmt"
+
+// MigrationFunc upgrades document data from one schema version to the next
+type MigrationFunc func(data map[string]interface{}) map[string]interface{}
+
+// SetMigration registers fn to upgrade documents from fromVersion to
+// fromVersion+1. The collection's current schema version is one past the
+// highest registered migration; documents written from then on are stamped
+// with it, and stored documents are upgraded as far as the registered chain
+// reaches, so queries and indexes see their migrated fields. Migrations are
+// not persisted and must be registered on every start.
+func (c *Collection) SetMigration(fromVersion int, fn MigrationFunc) error {
+	if fromVersion < 0 {
+		return fmt.Errorf("schema version must not be negative")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.migrations == nil {
+		c.migrations = make(map[int]MigrationFunc)
+	}
+	c.migrations[fromVersion] = fn
+
+	current := c.schemaVersionLocked()
+	migrated := false
+	for _, doc := range c.Documents {
+		if doc.SchemaVersion >= current {
+			continue
+		}
+		version := doc.SchemaVersion
+		c.unindexDocumentLocked(doc)
+		c.migrateLocked(doc)
+		doc.Checksum = checksumData(doc.Data)
+		c.indexDocumentLocked(doc)
+		migrated = migrated || doc.SchemaVersion != version
+	}
+	if migrated {
+		c.markDirty()
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the collection's current schema version
+func (c *Collection) SchemaVersion() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.schemaVersionLocked()
+}
+
+func (c *Collection) schemaVersionLocked() int {
+	version := 0
+	for from := range c.migrations {
+		if from+1 > version {
+			version = from + 1
+		}
+	}
+	return version
+}
+
+// migrateLocked upgrades doc in place to the current schema version by
+// applying each registered migration in turn. doc must not be the stored
+// document unless the caller holds c.mu for writing.
+func (c *Collection) migrateLocked(doc *Document) {
+	current := c.schemaVersionLocked()
+	for doc.SchemaVersion < current {
+		fn, exists := c.migrations[doc.SchemaVersion]
+		if !exists {
+			// A gap in the chain; stop at the last version we could reach
+			return
+		}
+
+		if data := fn(doc.Data); data != nil {
+			doc.Data = data
+		}
+		doc.SchemaVersion++
+	}
+}
+
+// readDocument returns a copy of a stored document for a reader, upgraded to
+// the current schema version
+func (c *Collection) readDocument(doc *Document) *Document {
+	clone := doc.Clone()
+	c.migrateLocked(clone)
+	return clone
+}
+
+// readDocuments copies and upgrades a slice of stored documents in place
+func (c *Collection) readDocuments(docs []*Document) []*Document {
+	for i, doc := range docs {
+		docs[i] = c.readDocument(doc)
+	}
+	return docs
+}
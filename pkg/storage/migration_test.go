@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollection_SetMigration(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+
+	// Written under version 0, before any migrations exist
+	collection.Insert("user1", map[string]interface{}{"name": "John Smith"})
+
+	// v0 -> v1 splits name; v1 -> v2 adds a default
+	collection.SetMigration(0, func(data map[string]interface{}) map[string]interface{} {
+		parts := strings.SplitN(data["name"].(string), " ", 2)
+		data["first_name"], data["last_name"] = parts[0], parts[1]
+		delete(data, "name")
+		return data
+	})
+	collection.SetMigration(1, func(data map[string]interface{}) map[string]interface{} {
+		data["active"] = true
+		return data
+	})
+
+	if version := collection.SchemaVersion(); version != 2 {
+		t.Fatalf("Expected schema version 2, got %d", version)
+	}
+
+	doc, err := collection.Get("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if doc.SchemaVersion != 2 || doc.Data["first_name"] != "John" || doc.Data["active"] != true {
+		t.Fatalf("Expected migrated document, got version %d: %v", doc.SchemaVersion, doc.Data)
+	}
+	if _, exists := doc.Data["name"]; exists {
+		t.Fatal("Expected old field to be removed by migration")
+	}
+
+	// Stored documents are upgraded when the migration is registered
+	if stored := collection.Documents["user1"]; stored.SchemaVersion != 2 || stored.Data["first_name"] != "John" {
+		t.Fatalf("Expected stored document at version 2, got %d: %v", stored.SchemaVersion, stored.Data)
+	}
+
+	// New documents are written at the current version and not migrated
+	collection.Insert("user2", map[string]interface{}{"first_name": "Jane", "last_name": "Doe", "active": false})
+	doc, _ = collection.Get("user2")
+	if doc.SchemaVersion != 2 || doc.Data["active"] != false {
+		t.Fatalf("Expected new document to skip migrations, got version %d: %v", doc.SchemaVersion, doc.Data)
+	}
+}
+
+func TestCollection_SetMigrationQueries(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	collection, _ := db.GetCollection("users")
+	collection.CreateIndex("full_name")
+	collection.Insert("user1", map[string]interface{}{"name": "bob"})
+	collection.Insert("user2", map[string]interface{}{"name": "alice"})
+
+	collection.SetMigration(0, func(data map[string]interface{}) map[string]interface{} {
+		data["full_name"] = data["name"]
+		delete(data, "name")
+		return data
+	})
+
+	results := collection.Query("full_name", "bob")
+	if len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected the migrated document to match its renamed field, got %v", results)
+	}
+	if results := collection.Query("name", "bob"); len(results) != 0 {
+		t.Fatalf("Expected no match on the old field name, got %d", len(results))
+	}
+	if corrupt := collection.VerifyChecksums(); len(corrupt) != 0 {
+		t.Fatalf("Expected migrated documents to pass checksum verification, got %v", corrupt)
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Operation types recorded in an operations log, in addition to the
+// document change types
+const (
+	OpCreateCollection = "create_collection"
+	OpDeleteCollection = "delete_collection"
+	OpCopyCollection   = "copy_collection"
+	OpRenameCollection = "rename_collection"
+	OpReset            = "reset"
+	OpRestore          = "restore"
+)
+
+// Operation is one mutating storage operation in an operations log. Document
+// operations carry the document's full data after the change; copies and
+// renames name the new collection in Target; restores carry the restored
+// snapshot under the "snapshot" key of Data.
+type Operation struct {
+	Time       time.Time              `json:"time"`
+	Op         string                 `json:"op"`
+	Collection string                 `json:"collection,omitempty"`
+	Target     string                 `json:"target,omitempty"`
+	ID         string                 `json:"id,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// opLog writes operations as JSON lines
+type opLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// RecordOperations writes every subsequent mutating operation to w as a line
+// of JSON, for replaying later with ReplayOperations. Operations are written
+// while the affected collection is locked, so the log preserves the order
+// writes were applied in. Passing nil stops recording.
+func (db *Database) RecordOperations(w io.Writer) {
+	if w == nil {
+		db.oplog.Store(nil)
+		return
+	}
+	db.oplog.Store(&opLog{enc: json.NewEncoder(w)})
+}
+
+// record appends an operation to the operations log, if one is configured
+func (db *Database) record(op Operation) {
+	l := db.oplog.Load()
+	if l == nil {
+		return
+	}
+
+	op.Time = time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.enc.Encode(op); err != nil {
+		log.Printf("Failed to record %s operation: %v", op.Op, err)
+	}
+}
+
+// ReplayOperations applies an operations log written by RecordOperations to
+// the database, returning how many operations were applied. It stops at the
+// first operation that fails.
+func (db *Database) ReplayOperations(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	applied := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var op Operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return applied, fmt.Errorf("operation %d: invalid JSON: %w", applied+1, err)
+		}
+		if err := db.applyOperation(op); err != nil {
+			return applied, fmt.Errorf("operation %d (%s): %w", applied+1, op.Op, err)
+		}
+		applied++
+	}
+
+	return applied, scanner.Err()
+}
+
+func (db *Database) applyOperation(op Operation) error {
+	switch op.Op {
+	case OpCreateCollection:
+		return db.CreateCollection(op.Collection)
+	case OpDeleteCollection:
+		return db.DeleteCollection(op.Collection)
+	case OpCopyCollection:
+		return db.CopyCollection(op.Collection, op.Target)
+	case OpRenameCollection:
+		return db.RenameCollection(op.Collection, op.Target)
+	case OpReset:
+		db.Reset()
+		return nil
+	case OpRestore:
+		snapshot, err := json.Marshal(op.Data["snapshot"])
+		if err != nil {
+			return err
+		}
+		return db.Restore(bytes.NewReader(snapshot))
+	}
+
+	collection, err := db.GetCollection(op.Collection)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case ChangeInsert:
+		return collection.Insert(op.ID, op.Data)
+	case ChangeUpdate:
+		return collection.Update(op.ID, op.Data)
+	case ChangeDelete:
+		return collection.Delete(op.ID)
+	case ChangeTruncate:
+		return collection.Truncate()
+	default:
+		return fmt.Errorf("unknown operation type '%s'", op.Op)
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatabase_RecordAndReplayOperations(t *testing.T) {
+	var ops bytes.Buffer
+	db := NewDatabase()
+	db.RecordOperations(&ops)
+
+	db.CreateCollection("users")
+	db.CreateCollection("scratch")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John", "age": 30})
+	users.Insert("user2", map[string]interface{}{"name": "Jane"})
+	users.Update("user1", map[string]interface{}{"name": "John", "age": 31})
+	users.Merge("user2", map[string]interface{}{"city": "Paris"})
+	users.DeleteField("user1", "age")
+	users.Insert("user3", map[string]interface{}{"name": "Temp"})
+	users.Delete("user3")
+	db.DeleteCollection("scratch")
+
+	// Stopping recording leaves later writes out of the log
+	db.RecordOperations(nil)
+	users.Insert("user4", map[string]interface{}{"name": "Unrecorded"})
+	users.Delete("user4")
+
+	replayed := NewDatabase()
+	applied, err := replayed.ReplayOperations(bytes.NewReader(ops.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error replaying, got %v", err)
+	}
+	if applied != 10 {
+		t.Errorf("Expected 10 operations, got %d", applied)
+	}
+
+	if names := replayed.ListCollections(); len(names) != 1 || names[0] != "users" {
+		t.Fatalf("Expected only the users collection, got %v", names)
+	}
+
+	replayedUsers, _ := replayed.GetCollection("users")
+	original, got := users.List(), replayedUsers.List()
+	if len(original) != len(got) {
+		t.Fatalf("Expected %d documents, got %d", len(original), len(got))
+	}
+	for i := range original {
+		if original[i].ID != got[i].ID || !reflect.DeepEqual(original[i].Data, got[i].Data) {
+			t.Errorf("Expected %s %v, got %s %v", original[i].ID, original[i].Data, got[i].ID, got[i].Data)
+		}
+	}
+}
+
+func TestDatabase_ReplayOperationsStopsOnError(t *testing.T) {
+	log := `{"op":"create_collection","collection":"users"}
+{"op":"insert","collection":"users","id":"user1","data":{"name":"John"}}
+{"op":"delete","collection":"users","id":"missing"}
+{"op":"insert","collection":"users","id":"user2","data":{"name":"Jane"}}
+`
+	db := NewDatabase()
+	applied, err := db.ReplayOperations(strings.NewReader(log))
+	if err == nil || !strings.Contains(err.Error(), "operation 3") {
+		t.Fatalf("Expected an error for operation 3, got %v", err)
+	}
+	if applied != 2 {
+		t.Errorf("Expected 2 operations applied, got %d", applied)
+	}
+}
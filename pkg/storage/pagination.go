@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// Page returns up to limit documents with IDs greater than afterID, ordered
+// by ID, along with the ID to pass as afterID to fetch the next page. The
+// next ID is empty once the last page has been returned. Because pages are
+// keyed by ID rather than offset, walking every page visits each document
+// that exists for the whole walk exactly once, even while other documents
+// are inserted or deleted.
+func (c *Collection) Page(afterID string, limit int) ([]*Document, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	ids := make([]string, 0)
+	for id, doc := range c.Documents {
+		if id > afterID && !doc.expired(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	next := ""
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+
+	docs := make([]*Document, len(ids))
+	for i, id := range ids {
+		docs[i] = c.readDocument(c.Documents[id])
+	}
+
+	return docs, next
+}
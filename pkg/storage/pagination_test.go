@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCollection_Page(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	for i := 0; i < 25; i++ {
+		collection.Insert(fmt.Sprintf("doc%02d", i), map[string]interface{}{"n": i})
+	}
+
+	seen := make(map[string]int)
+	cursor := ""
+	pages := 0
+	for {
+		docs, next := collection.Page(cursor, 10)
+		pages++
+		for _, doc := range docs {
+			seen[doc.ID]++
+		}
+
+		// Concurrent writes behind and ahead of the cursor must not cause
+		// documents to be skipped or repeated
+		if pages == 1 {
+			collection.Insert("doc00a", map[string]interface{}{"n": -1})
+			collection.Delete("doc24")
+			collection.Insert("doc99", map[string]interface{}{"n": 99})
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if pages != 3 {
+		t.Fatalf("Expected 3 pages, got %d", pages)
+	}
+
+	for i := 0; i < 24; i++ {
+		id := fmt.Sprintf("doc%02d", i)
+		if seen[id] != 1 {
+			t.Fatalf("Expected %s to be seen exactly once, got %d", id, seen[id])
+		}
+	}
+
+	if seen["doc99"] != 1 {
+		t.Fatal("Expected document inserted ahead of the cursor to be visited")
+	}
+}
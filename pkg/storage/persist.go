@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeFileAtomic writes a file by streaming into a temporary file in the
+// same directory and renaming it over path once write succeeds. Rename is
+// atomic on POSIX filesystems, so readers see either the old file or the
+// complete new one, never a partial write.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	// Clean up the temp file on any failure before the rename
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	success = true
+	return nil
+}
+
+// CheckPersistence verifies that the data file can be saved: its directory
+// must exist and accept new files, which is all an atomic save needs, and
+// an existing data file must be a regular file
+func (db *Database) CheckPersistence() error {
+	dir := filepath.Dir(db.dataFile)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("data directory is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("data directory '%s' is not a directory", dir)
+	}
+
+	if info, err := os.Stat(db.dataFile); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("data file '%s' is not a regular file", db.dataFile)
+	}
+
+	probe, err := os.CreateTemp(dir, filepath.Base(db.dataFile)+".probe-*")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	defer os.Remove(probe.Name())
+
+	if _, err := probe.Write([]byte("ok")); err != nil {
+		probe.Close()
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	return probe.Close()
+}
+
+// LastSave returns when the database was last saved successfully, or the
+// zero time if it has not been saved since it was created
+func (db *Database) LastSave() time.Time {
+	nanos := db.lastSave.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// SaveStatus describes the outcome of recent saves
+type SaveStatus struct {
+	// LastSaveTime is when the database was last saved successfully
+	LastSaveTime *time.Time `json:"last_save_time,omitempty"`
+	// LastSaveError is the error of the most recent save, cleared once a
+	// save succeeds
+	LastSaveError string     `json:"last_save_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_save_error_time,omitempty"`
+	// SaveErrors counts every failed save since the database was created
+	SaveErrors int64 `json:"save_errors"`
+	// ConsecutiveFailures counts failed saves since the last success
+	ConsecutiveFailures int `json:"consecutive_save_failures"`
+}
+
+// SaveStatus reports when the database was last saved and how recent saves
+// have failed
+func (db *Database) SaveStatus() SaveStatus {
+	var status SaveStatus
+	if lastSave := db.LastSave(); !lastSave.IsZero() {
+		status.LastSaveTime = &lastSave
+	}
+
+	db.saveStatusMu.Lock()
+	defer db.saveStatusMu.Unlock()
+
+	status.SaveErrors = db.saveErrors
+	status.ConsecutiveFailures = db.saveFailures
+	if db.saveFailures > 0 {
+		errAt := db.saveErrAt
+		status.LastSaveError = db.saveErr
+		status.LastErrorTime = &errAt
+	}
+	return status
+}
+
+// recordSaveFailure counts a failed save
+func (db *Database) recordSaveFailure(err error) {
+	db.saveStatusMu.Lock()
+	defer db.saveStatusMu.Unlock()
+
+	db.saveErrors++
+	db.saveFailures++
+	db.saveErr = err.Error()
+	db.saveErrAt = time.Now()
+}
+
+// recordSaveSuccess ends a run of failed saves
+func (db *Database) recordSaveSuccess() {
+	db.saveStatusMu.Lock()
+	defer db.saveStatusMu.Unlock()
+
+	db.saveFailures = 0
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic_FailedWriteKeepsPreviousFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	original, _ := os.ReadFile(path)
+
+	// Simulate a crash partway through writing the next snapshot
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		w.Write([]byte(`{"collections": {"users": {"na`))
+		return errors.New("disk full")
+	})
+	if err == nil {
+		t.Fatal("Expected error from failing writer")
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != string(original) {
+		t.Fatal("Expected previous data file to be intact after a failed write")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected temp file to be cleaned up, found %d entries", len(entries))
+	}
+
+	db2 := NewDatabaseWithPath(path)
+	if err := db2.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected previous file to load, got %v", err)
+	}
+	if _, err := db2.GetCollection("users"); err != nil {
+		t.Fatalf("Expected previous data to load, got %v", err)
+	}
+}
+
+func TestDatabase_CompressedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json.gz")
+
+	db := NewDatabaseWithOptions(Options{DataFile: path, Compress: true})
+	db.CreateCollection("users")
+	users, _ := db.GetCollection("users")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		t.Fatal("Expected a gzip-compressed data file")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the data file after an atomic save, got %d entries", len(entries))
+	}
+
+	// Compression is detected on load, whatever the loading database's options
+	loaded := NewDatabaseWithPath(path)
+	if err := loaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading compressed data, got %v", err)
+	}
+	collection, err := loaded.GetCollection("users")
+	if err != nil {
+		t.Fatalf("Expected loaded collection, got %v", err)
+	}
+	if doc, err := collection.Get("user1"); err != nil || doc.Data["name"] != "John" {
+		t.Fatalf("Expected loaded document, got %v (%v)", doc, err)
+	}
+
+	// A compressed database still reads plain snapshots
+	plainPath := filepath.Join(dir, "plain.json")
+	plain := NewDatabaseWithPath(plainPath)
+	plain.CreateCollection("orders")
+	plain.SaveToDisk()
+
+	switched := NewDatabaseWithOptions(Options{DataFile: plainPath, Compress: true})
+	if err := switched.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading plain data, got %v", err)
+	}
+	if _, err := switched.GetCollection("orders"); err != nil {
+		t.Fatalf("Expected collection from plain snapshot, got %v", err)
+	}
+
+	if got := NewDatabaseWithOptions(Options{Compress: true}).DataFile(); got != DefaultDataFile+".gz" {
+		t.Errorf("Expected default compressed data file %s.gz, got %s", DefaultDataFile, got)
+	}
+}
+
+func TestDatabase_CheckPersistence(t *testing.T) {
+	dir := t.TempDir()
+	db := NewDatabaseWithPath(filepath.Join(dir, "data.json"))
+
+	if err := db.CheckPersistence(); err != nil {
+		t.Fatalf("Expected a writable data directory, got %v", err)
+	}
+	if !db.LastSave().IsZero() {
+		t.Fatal("Expected no last save before saving")
+	}
+
+	before := time.Now()
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	if db.LastSave().Before(before) {
+		t.Fatalf("Expected last save to be recorded, got %v", db.LastSave())
+	}
+
+	// The probe file is cleaned up
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the data file to remain, got %d entries", len(entries))
+	}
+
+	missing := NewDatabaseWithPath(filepath.Join(dir, "missing", "data.json"))
+	if err := missing.CheckPersistence(); err == nil {
+		t.Fatal("Expected error for a missing data directory")
+	}
+}
@@ -0,0 +1,488 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query operators supported by Filter
+const (
+	OpEq        = "eq"
+	OpLike      = "like"
+	OpGt        = "gt"
+	OpGte       = "gte"
+	OpLt        = "lt"
+	OpLte       = "lte"
+	OpRegex     = "regex"
+	OpIn        = "in"
+	OpNin       = "nin"
+	OpContains  = "contains"
+	OpExists    = "exists"
+	OpNotExists = "notexists"
+)
+
+// contextCheckInterval is how many documents a context-aware scan examines
+// between checks for cancellation
+const contextCheckInterval = 256
+
+// Filter is a condition on a single document field. CaseInsensitive makes
+// the equality operators (eq, in, nin and contains) compare strings with
+// strings.EqualFold; other values compare as usual.
+type Filter struct {
+	Field           string      `json:"field"`
+	Op              string      `json:"op,omitempty"`
+	Value           interface{} `json:"value"`
+	CaseInsensitive bool        `json:"caseInsensitive,omitempty"`
+}
+
+// validate checks that the filter is well formed
+func (f Filter) validate() error {
+	if f.Field == "" {
+		return fmt.Errorf("field is required for query")
+	}
+	if err := checkQueryField(f.Field); err != nil {
+		return err
+	}
+
+	switch f.Op {
+	case "", OpEq, OpContains, OpExists, OpNotExists:
+	case OpLike:
+		if _, ok := f.Value.(string); !ok {
+			return fmt.Errorf("operator '%s' requires a string value", f.Op)
+		}
+	case OpRegex:
+		pattern, ok := f.Value.(string)
+		if !ok {
+			return fmt.Errorf("operator '%s' requires a string value", f.Op)
+		}
+		if _, err := compilePattern(pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern '%s': %v", pattern, err)
+		}
+	case OpIn, OpNin:
+		if _, ok := listValues(f.Value); !ok {
+			return fmt.Errorf("operator '%s' requires an array value", f.Op)
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		if rank := typeRank(f.Value); rank != 0 && rank != 1 {
+			return fmt.Errorf("operator '%s' requires a number or string value", f.Op)
+		}
+	default:
+		return fmt.Errorf("unknown query operator '%s'", f.Op)
+	}
+
+	return nil
+}
+
+// matches reports whether a document satisfies the filter
+func (f Filter) matches(doc *Document) bool {
+	docValue, exists := lookupPath(doc.Data, f.Field)
+	switch f.Op {
+	case OpExists:
+		return exists
+	case OpNotExists:
+		return !exists
+	}
+	if !exists {
+		// A missing field is in none of the listed values
+		return f.Op == OpNin
+	}
+
+	switch f.Op {
+	case OpLike:
+		s, ok := docValue.(string)
+		if !ok {
+			return false
+		}
+		return strings.Contains(strings.ToLower(s), strings.ToLower(f.Value.(string)))
+	case OpRegex:
+		s, ok := docValue.(string)
+		if !ok {
+			return false
+		}
+		re, err := compilePattern(f.Value.(string))
+		return err == nil && re.MatchString(s)
+	case OpIn, OpNin:
+		values, _ := listValues(f.Value)
+		for _, v := range values {
+			if f.equal(docValue, v) {
+				return f.Op == OpIn
+			}
+		}
+		return f.Op == OpNin
+	case OpContains:
+		elements, ok := listValues(docValue)
+		if !ok {
+			return false
+		}
+		for _, element := range elements {
+			if f.equal(element, f.Value) {
+				return true
+			}
+		}
+		return false
+	case OpGt, OpGte, OpLt, OpLte:
+		// Ranges only compare like with like: numbers with numbers and
+		// strings with strings
+		if typeRank(docValue) != typeRank(f.Value) {
+			return false
+		}
+		cmp := compareValues(docValue, f.Value)
+		switch f.Op {
+		case OpGt:
+			return cmp > 0
+		case OpGte:
+			return cmp >= 0
+		case OpLt:
+			return cmp < 0
+		}
+		return cmp <= 0
+	default:
+		return f.equal(docValue, f.Value)
+	}
+}
+
+// equal compares a document value with a filter value, ignoring case
+// between strings when the filter is case-insensitive
+func (f Filter) equal(docValue, value interface{}) bool {
+	if f.CaseInsensitive {
+		a, aIsString := docValue.(string)
+		b, bIsString := value.(string)
+		if aIsString && bIsString {
+			return strings.EqualFold(a, b)
+		}
+	}
+	return valuesEqual(docValue, value)
+}
+
+// listValues returns the elements of a filter value that is a slice, such
+// as the []interface{} decoded from a JSON array or a typed Go slice
+func listValues(value interface{}) ([]interface{}, bool) {
+	if values, ok := value.([]interface{}); ok {
+		return values, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, true
+}
+
+// maxCachedPatterns bounds the compiled regex cache; it is emptied when full
+const maxCachedPatterns = 256
+
+// patternCache holds compiled regex patterns so a query compiles its
+// pattern once rather than for every document it scans
+var patternCache = struct {
+	sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// compilePattern returns the compiled regex for pattern, from the cache when
+// possible
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternCache.RLock()
+	re, exists := patternCache.patterns[pattern]
+	patternCache.RUnlock()
+	if exists {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Lock()
+	defer patternCache.Unlock()
+
+	if len(patternCache.patterns) >= maxCachedPatterns {
+		patternCache.patterns = make(map[string]*regexp.Regexp)
+	}
+	patternCache.patterns[pattern] = re
+	return re, nil
+}
+
+// lookupPath resolves a field in document data. Paths may use dot notation,
+// such as "address.city", to reach into nested objects. A key containing a
+// literal dot is matched before the path is split. Missing intermediate keys
+// or non-object intermediates simply report that the field does not exist.
+func lookupPath(data map[string]interface{}, path string) (interface{}, bool) {
+	if data == nil {
+		return nil, false
+	}
+
+	if value, exists := data[path]; exists {
+		return value, true
+	}
+
+	if !strings.Contains(path, ".") {
+		return nil, false
+	}
+
+	var current interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// deletePath removes a field from document data, resolving the path the same
+// way as lookupPath. It reports whether the field existed.
+func deletePath(data map[string]interface{}, path string) bool {
+	if data == nil {
+		return false
+	}
+
+	if _, exists := data[path]; exists {
+		delete(data, path)
+		return true
+	}
+
+	parts := strings.Split(path, ".")
+	if len(parts) == 1 {
+		return false
+	}
+
+	parent, exists := lookupPath(data, strings.Join(parts[:len(parts)-1], "."))
+	if !exists {
+		return false
+	}
+	m, ok := parent.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	last := parts[len(parts)-1]
+	if _, exists := m[last]; !exists {
+		return false
+	}
+	delete(m, last)
+	return true
+}
+
+// valuesEqual compares two field values, treating numbers of different Go
+// types (such as int and the float64 produced by JSON decoding) as equal when
+// they represent the same value
+func valuesEqual(a, b interface{}) bool {
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		return ok && fa == fb
+	}
+
+	switch a.(type) {
+	case string, bool, nil:
+		return a == b
+	}
+
+	return false
+}
+
+// QueryFilter returns all documents matching the filter
+func (c *Collection) QueryFilter(f Filter) ([]*Document, error) {
+	return c.QueryFilterContext(context.Background(), f)
+}
+
+// QueryFilterContext is QueryFilter that stops scanning and returns the
+// context's error once ctx is done
+func (c *Collection) QueryFilterContext(ctx context.Context, f Filter) ([]*Document, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if err := c.checkFieldKnownLocked(f.Field); err != nil {
+		return nil, err
+	}
+
+	if candidates, ok := c.indexedCandidates(f); ok {
+		return c.readDocuments(liveDocuments(candidates)), nil
+	}
+
+	var results []*Document
+	scanned := 0
+	for _, doc := range c.Documents {
+		if scanned%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scanned++
+
+		if f.matches(doc) {
+			results = append(results, doc)
+		}
+	}
+
+	return c.readDocuments(liveDocuments(results)), nil
+}
+
+// QueryMulti returns all documents matching every one of the filters
+func (c *Collection) QueryMulti(filters ...Filter) ([]*Document, error) {
+	return c.QueryMultiContext(context.Background(), filters...)
+}
+
+// QueryMultiContext is QueryMulti that stops scanning and returns the
+// context's error once ctx is done
+func (c *Collection) QueryMultiContext(ctx context.Context, filters ...Filter) ([]*Document, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one filter is required")
+	}
+	for _, f := range filters {
+		if err := f.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, f := range filters {
+		if err := c.checkFieldKnownLocked(f.Field); err != nil {
+			return nil, err
+		}
+	}
+
+	// Scan only the documents an indexed filter allows, if there is one
+	candidates, indexed := []*Document(nil), false
+	for _, f := range filters {
+		if candidates, indexed = c.indexedCandidates(f); indexed {
+			break
+		}
+	}
+	if !indexed {
+		candidates = c.allDocumentsLocked()
+	}
+
+	var results []*Document
+	for i, doc := range candidates {
+		if i%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		if matchesAll(doc, filters) {
+			results = append(results, doc)
+		}
+	}
+
+	return c.readDocuments(liveDocuments(results)), nil
+}
+
+// DeleteWhere deletes every document whose field equals value and returns
+// how many were removed. Nothing is deleted from an append-only collection.
+func (c *Collection) DeleteWhere(field string, value interface{}) int {
+	removed, _ := c.DeleteMatching(Filter{Field: field, Value: value})
+	return removed
+}
+
+// DeleteMatching deletes every document matching all of the filters, which
+// may use range operators, and returns how many were removed. The whole
+// deletion happens under a single write lock, so concurrent readers see
+// either none or all of it.
+func (c *Collection) DeleteMatching(filters ...Filter) (int, error) {
+	if len(filters) == 0 {
+		return 0, fmt.Errorf("at least one filter is required")
+	}
+	for _, f := range filters {
+		if err := f.validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	removed := 0
+	err := c.write(func() error {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+		for _, f := range filters {
+			if err := c.checkFieldKnownLocked(f.Field); err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range liveDocuments(c.allDocumentsLocked()) {
+			if matchesAll(doc, filters) {
+				c.removeLocked(doc)
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// allDocumentsLocked returns the stored documents as a slice. Callers must
+// hold c.mu.
+func (c *Collection) allDocumentsLocked() []*Document {
+	docs := make([]*Document, 0, len(c.Documents))
+	for _, doc := range c.Documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// encodedValue keys unhashable values by their JSON encoding without
+// colliding with plain string values
+type encodedValue string
+
+// Distinct returns the unique values of a field across the collection. Numbers
+// are compared after normalization, so 30 and 30.0 count once. Documents
+// without the field are skipped. The order of the result is unspecified.
+func (c *Collection) Distinct(field string) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	seen := make(map[interface{}]bool)
+	values := []interface{}{}
+	for _, doc := range c.Documents {
+		if doc.expired(now) {
+			continue
+		}
+
+		value, exists := lookupPath(doc.Data, field)
+		if !exists {
+			continue
+		}
+
+		key, ok := indexKey(value)
+		if !ok {
+			// Objects and arrays are not hashable, so compare their encoding
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			key = encodedValue(encoded)
+		}
+
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, copyValue(value))
+	}
+
+	return values
+}
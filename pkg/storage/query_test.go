@@ -0,0 +1,496 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollection_QueryFilterLike(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John"})
+	collection.Insert("user2", map[string]interface{}{"name": "JOHANNA"})
+	collection.Insert("user3", map[string]interface{}{"name": "Bob"})
+	collection.Insert("user4", map[string]interface{}{"name": 42})
+
+	results, err := collection.QueryFilter(Filter{Field: "name", Op: OpLike, Value: "oh"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	for _, doc := range results {
+		if doc.ID != "user1" && doc.ID != "user2" {
+			t.Fatalf("Unexpected match %s", doc.ID)
+		}
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "name", Op: OpLike, Value: "xyz"})
+	if len(results) != 0 {
+		t.Fatalf("Expected no results, got %d", len(results))
+	}
+
+	// Non-string values are never matched and non-string patterns are rejected
+	results, _ = collection.QueryFilter(Filter{Field: "name", Op: OpLike, Value: "4"})
+	if len(results) != 0 {
+		t.Fatalf("Expected non-string values not to match, got %d", len(results))
+	}
+
+	if _, err := collection.QueryFilter(Filter{Field: "name", Op: OpLike, Value: 4}); err == nil {
+		t.Fatal("Expected error for non-string like value")
+	}
+}
+
+func TestCollection_QueryFilterUnknownOperator(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	if _, err := collection.QueryFilter(Filter{Field: "name", Op: "near", Value: "x"}); err == nil {
+		t.Fatal("Expected error for unknown operator")
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	data := map[string]interface{}{
+		"name": "John",
+		"address": map[string]interface{}{
+			"city": "NYC",
+			"geo":  map[string]interface{}{"lat": 40.7},
+		},
+		"tags":       []interface{}{"a"},
+		"legacy.key": "dotted",
+	}
+
+	cases := []struct {
+		path   string
+		value  interface{}
+		exists bool
+	}{
+		{"name", "John", true},
+		{"address.city", "NYC", true},
+		{"address.geo.lat", 40.7, true},
+		{"address.zip", nil, false},
+		{"missing.city", nil, false},
+		{"name.first", nil, false},
+		{"tags.0", nil, false},
+		{"legacy.key", "dotted", true},
+	}
+
+	for _, tc := range cases {
+		value, exists := lookupPath(data, tc.path)
+		if exists != tc.exists || value != tc.value {
+			t.Errorf("lookupPath(%q) = %v, %v; expected %v, %v", tc.path, value, exists, tc.value, tc.exists)
+		}
+	}
+
+	if _, exists := lookupPath(nil, "a.b"); exists {
+		t.Error("Expected lookup in nil data to report missing")
+	}
+}
+
+func TestCollection_QueryNestedField(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"address": map[string]interface{}{"city": "NYC"}})
+	collection.Insert("user2", map[string]interface{}{"address": map[string]interface{}{"city": "Boston"}})
+	collection.Insert("user3", map[string]interface{}{"address": "unknown"})
+	collection.Insert("user4", map[string]interface{}{"name": "No address"})
+
+	results := collection.Query("address.city", "NYC")
+	if len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected only user1, got %v", results)
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "address.city", Op: OpLike, Value: "bos"})
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected only user2, got %v", results)
+	}
+
+	sorted := collection.ListSorted("address.city", false)
+	if sorted[0].ID != "user2" || sorted[1].ID != "user1" {
+		t.Fatalf("Expected sort by nested field, got %s, %s", sorted[0].ID, sorted[1].ID)
+	}
+
+	collection.CreateIndex("address.city")
+	results = collection.Query("address.city", "Boston")
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected indexed nested query to find user2, got %v", results)
+	}
+}
+
+func TestCollection_Distinct(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"age": 30, "address": map[string]interface{}{"city": "NYC"}})
+	collection.Insert("user2", map[string]interface{}{"age": float64(30), "address": map[string]interface{}{"city": "NYC"}})
+	collection.Insert("user3", map[string]interface{}{"age": 25, "address": map[string]interface{}{"city": "Boston"}})
+	collection.Insert("user4", map[string]interface{}{"name": "No age"})
+
+	if ages := collection.Distinct("age"); len(ages) != 2 {
+		t.Fatalf("Expected 2 distinct ages, got %v", ages)
+	}
+
+	cities := collection.Distinct("address.city")
+	if len(cities) != 2 {
+		t.Fatalf("Expected 2 distinct cities, got %v", cities)
+	}
+
+	if objects := collection.Distinct("address"); len(objects) != 2 {
+		t.Fatalf("Expected 2 distinct addresses, got %v", objects)
+	}
+
+	if missing := collection.Distinct("missing"); len(missing) != 0 {
+		t.Fatalf("Expected no values for a missing field, got %v", missing)
+	}
+}
+
+func TestCollection_QueryFilterContextCancelled(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := collection.QueryFilterContext(ctx, Filter{Field: "city", Value: "NYC"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCollection_QueryContextCancelled(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "bio": "lives in NYC"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := collection.QueryContext(ctx, "city", "NYC"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from QueryContext, got %v", err)
+	}
+	if _, err := collection.SearchContext(ctx, "nyc", true); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from SearchContext, got %v", err)
+	}
+	if results := collection.Query("city", "NYC"); len(results) != 1 {
+		t.Fatalf("Expected Query to find 1 document, got %d", len(results))
+	}
+}
+
+func TestCollection_QueryFilterCaseInsensitive(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "zip": 10001, "tags": []interface{}{"Admin"}})
+	collection.Insert("user2", map[string]interface{}{"city": "nyc", "zip": "10001"})
+	collection.Insert("user3", map[string]interface{}{"city": "Nyc"})
+	collection.Insert("user4", map[string]interface{}{"city": "Boston"})
+
+	results, _ := collection.QueryFilter(Filter{Field: "city", Value: "nyc"})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 exact match, got %d", len(results))
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "city", Value: "nyc", CaseInsensitive: true})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 case-insensitive matches, got %d", len(results))
+	}
+
+	// Indexed fields still match every case
+	collection.CreateIndex("city")
+	results, _ = collection.QueryFilter(Filter{Field: "city", Value: "NYC", CaseInsensitive: true})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 case-insensitive matches with an index, got %d", len(results))
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "city", Op: OpIn, Value: []interface{}{"nyc", "BOSTON"}, CaseInsensitive: true})
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 case-insensitive in matches, got %d", len(results))
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "tags", Op: OpContains, Value: "admin", CaseInsensitive: true})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 case-insensitive contains match, got %d", len(results))
+	}
+
+	// Numbers compare as numbers and never equal strings
+	results, _ = collection.QueryFilter(Filter{Field: "zip", Value: 10001, CaseInsensitive: true})
+	if len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected only the numeric zip to match, got %d results", len(results))
+	}
+}
+
+func TestCollection_QueryMulti(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.Insert("user1", map[string]interface{}{"city": "NYC", "age": 30})
+	collection.Insert("user2", map[string]interface{}{"city": "nyc", "age": 40})
+	collection.Insert("user3", map[string]interface{}{"city": "Boston", "age": 50})
+	collection.Insert("user4", map[string]interface{}{"city": "Nyc", "age": "40"})
+
+	results, err := collection.QueryMulti(
+		Filter{Field: "city", Value: "nyc", CaseInsensitive: true},
+		Filter{Field: "age", Op: OpGte, Value: 35},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected only user2, got %d results", len(results))
+	}
+
+	// Numbers ignore the flag and never equal strings
+	results, _ = collection.QueryMulti(
+		Filter{Field: "city", Value: "NYC", CaseInsensitive: true},
+		Filter{Field: "age", Value: 40, CaseInsensitive: true},
+	)
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected only the numeric age to match, got %d results", len(results))
+	}
+
+	// An index narrows the scan without changing the results
+	collection.CreateIndex("age")
+	results, _ = collection.QueryMulti(
+		Filter{Field: "age", Value: 40},
+		Filter{Field: "city", Value: "NYC", CaseInsensitive: true},
+	)
+	if len(results) != 1 || results[0].ID != "user2" {
+		t.Fatalf("Expected only user2 with an index, got %d results", len(results))
+	}
+
+	if _, err := collection.QueryMulti(); err == nil {
+		t.Error("Expected an error without filters")
+	}
+	if _, err := collection.QueryMulti(Filter{Field: "city", Op: "bogus"}); err == nil {
+		t.Error("Expected an error for an invalid filter")
+	}
+}
+
+func TestCollection_QueryFilterRange(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("a", map[string]interface{}{"age": 20})
+	collection.Insert("b", map[string]interface{}{"age": 30})
+	collection.Insert("c", map[string]interface{}{"age": 40})
+	collection.Insert("d", map[string]interface{}{"age": "35"})
+
+	results, err := collection.QueryFilter(Filter{Field: "age", Op: OpGte, Value: 30})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	// Strings are never compared against numbers
+	results, _ = collection.QueryFilter(Filter{Field: "age", Op: OpLt, Value: 30})
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("Expected only a, got %v", results)
+	}
+
+	if _, err := collection.QueryFilter(Filter{Field: "age", Op: OpGt, Value: true}); err == nil {
+		t.Fatal("Expected error for non-comparable range value")
+	}
+}
+
+func TestCollection_DeleteWhere(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+	collection.CreateIndex("status")
+
+	collection.Insert("a", map[string]interface{}{"status": "stale", "age": 10})
+	collection.Insert("b", map[string]interface{}{"status": "stale", "age": 50})
+	collection.Insert("c", map[string]interface{}{"status": "fresh", "age": 10})
+
+	if removed := collection.DeleteWhere("status", "missing"); removed != 0 {
+		t.Fatalf("Expected nothing removed, got %d", removed)
+	}
+
+	removed, err := collection.DeleteMatching(
+		Filter{Field: "status", Value: "stale"},
+		Filter{Field: "age", Op: OpLt, Value: 20},
+	)
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected 1 removed, got %d (%v)", removed, err)
+	}
+	if _, err := collection.Get("a"); err == nil {
+		t.Fatal("Expected a to be deleted")
+	}
+
+	if removed := collection.DeleteWhere("status", "stale"); removed != 1 {
+		t.Fatalf("Expected 1 removed, got %d", removed)
+	}
+
+	// The index no longer returns deleted documents
+	results, _ := collection.QueryFilter(Filter{Field: "status", Value: "stale"})
+	if len(results) != 0 {
+		t.Fatalf("Expected index to be updated, got %d results", len(results))
+	}
+	if len(collection.List()) != 1 {
+		t.Fatalf("Expected 1 document left, got %d", len(collection.List()))
+	}
+
+	collection.SetAppendOnly(true)
+	if _, err := collection.DeleteMatching(Filter{Field: "status", Value: "fresh"}); err == nil {
+		t.Fatal("Expected error deleting from an append-only collection")
+	}
+	if len(collection.List()) != 1 {
+		t.Fatal("Expected append-only collection to keep its documents")
+	}
+}
+
+func TestCollection_QueryFilterRegex(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"email": "john@example.com"})
+	collection.Insert("user2", map[string]interface{}{"email": "jane@example.org"})
+	collection.Insert("user3", map[string]interface{}{"email": 42})
+
+	results, err := collection.QueryFilter(Filter{Field: "email", Op: OpRegex, Value: `@example\.com$`})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "user1" {
+		t.Fatalf("Expected only user1, got %v", results)
+	}
+
+	// Non-string values are skipped
+	results, _ = collection.QueryFilter(Filter{Field: "email", Op: OpRegex, Value: `.*`})
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 string matches, got %d", len(results))
+	}
+
+	if _, err := collection.QueryFilter(Filter{Field: "email", Op: OpRegex, Value: `(`}); err == nil {
+		t.Fatal("Expected error for an invalid pattern")
+	}
+	if _, err := collection.QueryFilter(Filter{Field: "email", Op: OpRegex, Value: 1}); err == nil {
+		t.Fatal("Expected error for a non-string pattern")
+	}
+}
+
+func TestCollection_QueryFilterInNin(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("a", map[string]interface{}{"status": "active", "level": 1})
+	collection.Insert("b", map[string]interface{}{"status": "pending", "level": float64(2)})
+	collection.Insert("c", map[string]interface{}{"status": "closed", "level": 3})
+	collection.Insert("d", map[string]interface{}{})
+
+	results, err := collection.QueryFilter(Filter{Field: "status", Op: OpIn, Value: []interface{}{"active", "pending"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	// Numbers compare by value whatever their Go type, as after JSON decoding
+	results, _ = collection.QueryFilter(Filter{Field: "level", Op: OpIn, Value: []interface{}{float64(1), 2}})
+	if len(results) != 2 {
+		t.Fatalf("Expected int and float64 levels to match, got %d results", len(results))
+	}
+	results, _ = collection.QueryFilter(Filter{Field: "level", Op: OpIn, Value: []int{3}})
+	if len(results) != 1 || results[0].ID != "c" {
+		t.Fatalf("Expected a typed slice to work, got %v", results)
+	}
+
+	// Documents without the field are in none of the values
+	results, _ = collection.QueryFilter(Filter{Field: "status", Op: OpNin, Value: []interface{}{"active", "pending"}})
+	if len(results) != 2 {
+		t.Fatalf("Expected c and d, got %d results", len(results))
+	}
+
+	if _, err := collection.QueryFilter(Filter{Field: "status", Op: OpIn, Value: "active"}); err == nil {
+		t.Fatal("Expected error for a non-array value")
+	}
+}
+
+func TestCollection_QueryFilterContains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("a", map[string]interface{}{"tags": []interface{}{"go", "db"}, "scores": []interface{}{1, 2}})
+	collection.Insert("b", map[string]interface{}{"tags": []interface{}{"rust"}, "scores": []interface{}{3}})
+	collection.Insert("c", map[string]interface{}{"tags": "go"})
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+
+	// Arrays loaded from disk hold float64 numbers
+	loaded := NewDatabaseWithPath(path)
+	if err := loaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	collection, _ = loaded.GetCollection("test")
+
+	results, err := collection.QueryFilter(Filter{Field: "scores", Op: OpContains, Value: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("Expected only a, got %v", results)
+	}
+
+	// Non-array fields never match
+	results, _ = collection.QueryFilter(Filter{Field: "tags", Op: OpContains, Value: "go"})
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("Expected only a, got %v", results)
+	}
+}
+
+func TestCollection_QueryFilterExists(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("a", map[string]interface{}{"email": "a@example.com", "address": map[string]interface{}{"city": "Paris"}})
+	collection.Insert("b", map[string]interface{}{"email": nil, "address": map[string]interface{}{}})
+	collection.Insert("c", map[string]interface{}{"name": "C"})
+
+	// A field holding null still exists
+	results, err := collection.QueryFilter(Filter{Field: "email", Op: OpExists})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	results, _ = collection.QueryFilter(Filter{Field: "address.city", Op: OpNotExists})
+	if len(results) != 2 {
+		t.Fatalf("Expected b and c to lack address.city, got %d results", len(results))
+	}
+
+	// Composes with other conditions
+	removed, _ := collection.DeleteMatching(
+		Filter{Field: "email", Op: OpExists},
+		Filter{Field: "address.city", Op: OpNotExists},
+	)
+	if removed != 1 {
+		t.Fatalf("Expected only b to be deleted, got %d", removed)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RawDocument is the complete stored form of a document for debugging and
+// backups. Unlike Document, every internal field is always present, even when
+// empty.
+type RawDocument struct {
+	Collection    string                 `json:"collection"`
+	ID            string                 `json:"id"`
+	Data          map[string]interface{} `json:"data"`
+	Labels        []string               `json:"labels"`
+	Checksum      string                 `json:"checksum"`
+	ChecksumValid bool                   `json:"checksum_valid"`
+	FieldTimes    map[string]time.Time   `json:"field_times"`
+	ExpiresAt     *time.Time             `json:"expires_at"`
+	SchemaVersion int                    `json:"schema_version"`
+	Version       int                    `json:"version"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	CreatedBy     string                 `json:"created_by"`
+	UpdatedBy     string                 `json:"updated_by"`
+}
+
+// GetRaw retrieves the full internal representation of a document by ID
+func (c *Collection) GetRaw(id string) (*RawDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	clone := doc.Clone()
+	raw := &RawDocument{
+		Collection:    c.Name,
+		ID:            clone.ID,
+		Data:          clone.Data,
+		Labels:        clone.Labels,
+		Checksum:      clone.Checksum,
+		ChecksumValid: clone.Checksum != "" && checksumData(clone.Data) == clone.Checksum,
+		FieldTimes:    clone.FieldTimes,
+		ExpiresAt:     clone.ExpiresAt,
+		SchemaVersion: clone.SchemaVersion,
+		Version:       clone.Version,
+		CreatedAt:     clone.CreatedAt,
+		UpdatedAt:     clone.UpdatedAt,
+		CreatedBy:     clone.CreatedBy,
+		UpdatedBy:     clone.UpdatedBy,
+	}
+	if raw.Labels == nil {
+		raw.Labels = []string{}
+	}
+	if raw.FieldTimes == nil {
+		raw.FieldTimes = map[string]time.Time{}
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReservedField is returned when a query or sort uses a field name
+// reserved for document metadata
+var ErrReservedField = errors.New("reserved field name")
+
+// reservedFields are the metadata names that CSV exports and JSON imports
+// place alongside data fields. A document's ID and timestamps live outside
+// its data, and queries and sorts, which only look at data, reject them
+// rather than match nothing.
+var reservedFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// documentIDField is the data key that would shadow a document's ID
+const documentIDField = "id"
+
+// IsReservedField reports whether field is a metadata name that cannot be
+// queried or sorted on
+func IsReservedField(field string) bool {
+	return reservedFields[field]
+}
+
+// withoutDocumentID returns data without a top-level "id" key. The
+// document's own ID is authoritative, so a conflicting copy in its data is
+// dropped rather than stored where exports and readers could mistake it for
+// the real one. The caller's map is copied rather than modified.
+func withoutDocumentID(data map[string]interface{}) map[string]interface{} {
+	if _, exists := data[documentIDField]; !exists {
+		return data
+	}
+
+	stripped := make(map[string]interface{}, len(data)-1)
+	for field, value := range data {
+		if field != documentIDField {
+			stripped[field] = value
+		}
+	}
+	return stripped
+}
+
+// checkQueryField rejects queries and sorts on a reserved field
+func checkQueryField(field string) error {
+	if reservedFields[field] {
+		return fmt.Errorf("%w: '%s' is document metadata and cannot be queried", ErrReservedField, field)
+	}
+	return nil
+}
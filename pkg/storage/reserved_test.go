@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCollection_ReservedFields(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	data := map[string]interface{}{"id": "other", "name": "John", "created_at": "yesterday", "profile": map[string]interface{}{"id": "nested"}}
+	if err := collection.Insert("user1", data); err != nil {
+		t.Fatalf("Expected no error inserting data with an id, got %v", err)
+	}
+	if _, exists := data["id"]; !exists {
+		t.Fatal("Expected the caller's data to be left untouched")
+	}
+	doc, _ := collection.Get("user1")
+	if _, exists := doc.Data["id"]; exists || doc.Data["name"] != "John" || doc.Data["created_at"] != "yesterday" {
+		t.Fatalf("Expected only the conflicting id to be dropped, got %v", doc.Data)
+	}
+
+	// Nested keys are ordinary data and can be queried
+	if results := collection.Query("profile.id", "nested"); len(results) != 1 {
+		t.Fatalf("Expected 1 result for a nested id, got %d", len(results))
+	}
+
+	collection.Update("user1", map[string]interface{}{"id": "user2", "name": "Jane"})
+	collection.Merge("user1", map[string]interface{}{"id": "user3", "age": 30})
+	if doc, _ := collection.Get("user1"); doc.ID != "user1" || doc.Data["id"] != nil || doc.Data["name"] != "Jane" || doc.Data["age"] != 30 {
+		t.Fatalf("Expected updates to drop the id and keep the rest, got %s: %v", doc.ID, doc.Data)
+	}
+
+	tx := db.Begin()
+	tx.Insert("test", "user2", map[string]interface{}{"id": "user3"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Expected no error from the transaction, got %v", err)
+	}
+	if doc, err := collection.Get("user2"); err != nil || doc.Data["id"] != nil {
+		t.Fatalf("Expected the transaction to insert user2 without its id, got %v", err)
+	}
+
+	if _, err := collection.QueryFilter(Filter{Field: "id", Value: "user1"}); !errors.Is(err, ErrReservedField) {
+		t.Fatalf("Expected ErrReservedField querying id, got %v", err)
+	}
+	if _, err := collection.QueryContext(context.Background(), "created_at", "x"); !errors.Is(err, ErrReservedField) {
+		t.Fatalf("Expected ErrReservedField querying created_at, got %v", err)
+	}
+}
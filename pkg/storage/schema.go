@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// InferSchema scans the collection and returns every field path present in
+// at least one document, in dot notation, mapped to the sorted JSON types
+// observed for it ("string", "number", "boolean", "object", "array" or
+// "null").
+func (c *Collection) InferSchema() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.inferSchemaLocked()
+}
+
+func (c *Collection) inferSchemaLocked() map[string][]string {
+	seen := make(map[string]map[string]bool)
+	for _, doc := range c.Documents {
+		collectFieldTypes(doc.Data, "", seen)
+	}
+
+	schema := make(map[string][]string, len(seen))
+	for path, types := range seen {
+		list := make([]string, 0, len(types))
+		for t := range types {
+			list = append(list, t)
+		}
+		sort.Strings(list)
+		schema[path] = list
+	}
+
+	return schema
+}
+
+func collectFieldTypes(data map[string]interface{}, prefix string, seen map[string]map[string]bool) {
+	for key, value := range data {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if seen[path] == nil {
+			seen[path] = make(map[string]bool)
+		}
+		seen[path][jsonType(value)] = true
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			collectFieldTypes(nested, path, seen)
+		}
+	}
+}
+
+// jsonType names the JSON type of a value
+func jsonType(v interface{}) string {
+	if _, ok := toFloat64(v); ok {
+		return "number"
+	}
+
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "unknown"
+}
+
+// SetStrictQueries enables or disables strict query mode. In strict mode,
+// QueryFilter rejects filters on fields that no document in the collection
+// has, which usually indicates a typo.
+func (c *Collection) SetStrictQueries(strict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.StrictQueries = strict
+	c.markDirty()
+}
+
+// checkFieldKnownLocked returns a descriptive error when strict queries are
+// enabled and no document has field. Callers must hold c.mu.
+func (c *Collection) checkFieldKnownLocked(field string) error {
+	if !c.StrictQueries {
+		return nil
+	}
+
+	for _, doc := range c.Documents {
+		if _, exists := lookupPath(doc.Data, field); exists {
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("field '%s' does not appear in any document in collection '%s'", field, c.Name)
+	if suggestion := closestField(field, c.inferSchemaLocked()); suggestion != "" {
+		msg += fmt.Sprintf("; did you mean '%s'?", suggestion)
+	}
+
+	return fmt.Errorf("%s", msg)
+}
+
+// closestField returns the known field nearest to field by edit distance, if
+// any is close enough to plausibly be what was meant
+func closestField(field string, schema map[string][]string) string {
+	best, bestDistance := "", 3
+	for candidate := range schema {
+		d := editDistance(field, candidate)
+		if d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	if bestDistance > 2 {
+		return ""
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollection_InferSchema(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{
+		"name":    "John",
+		"age":     30,
+		"address": map[string]interface{}{"city": "NYC"},
+	})
+	collection.Insert("user2", map[string]interface{}{"name": "Jane", "age": "unknown"})
+
+	schema := collection.InferSchema()
+
+	if types := schema["age"]; len(types) != 2 || types[0] != "number" || types[1] != "string" {
+		t.Fatalf("Expected age to be number and string, got %v", types)
+	}
+
+	if types := schema["address.city"]; len(types) != 1 || types[0] != "string" {
+		t.Fatalf("Expected nested address.city field, got %v", types)
+	}
+
+	if _, exists := schema["address"]; !exists {
+		t.Fatal("Expected object field address")
+	}
+}
+
+func TestCollection_StrictQueries(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "city": "NYC"})
+
+	// Off by default: a typo silently matches nothing
+	results, err := collection.QueryFilter(Filter{Field: "ctiy", Value: "NYC"})
+	if err != nil || len(results) != 0 {
+		t.Fatalf("Expected no error and no results, got %v, %v", results, err)
+	}
+
+	collection.SetStrictQueries(true)
+
+	_, err = collection.QueryFilter(Filter{Field: "ctiy", Value: "NYC"})
+	if err == nil {
+		t.Fatal("Expected error querying a field no document has")
+	}
+	if !strings.Contains(err.Error(), "'ctiy'") || !strings.Contains(err.Error(), "did you mean 'city'") {
+		t.Fatalf("Expected a helpful message, got %q", err.Error())
+	}
+
+	// Known fields still work, even when nothing matches the value
+	results, err = collection.QueryFilter(Filter{Field: "city", Value: "Boston"})
+	if err != nil || len(results) != 0 {
+		t.Fatalf("Expected no error and no results, got %v, %v", results, err)
+	}
+}
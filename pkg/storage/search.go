@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Search returns the documents, ordered by creation time, with a string
+// value anywhere in their data, including nested objects and arrays, that
+// contains term. An empty term matches nothing.
+func (c *Collection) Search(term string, caseInsensitive bool) []*Document {
+	results, _ := c.SearchContext(context.Background(), term, caseInsensitive)
+	return results
+}
+
+// SearchContext is Search that stops scanning and returns the context's
+// error once ctx is done
+func (c *Collection) SearchContext(ctx context.Context, term string, caseInsensitive bool) ([]*Document, error) {
+	if term == "" {
+		return []*Document{}, nil
+	}
+	if caseInsensitive {
+		term = strings.ToLower(term)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	results := []*Document{}
+	scanned := 0
+	for _, doc := range c.Documents {
+		if scanned%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scanned++
+
+		if !doc.expired(now) && containsText(doc.Data, term, caseInsensitive) {
+			results = append(results, doc)
+		}
+	}
+
+	sortByCreation(results)
+	return c.readDocuments(results), nil
+}
+
+// containsText reports whether any string within value contains term, which
+// must already be lower case when caseInsensitive is set
+func containsText(value interface{}, term string, caseInsensitive bool) bool {
+	switch v := value.(type) {
+	case string:
+		if caseInsensitive {
+			v = strings.ToLower(v)
+		}
+		return strings.Contains(v, term)
+	case map[string]interface{}:
+		for _, nested := range v {
+			if containsText(nested, term, caseInsensitive) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if containsText(nested, term, caseInsensitive) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package storage
+
+import "testing"
+
+func TestCollection_Search(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("a", map[string]interface{}{"title": "Learning Go"})
+	collection.Insert("b", map[string]interface{}{"meta": map[string]interface{}{"tags": []interface{}{"golang", "db"}}})
+	collection.Insert("c", map[string]interface{}{"title": "Rust", "year": 2015})
+
+	results := collection.Search("go", true)
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Fatalf("Expected a and b in creation order, got %v", results)
+	}
+
+	results = collection.Search("Go", false)
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("Expected only a for a case-sensitive search, got %v", results)
+	}
+
+	// Only strings are searched
+	if results := collection.Search("2015", true); len(results) != 0 {
+		t.Fatalf("Expected numbers not to match, got %d results", len(results))
+	}
+	if results := collection.Search("", true); len(results) != 0 {
+		t.Fatalf("Expected an empty term to match nothing, got %d results", len(results))
+	}
+}
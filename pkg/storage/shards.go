@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A collection with its own save interval is persisted in a shard file of
+// its own, in a directory next to the data file, instead of in the data file
+// itself. Auto-save writes each shard only when the collection has changed
+// and its interval has passed, and writes the data file only when one of the
+// other collections has changed, so a busy collection that can afford to
+// lose recent writes does not force frequent saves of everything else.
+
+// snapshotFile is the layout of the data file: the collections it holds and
+// the names of those saved to shard files
+type snapshotFile struct {
+	Collections map[string]*Collection `json:"collections"`
+	Shards      []string               `json:"shards,omitempty"`
+}
+
+// shardFile is a serialized collection waiting to be written to its shard
+type shardFile struct {
+	collection *Collection
+	name       string
+	data       []byte
+}
+
+// SetSaveInterval persists the collection in its own shard file, saved by
+// auto-save at most once per interval rather than on every auto-save tick.
+// Intervals are checked on auto-save ticks, so they are rounded up to the
+// auto-save interval. SaveToDisk still writes every collection. Zero moves
+// the collection back into the data file.
+func (c *Collection) SetSaveInterval(interval time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("save interval must not be negative")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.SaveInterval = interval
+	// The data file lists the collections saved to shards
+	c.dirty.Store(true)
+	if c.db != nil {
+		c.db.markDirty()
+	}
+	return nil
+}
+
+// GetSaveInterval returns the collection's own save interval, or zero when
+// it is saved with the data file
+func (c *Collection) GetSaveInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.SaveInterval
+}
+
+// shardDir is the directory holding the data file's collection shards
+func (db *Database) shardDir() string {
+	return db.dataFile + ".collections"
+}
+
+// shardPath is the shard file of the named collection
+func (db *Database) shardPath(name string) string {
+	return filepath.Join(db.shardDir(), name+".json")
+}
+
+// saveDue writes the parts of the database that auto-save should persist
+// now: the data file if a collection saved in it has changed, and the shard
+// of every changed collection whose save interval has passed
+func (db *Database) saveDue() error {
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+
+	_, err := db.saveLocked(false)
+	return err
+}
+
+// saveLocked writes the data file and collection shards, every one of them
+// when full is set and only those due otherwise, and reports whether
+// anything was written. Shards are written before the data file listing
+// them. Callers must hold saveMu.
+func (db *Database) saveLocked(full bool) (bool, error) {
+	main, shards, err := db.marshalSave(full, time.Now())
+	if err != nil {
+		err = fmt.Errorf("failed to marshal database: %w", err)
+		db.recordSaveFailure(err)
+		return false, err
+	}
+	if main == nil && len(shards) == 0 {
+		return false, nil
+	}
+
+	if len(shards) > 0 {
+		if err := os.MkdirAll(db.shardDir(), 0755); err != nil {
+			err = fmt.Errorf("failed to create collection directory: %w", err)
+			db.saveFailedLocked(main, shards, err)
+			return false, err
+		}
+	}
+	for i, shard := range shards {
+		if err := db.writeFile(db.shardPath(shard.name), db.encodeFile(shard.data)); err != nil {
+			err = fmt.Errorf("failed to write collection file '%s': %w", shard.name, err)
+			db.saveFailedLocked(main, shards[i:], err)
+			return false, err
+		}
+		shard.collection.savedAs = shard.name
+		shard.collection.savedAt = time.Now()
+	}
+
+	if main != nil {
+		if err := db.writeFile(db.dataFile, db.encodeFile(main)); err != nil {
+			err = fmt.Errorf("failed to write data file: %w", err)
+			db.saveFailedLocked(main, nil, err)
+			return false, err
+		}
+		db.removeStaleShards()
+	}
+
+	db.lastSave.Store(time.Now().UnixNano())
+	db.recordSaveSuccess()
+	return true, nil
+}
+
+// saveFailedLocked marks what a failed save did not write as dirty again
+// and counts the failure. Callers must hold saveMu.
+func (db *Database) saveFailedLocked(main []byte, unwritten []shardFile, err error) {
+	if main != nil {
+		db.markDirty()
+	}
+	for _, shard := range unwritten {
+		shard.collection.dirty.Store(true)
+	}
+	db.recordSaveFailure(err)
+}
+
+// marshalSave serializes a consistent snapshot of what a save writes: the
+// data file, or nil when it is not written, and the collection shards. The
+// dirty flags of what is serialized are cleared as part of the snapshot, so
+// writes that land afterwards mark it dirty again. Callers must hold saveMu.
+func (db *Database) marshalSave(full bool, now time.Time) ([]byte, []shardFile, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Hold every collection's read lock so documents can't change while
+	// they are being serialized
+	names := db.collectionNamesLocked()
+	for _, name := range names {
+		collection := db.Collections[name]
+		collection.mu.RLock()
+		defer collection.mu.RUnlock()
+	}
+
+	snapshot := snapshotFile{Collections: make(map[string]*Collection, len(names))}
+	var shards []shardFile
+	for _, name := range names {
+		collection := db.Collections[name]
+		if collection.SaveInterval == 0 {
+			collection.savedAs = ""
+			snapshot.Collections[name] = collection
+			continue
+		}
+
+		snapshot.Shards = append(snapshot.Shards, name)
+		due := collection.dirty.Load() && now.Sub(collection.savedAt) >= collection.SaveInterval
+		if !full && !due && collection.savedAs == name {
+			continue
+		}
+
+		data, err := json.MarshalIndent(collection, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		collection.dirty.Store(false)
+		shards = append(shards, shardFile{collection: collection, name: name, data: data})
+	}
+
+	if !full && !db.isDirty() {
+		return nil, shards, nil
+	}
+	main, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		for _, shard := range shards {
+			shard.collection.dirty.Store(true)
+		}
+		return nil, nil, err
+	}
+	db.dirty.Store(false)
+	return main, shards, nil
+}
+
+// encodeFile returns a function writing data, gzipped when the database
+// compresses its files
+func (db *Database) encodeFile(data []byte) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		if !db.compress {
+			_, err := w.Write(data)
+			return err
+		}
+
+		gz := gzip.NewWriter(w)
+		if _, err := gz.Write(data); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+}
+
+// removeStaleShards deletes shard files of collections that were deleted,
+// renamed or moved back into the data file. It runs after the data file is
+// written, which no longer lists them; failures only leave unused files.
+func (db *Database) removeStaleShards() {
+	entries, err := os.ReadDir(db.shardDir())
+	if err != nil {
+		return
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if collection, exists := db.Collections[name]; exists && collection.savedAs == name {
+			continue
+		}
+		os.Remove(filepath.Join(db.shardDir(), entry.Name()))
+	}
+}
+
+// loadShards reads the named collection shards into collections, replacing
+// any collection of the same name. Every listed shard must exist.
+func (db *Database) loadShards(collections map[string]*Collection, names []string) error {
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validateCollectionName(name); err != nil {
+			return fmt.Errorf("invalid collection file: %w", err)
+		}
+
+		data, err := os.ReadFile(db.shardPath(name))
+		if err != nil {
+			return fmt.Errorf("failed to read collection file '%s': %w", name, err)
+		}
+		data, err = decompress(data)
+		if err != nil {
+			return fmt.Errorf("failed to decompress collection file '%s': %w", name, err)
+		}
+
+		var collection Collection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return fmt.Errorf("failed to unmarshal collection file '%s': %w", name, err)
+		}
+		collection.Name = name
+		collection.savedAs = name
+		collection.savedAt = time.Now()
+		collections[name] = &collection
+	}
+	return nil
+}
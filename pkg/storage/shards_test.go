@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollection_SaveIntervals(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithPath(dataFile)
+
+	db.CreateCollection("ledger")
+	db.CreateCollection("cache")
+	ledger, _ := db.GetCollection("ledger")
+	cache, _ := db.GetCollection("cache")
+	ledger.SetSaveInterval(10 * time.Millisecond)
+	cache.SetSaveInterval(time.Hour)
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+
+	// saved counts the documents in a collection's own file
+	saved := func(name string) int {
+		data, err := os.ReadFile(db.shardPath(name))
+		if err != nil {
+			t.Fatalf("Expected the collection in its own file, got %v", err)
+		}
+		var collection Collection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			t.Fatalf("Expected a valid collection file, got %v", err)
+		}
+		return len(collection.Documents)
+	}
+
+	stop := db.StartAutoSave(5 * time.Millisecond)
+	defer stop()
+	for i := 0; i < 20; i++ {
+		ledger.Insert("entry"+strconv.Itoa(i), map[string]interface{}{"amount": i})
+		cache.Insert("key"+strconv.Itoa(i), map[string]interface{}{"value": i})
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for saved("ledger") < 20 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := saved("ledger"); n != 20 {
+		t.Fatalf("Expected the frequently saved collection to be saved with every entry, got %d", n)
+	}
+	if n := saved("cache"); n != 0 {
+		t.Fatalf("Expected the rarely saved collection not to be saved again yet, got %d documents", n)
+	}
+}
+
+func TestDatabase_ShardsPersist(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithOptions(Options{DataFile: dataFile, Compress: true})
+	db.CreateCollection("users")
+	db.CreateCollection("cache")
+	users, _ := db.GetCollection("users")
+	cache, _ := db.GetCollection("cache")
+	users.Insert("user1", map[string]interface{}{"name": "John"})
+	cache.Insert("key1", map[string]interface{}{"value": 1})
+	cache.SetSaveInterval(time.Minute)
+
+	if err := cache.SetSaveInterval(-time.Minute); err == nil {
+		t.Fatal("Expected error for a negative save interval")
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	if _, err := os.Stat(db.shardPath("cache")); err != nil {
+		t.Fatalf("Expected the collection in its own file, got %v", err)
+	}
+
+	db2 := NewDatabaseWithPath(dataFile)
+	if err := db2.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	loaded, err := db2.GetCollection("cache")
+	if err != nil {
+		t.Fatalf("Expected the collection to be loaded from its own file, got %v", err)
+	}
+	if doc, err := loaded.Get("key1"); err != nil || doc.Data["value"] != float64(1) {
+		t.Fatalf("Expected the saved document, got %v, %v", doc, err)
+	}
+	if loaded.GetSaveInterval() != time.Minute {
+		t.Fatalf("Expected the save interval to persist, got %v", loaded.GetSaveInterval())
+	}
+	if _, err := db2.GetCollection("users"); err != nil {
+		t.Fatalf("Expected the data file's collection, got %v", err)
+	}
+
+	// Backups hold every collection and restore into any database
+	var backup bytes.Buffer
+	if err := db2.Backup(&backup); err != nil {
+		t.Fatalf("Expected no error backing up, got %v", err)
+	}
+	restored := NewDatabase()
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Expected no error restoring, got %v", err)
+	}
+	if _, err := restored.GetCollection("cache"); err != nil {
+		t.Fatalf("Expected the backup to include the collection, got %v", err)
+	}
+
+	// The data file alone is not a complete snapshot
+	raw, _ := os.ReadFile(dataFile)
+	if err := NewDatabase().Restore(bytes.NewReader(raw)); err == nil || !strings.Contains(err.Error(), "cache") {
+		t.Fatalf("Expected restoring the data file alone to fail, got %v", err)
+	}
+
+	// A collection moved back into the data file leaves no shard behind
+	loaded.SetSaveInterval(0)
+	if err := db2.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving, got %v", err)
+	}
+	if _, err := os.Stat(db2.shardPath("cache")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the stale collection file to be removed, got %v", err)
+	}
+	db3 := NewDatabaseWithPath(dataFile)
+	if err := db3.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading, got %v", err)
+	}
+	if c, err := db3.GetCollection("cache"); err != nil || len(c.List()) != 1 {
+		t.Fatalf("Expected the collection back in the data file, got %v", err)
+	}
+}
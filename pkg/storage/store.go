@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"io"
+	"time"
+)
+
+// Store is the storage backend the HTTP server runs on. It covers managing
+// collections, persistence, backups, transactions, change feeds and
+// statistics. Document operations such as Insert, Get, Update, Delete, List
+// and Query are made on the Collection returned by GetCollection.
+type Store interface {
+	// Collections
+	CreateCollection(name string) error
+	GetCollection(name string) (*Collection, error)
+	DeleteCollection(name string) error
+	CopyCollection(src, dst string) error
+	RenameCollection(oldName, newName string) error
+	ListCollections() []string
+	ListCollectionInfo() []CollectionInfo
+
+	// Persistence and backups
+	SaveToDisk() error
+	CheckPersistence() error
+	LastSave() time.Time
+	SaveStatus() SaveStatus
+	Backup(w io.Writer) error
+	Restore(r io.Reader) error
+	Reset()
+
+	// Transactions and change feeds
+	BeginAs(principal string) *Transaction
+	Subscribe(collection string, buffer int) (<-chan ChangeEvent, func(), error)
+	SubscriberCount() int
+
+	// Statistics and diagnostics
+	Stats() map[string]interface{}
+	StatsStruct() Stats
+	DocumentCount() int
+	VerifyChecksums() map[string][]string
+	BackgroundJobs() map[string]bool
+}
+
+// MemStore is the built-in Store: documents are held in memory and
+// persisted as a JSON file
+type MemStore = Database
+
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore creates an empty in-memory store with the default data file,
+// like NewDatabase
+func NewMemStore() *MemStore {
+	return NewDatabase()
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Conflict resolution strategies for SyncMerge
+const (
+	// ResolveLastWriterWins keeps whichever write to a field happened last
+	ResolveLastWriterWins = "last-writer-wins"
+	// ResolveServerWins keeps the stored value of a field once it exists
+	ResolveServerWins = "server-wins"
+	// ResolveClientWins always applies the incoming value
+	ResolveClientWins = "client-wins"
+)
+
+// SetConflictResolution configures how SyncMerge resolves conflicting writes
+// to a top-level field. Fields without a configured strategy use
+// last-writer-wins.
+func (c *Collection) SetConflictResolution(field, strategy string) error {
+	switch strategy {
+	case ResolveLastWriterWins, ResolveServerWins, ResolveClientWins:
+	default:
+		return fmt.Errorf("unknown conflict resolution '%s'", strategy)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.FieldResolution == nil {
+		c.FieldResolution = make(map[string]string)
+	}
+	c.FieldResolution[field] = strategy
+	c.markDirty()
+
+	return nil
+}
+
+// SyncMerge merges changes made by an offline client into a document. Only
+// the top-level fields present in data are considered, so concurrent edits
+// to different fields by different clients are all preserved. When a field
+// was also written elsewhere, the collection's conflict resolution for that
+// field decides which value is kept; by default the write with the later
+// modifiedAt wins. A missing document is created. SyncMerge returns the
+// fields whose incoming values were applied.
+func (c *Collection) SyncMerge(id string, data map[string]interface{}, modifiedAt time.Time) ([]string, error) {
+	return c.SyncMergeAs("", id, data, modifiedAt)
+}
+
+// SyncMergeAs merges offline changes, recording principal as the document's
+// writer
+func (c *Collection) SyncMergeAs(principal, id string, data map[string]interface{}, modifiedAt time.Time) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists {
+		if err := c.insertLocked(id, data, principal); err != nil {
+			return nil, err
+		}
+
+		doc = c.Documents[id]
+		doc.FieldTimes = make(map[string]time.Time, len(data))
+		applied := make([]string, 0, len(data))
+		for field := range data {
+			doc.FieldTimes[field] = modifiedAt
+			applied = append(applied, field)
+		}
+		return applied, nil
+	}
+
+	if err := c.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	merged := copyMap(doc.Data)
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+	fieldTimes := make(map[string]time.Time, len(doc.FieldTimes)+len(data))
+	for field, t := range doc.FieldTimes {
+		fieldTimes[field] = t
+	}
+
+	var applied []string
+	for field, value := range data {
+		_, present := merged[field]
+		lastWrite, tracked := fieldTimes[field]
+		if !tracked {
+			lastWrite = doc.UpdatedAt
+		}
+
+		apply := true
+		switch c.FieldResolution[field] {
+		case ResolveServerWins:
+			apply = !present
+		case ResolveClientWins:
+		default:
+			apply = !present || !modifiedAt.Before(lastWrite)
+		}
+
+		if apply {
+			merged[field] = value
+			fieldTimes[field] = modifiedAt
+			applied = append(applied, field)
+		}
+	}
+
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	if err := c.updateLocked(id, merged, principal); err != nil {
+		return nil, err
+	}
+	doc.FieldTimes = fieldTimes
+
+	return applied, nil
+}
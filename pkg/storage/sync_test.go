@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollection_SyncMergeDifferentFields(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	collection.Insert("user1", map[string]interface{}{"name": "John", "age": 30, "city": "New York"})
+	base := time.Now()
+
+	// Two offline clients each edit a different field; client B syncs last
+	// but made its edit first
+	if _, err := collection.SyncMerge("user1", map[string]interface{}{"name": "Johnny"}, base.Add(2*time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := collection.SyncMerge("user1", map[string]interface{}{"age": 31}, base.Add(time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "Johnny" || doc.Data["age"] != 31 || doc.Data["city"] != "New York" {
+		t.Fatalf("Expected both clients' changes to be preserved, got %v", doc.Data)
+	}
+}
+
+func TestCollection_SyncMergeConflicts(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("test")
+	collection, _ := db.GetCollection("test")
+
+	base := time.Now()
+	collection.SyncMerge("user1", map[string]interface{}{"name": "John", "status": "new"}, base)
+
+	// An older edit to the same field loses under last-writer-wins
+	applied, _ := collection.SyncMerge("user1", map[string]interface{}{"name": "Stale"}, base.Add(-time.Second))
+	if len(applied) != 0 {
+		t.Fatalf("Expected stale write to be rejected, applied %v", applied)
+	}
+
+	applied, _ = collection.SyncMerge("user1", map[string]interface{}{"name": "Fresh"}, base.Add(time.Second))
+	if len(applied) != 1 {
+		t.Fatalf("Expected newer write to be applied, applied %v", applied)
+	}
+
+	// Server-wins keeps the stored value regardless of timestamps
+	if err := collection.SetConflictResolution("status", ResolveServerWins); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	collection.SyncMerge("user1", map[string]interface{}{"status": "changed"}, base.Add(time.Hour))
+
+	doc, _ := collection.Get("user1")
+	if doc.Data["name"] != "Fresh" || doc.Data["status"] != "new" {
+		t.Fatalf("Unexpected merge result %v", doc.Data)
+	}
+
+	if err := collection.SetConflictResolution("status", "coin-flip"); err == nil {
+		t.Fatal("Expected error for unknown resolution")
+	}
+}
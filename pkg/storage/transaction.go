@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrTxDone is returned when operating on a transaction that has already
+// been committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// OperationError reports which buffered operation of a transaction or batch
+// failed. Index is zero-based.
+type OperationError struct {
+	Index int
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index+1, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// TxOperation is a document write buffered in a transaction. Op is one of
+// ChangeInsert, ChangeUpdate or ChangeDelete.
+type TxOperation struct {
+	Op         string                 `json:"op"`
+	Collection string                 `json:"collection"`
+	ID         string                 `json:"id"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// Transaction buffers document writes across any number of collections and
+// applies them atomically on Commit
+type Transaction struct {
+	db        *Database
+	principal string
+	ops       []TxOperation
+	done      bool
+}
+
+// Begin starts a transaction
+func (db *Database) Begin() *Transaction {
+	return db.BeginAs("")
+}
+
+// BeginAs starts a transaction whose writes are recorded as made by principal
+func (db *Database) BeginAs(principal string) *Transaction {
+	return &Transaction{db: db, principal: principal}
+}
+
+// Insert buffers inserting a document
+func (tx *Transaction) Insert(collection, id string, data map[string]interface{}) error {
+	return tx.Add(TxOperation{Op: ChangeInsert, Collection: collection, ID: id, Data: data})
+}
+
+// Update buffers replacing a document's data
+func (tx *Transaction) Update(collection, id string, data map[string]interface{}) error {
+	return tx.Add(TxOperation{Op: ChangeUpdate, Collection: collection, ID: id, Data: data})
+}
+
+// Delete buffers deleting a document
+func (tx *Transaction) Delete(collection, id string) error {
+	return tx.Add(TxOperation{Op: ChangeDelete, Collection: collection, ID: id})
+}
+
+// Add buffers an operation. Nothing is written until Commit.
+func (tx *Transaction) Add(op TxOperation) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	switch op.Op {
+	case ChangeInsert, ChangeUpdate, ChangeDelete:
+	default:
+		return fmt.Errorf("unknown operation type '%s'", op.Op)
+	}
+
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// Rollback discards the buffered operations
+func (tx *Transaction) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+// Commit applies the buffered operations in order. Every collection involved
+// is locked for the whole commit and every operation is checked before the
+// first is applied, so if any would fail none are applied and readers never
+// see part of the transaction.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	db := tx.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Lock collections in name order so concurrent commits cannot deadlock
+	collections := make(map[string]*Collection)
+	names := []string{}
+	for i, op := range tx.ops {
+		if _, seen := collections[op.Collection]; seen {
+			continue
+		}
+		collection, exists := db.Collections[op.Collection]
+		if !exists {
+			return &OperationError{Index: i, Err: fmt.Errorf("%w: '%s'", ErrCollectionNotFound, op.Collection)}
+		}
+		collections[op.Collection] = collection
+		names = append(names, op.Collection)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		collections[name].mu.Lock()
+		defer collections[name].mu.Unlock()
+	}
+
+	return tx.applyLocked(collections)
+}
+
+// applyLocked checks every operation and, if all would succeed, applies
+// them. Callers must hold the write lock of every collection involved.
+func (tx *Transaction) applyLocked(collections map[string]*Collection) error {
+	claims, err := tx.checkLocked(collections)
+	if err != nil {
+		return err
+	}
+	if err := tx.db.claimIDs(claims); err != nil {
+		return err
+	}
+
+	for i, op := range tx.ops {
+		collection := collections[op.Collection]
+
+		var err error
+		switch op.Op {
+		case ChangeInsert:
+			err = collection.insertLocked(op.ID, op.Data, tx.principal)
+		case ChangeUpdate:
+			err = collection.updateLocked(op.ID, op.Data, tx.principal)
+		case ChangeDelete:
+			err = collection.deleteLocked(op.ID)
+		}
+		if err != nil {
+			return &OperationError{Index: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// checkLocked verifies that every operation would succeed when applied in
+// order, and returns the IDs each collection would claim by inserting.
+// Callers must hold the write lock of every collection involved.
+func (tx *Transaction) checkLocked(collections map[string]*Collection) (map[string]string, error) {
+	type docKey struct{ collection, id string }
+	type valueKey struct {
+		collection, field string
+		key               interface{}
+	}
+	exists := make(map[docKey]bool)
+	claims := make(map[string]string)
+	// Unique index values and document data as they stand after the
+	// operations checked so far. An empty owner marks a released value.
+	owners := make(map[valueKey]string)
+	data := make(map[docKey]map[string]interface{})
+	now := time.Now()
+
+	for i, op := range tx.ops {
+		collection := collections[op.Collection]
+		id := collection.normalizeID(op.ID)
+		if id == "" {
+			return nil, &OperationError{Index: i, Err: fmt.Errorf("document ID is required")}
+		}
+
+		key := docKey{op.Collection, id}
+		present, tracked := exists[key]
+		if !tracked {
+			doc, stored := collection.Documents[id]
+			present = stored && !doc.expired(now)
+		}
+
+		switch op.Op {
+		case ChangeInsert:
+			if present {
+				return nil, &OperationError{Index: i, Err: fmt.Errorf("%w: '%s'", ErrDocumentExists, id)}
+			}
+			if owner, claimed := claims[id]; claimed && owner != op.Collection && tx.db.GlobalIDUniqueness() {
+				return nil, &OperationError{Index: i, Err: fmt.Errorf("%w: '%s' already exists in collection '%s'", ErrDuplicateID, id, owner)}
+			}
+			claims[id] = op.Collection
+			exists[key] = true
+		case ChangeUpdate, ChangeDelete:
+			if err := collection.checkWritable(); err != nil {
+				return nil, &OperationError{Index: i, Err: err}
+			}
+			if !present {
+				return nil, &OperationError{Index: i, Err: fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)}
+			}
+			exists[key] = op.Op == ChangeUpdate
+		}
+
+		if !collection.hasUniqueIndexLocked() {
+			continue
+		}
+		previous, tracked := data[key]
+		if !tracked && present {
+			previous = collection.Documents[id].Data
+		}
+		for field, value := range collection.uniqueKeys(previous) {
+			owners[valueKey{op.Collection, field, value}] = ""
+		}
+		if op.Op == ChangeDelete {
+			data[key] = nil
+			continue
+		}
+		for field, value := range collection.uniqueKeys(op.Data) {
+			vk := valueKey{op.Collection, field, value}
+			owner, tracked := owners[vk]
+			if !tracked {
+				owner = collection.uniqueOwnerLocked(field, value, id)
+			}
+			if owner != "" && owner != id {
+				return nil, &OperationError{Index: i, Err: uniqueViolation(field, value, owner)}
+			}
+			owners[vk] = id
+		}
+		data[key] = op.Data
+	}
+
+	return claims, nil
+}
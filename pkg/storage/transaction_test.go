@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransaction_Commit(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("accounts")
+	db.CreateCollection("ledger")
+	accounts, _ := db.GetCollection("accounts")
+	ledger, _ := db.GetCollection("ledger")
+
+	accounts.Insert("alice", map[string]interface{}{"balance": 100})
+	accounts.Insert("bob", map[string]interface{}{"balance": 0})
+	ledger.Insert("old", map[string]interface{}{})
+
+	tx := db.Begin()
+	tx.Update("accounts", "alice", map[string]interface{}{"balance": 60})
+	tx.Update("accounts", "bob", map[string]interface{}{"balance": 40})
+	tx.Insert("ledger", "t1", map[string]interface{}{"amount": 40})
+	tx.Delete("ledger", "old")
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	bob, _ := accounts.Get("bob")
+	if bob.Data["balance"] != 40 {
+		t.Fatalf("Expected bob's balance to be 40, got %v", bob.Data["balance"])
+	}
+	if _, err := ledger.Get("t1"); err != nil {
+		t.Fatal("Expected ledger entry to be inserted")
+	}
+	if _, err := ledger.Get("old"); err == nil {
+		t.Fatal("Expected old ledger entry to be deleted")
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("Expected ErrTxDone on second commit, got %v", err)
+	}
+}
+
+func TestTransaction_FailureLeavesNoPartialWrites(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("accounts")
+	accounts, _ := db.GetCollection("accounts")
+	accounts.Insert("alice", map[string]interface{}{"balance": 100})
+
+	tx := db.Begin()
+	tx.Update("accounts", "alice", map[string]interface{}{"balance": 60})
+	tx.Insert("accounts", "carol", map[string]interface{}{"balance": 0})
+	tx.Update("accounts", "missing", map[string]interface{}{"balance": 40})
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected error updating a missing document")
+	}
+
+	alice, _ := accounts.Get("alice")
+	if alice.Data["balance"] != 100 || alice.Version != 1 {
+		t.Fatalf("Expected alice to be unchanged, got %v (version %d)", alice.Data["balance"], alice.Version)
+	}
+	if _, err := accounts.Get("carol"); err == nil {
+		t.Fatal("Expected carol not to be inserted")
+	}
+
+	// Operations are checked against the transaction's own earlier writes
+	tx = db.Begin()
+	tx.Delete("accounts", "alice")
+	tx.Update("accounts", "alice", map[string]interface{}{"balance": 1})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected error updating a document deleted earlier in the transaction")
+	}
+	if _, err := accounts.Get("alice"); err != nil {
+		t.Fatal("Expected alice not to be deleted")
+	}
+}
+
+func TestTransaction_Rollback(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("accounts")
+	accounts, _ := db.GetCollection("accounts")
+
+	tx := db.Begin()
+	tx.Insert("accounts", "alice", map[string]interface{}{"balance": 100})
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := accounts.Get("alice"); err == nil {
+		t.Fatal("Expected rolled back insert not to be applied")
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("Expected ErrTxDone after rollback, got %v", err)
+	}
+	if err := tx.Insert("accounts", "bob", nil); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("Expected ErrTxDone buffering after rollback, got %v", err)
+	}
+}
+
+func TestTransaction_GlobalIDUniqueness(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("a")
+	db.CreateCollection("b")
+	db.SetGlobalIDUniqueness(true)
+	a, _ := db.GetCollection("a")
+
+	tx := db.Begin()
+	tx.Insert("a", "x", map[string]interface{}{})
+	tx.Insert("b", "x", map[string]interface{}{})
+	if err := tx.Commit(); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID, got %v", err)
+	}
+	if _, err := a.Get("x"); err == nil {
+		t.Fatal("Expected no partial insert")
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// expired reports whether the document's TTL has passed at now
+func (d *Document) expired(now time.Time) bool {
+	return d.ExpiresAt != nil && !now.Before(*d.ExpiresAt)
+}
+
+// liveDocuments filters out documents that have expired but not yet been
+// swept
+func liveDocuments(docs []*Document) []*Document {
+	now := time.Now()
+	live := docs[:0]
+	for _, doc := range docs {
+		if !doc.expired(now) {
+			live = append(live, doc)
+		}
+	}
+	return live
+}
+
+// InsertWithTTL inserts a document that expires after ttl. Expired documents
+// are treated as absent by reads and removed by the expiry sweeper.
+func (c *Collection) InsertWithTTL(id string, data map[string]interface{}, ttl time.Duration) error {
+	return c.InsertWithTTLAs("", id, data, ttl)
+}
+
+// InsertWithTTLAs inserts an expiring document, recording principal as its
+// creator
+func (c *Collection) InsertWithTTLAs(principal, id string, data map[string]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	return c.write(func() error {
+		expiresAt := time.Now().Add(ttl)
+		return c.insertExpiringLocked(id, data, principal, &expiresAt)
+	})
+}
+
+// sweepExpiredLocked removes expired documents and returns how many were
+// removed. Callers must hold c.mu for writing.
+func (c *Collection) sweepExpiredLocked(now time.Time) int {
+	removed := 0
+	for _, doc := range c.Documents {
+		if doc.expired(now) {
+			c.removeLocked(doc)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SweepExpired deletes expired documents from every collection and returns
+// how many were deleted
+func (db *Database) SweepExpired() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	removed := 0
+	for _, collection := range db.Collections {
+		collection.mu.Lock()
+		removed += collection.sweepExpiredLocked(now)
+		collection.mu.Unlock()
+	}
+
+	return removed
+}
+
+// StartExpirySweeper deletes expired documents every interval in a background
+// goroutine. The returned function stops the sweeper.
+func (db *Database) StartExpirySweeper(interval time.Duration) (stop func()) {
+	return runPeriodically(interval, &db.sweepers, func() {
+		if removed := db.SweepExpired(); removed > 0 {
+			log.Printf("Expired %d documents", removed)
+		}
+	})
+}
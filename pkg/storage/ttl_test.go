@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollection_InsertWithTTL(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("sessions")
+	collection, _ := db.GetCollection("sessions")
+	collection.CreateIndex("user")
+
+	if err := collection.InsertWithTTL("s1", map[string]interface{}{"user": "john"}, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := collection.InsertWithTTL("s2", map[string]interface{}{"user": "john"}, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc, err := collection.Get("s1")
+	if err != nil || doc.ExpiresAt == nil {
+		t.Fatalf("Expected live document with expiry, got %v, %v", doc, err)
+	}
+
+	// Expire s1 without waiting for the sweeper
+	past := time.Now().Add(-time.Second)
+	collection.Documents["s1"].ExpiresAt = &past
+
+	if _, err := collection.Get("s1"); err == nil {
+		t.Fatal("Expected expired document to be treated as absent")
+	}
+	if results := collection.Query("user", "john"); len(results) != 1 {
+		t.Fatalf("Expected expired document to be excluded from queries, got %d", len(results))
+	}
+	if docs := collection.List(); len(docs) != 1 {
+		t.Fatalf("Expected expired document to be excluded from list, got %d", len(docs))
+	}
+
+	// The ID of an expired document can be reused before it is swept
+	if err := collection.Insert("s1", map[string]interface{}{"user": "jane"}); err != nil {
+		t.Fatalf("Expected insert over expired document to succeed, got %v", err)
+	}
+
+	if err := collection.InsertWithTTL("s3", map[string]interface{}{}, 0); err == nil {
+		t.Fatal("Expected error for non-positive ttl")
+	}
+}
+
+// expiryWriter records, as each operation is logged, whether the watched
+// document already has its expiry. It runs with the collection locked.
+type expiryWriter struct {
+	collection *Collection
+	id         string
+	expiring   []bool
+}
+
+func (w *expiryWriter) Write(p []byte) (int, error) {
+	if doc, exists := w.collection.Documents[w.id]; exists {
+		w.expiring = append(w.expiring, doc.ExpiresAt != nil)
+	}
+	return len(p), nil
+}
+
+func TestCollection_InsertWithTTLRecordsExpiry(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("sessions")
+	collection, _ := db.GetCollection("sessions")
+
+	w := &expiryWriter{collection: collection, id: "s1"}
+	db.RecordOperations(w)
+	defer db.RecordOperations(nil)
+
+	if err := collection.InsertWithTTL("s1", map[string]interface{}{}, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(w.expiring) != 1 || !w.expiring[0] {
+		t.Fatalf("Expected the expiry to be set before the insert was recorded, got %v", w.expiring)
+	}
+}
+
+func TestCollection_WritesTreatExpiredAsAbsent(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("sessions")
+	collection, _ := db.GetCollection("sessions")
+	collection.InsertWithTTL("s1", map[string]interface{}{"user": "john"}, time.Hour)
+
+	past := time.Now().Add(-time.Second)
+	collection.Documents["s1"].ExpiresAt = &past
+
+	if err := collection.Update("s1", map[string]interface{}{"user": "jane"}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("Expected not found updating an expired document, got %v", err)
+	}
+	if err := collection.Merge("s1", map[string]interface{}{"user": "jane"}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("Expected not found merging into an expired document, got %v", err)
+	}
+
+	created, err := collection.Upsert("s1", map[string]interface{}{"user": "jane"})
+	if err != nil || !created {
+		t.Fatalf("Expected upsert over an expired document to create it, got %v, %v", created, err)
+	}
+	doc, err := collection.Get("s1")
+	if err != nil {
+		t.Fatalf("Expected the upserted document to be live, got %v", err)
+	}
+	if doc.ExpiresAt != nil || doc.Version != 1 || doc.Data["user"] != "jane" {
+		t.Fatalf("Expected a fresh document without expiry, got %+v", doc)
+	}
+}
+
+func TestDatabase_SweepExpired(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("sessions")
+	collection, _ := db.GetCollection("sessions")
+
+	collection.InsertWithTTL("s1", map[string]interface{}{}, time.Hour)
+	collection.InsertWithTTL("s2", map[string]interface{}{}, time.Hour)
+	collection.Insert("s3", map[string]interface{}{})
+
+	past := time.Now().Add(-time.Second)
+	collection.Documents["s1"].ExpiresAt = &past
+
+	if removed := db.SweepExpired(); removed != 1 {
+		t.Fatalf("Expected 1 document swept, got %d", removed)
+	}
+	if _, exists := collection.Documents["s1"]; exists {
+		t.Fatal("Expected expired document to be deleted")
+	}
+	if len(collection.Documents) != 2 {
+		t.Fatalf("Expected 2 documents to remain, got %d", len(collection.Documents))
+	}
+}
+
+func TestExpiresAtPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	db := NewDatabaseWithPath(path)
+	db.CreateCollection("sessions")
+	collection, _ := db.GetCollection("sessions")
+	collection.InsertWithTTL("s1", map[string]interface{}{}, time.Hour)
+	expected := *collection.Documents["s1"].ExpiresAt
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatalf("Expected no error saving to disk, got %v", err)
+	}
+
+	reloaded := NewDatabaseWithPath(path)
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatalf("Expected no error loading from disk, got %v", err)
+	}
+	sessions, _ := reloaded.GetCollection("sessions")
+
+	doc, err := sessions.Get("s1")
+	if err != nil {
+		t.Fatalf("Expected document after reload, got %v", err)
+	}
+	if doc.ExpiresAt == nil || !doc.ExpiresAt.Equal(expected) {
+		t.Fatalf("Expected expiry %v to survive reload, got %v", expected, doc.ExpiresAt)
+	}
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDuplicateID is returned when an insert would reuse an ID held by a
+// document in another collection while global ID uniqueness is enabled
+var ErrDuplicateID = errors.New("duplicate document id")
+
+// globalIDIndex maps every document ID to the collection holding it. It is
+// only maintained while global uniqueness is enabled. Its mutex is a leaf
+// lock: it may be taken while holding database or collection locks, but
+// never the other way around.
+type globalIDIndex struct {
+	mu      sync.Mutex
+	enabled bool
+	owners  map[string]string
+}
+
+// SetGlobalIDUniqueness requires document IDs to be unique across all
+// collections rather than within each one. Enabling it fails without changes
+// if existing collections already share an ID.
+func (db *Database) SetGlobalIDUniqueness(enabled bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if !enabled {
+		db.ids.mu.Lock()
+		db.ids.enabled = false
+		db.ids.owners = nil
+		db.ids.mu.Unlock()
+		return nil
+	}
+
+	// Hold every collection's read lock so no insert slips in between
+	// building the index and enabling it
+	names := db.collectionNamesLocked()
+	for _, name := range names {
+		c := db.Collections[name]
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
+
+	owners, err := db.buildIDOwnersLocked(names)
+	if err != nil {
+		return err
+	}
+
+	db.ids.mu.Lock()
+	db.ids.enabled = true
+	db.ids.owners = owners
+	db.ids.mu.Unlock()
+	return nil
+}
+
+// GlobalIDUniqueness reports whether document IDs must be unique across all
+// collections
+func (db *Database) GlobalIDUniqueness() bool {
+	db.ids.mu.Lock()
+	defer db.ids.mu.Unlock()
+
+	return db.ids.enabled
+}
+
+// buildIDOwnersLocked maps the IDs in the named collections to their
+// collection. Callers must hold db.mu and each collection's lock.
+func (db *Database) buildIDOwnersLocked(names []string) (map[string]string, error) {
+	owners := make(map[string]string)
+	for _, name := range names {
+		for id := range db.Collections[name].Documents {
+			if other, exists := owners[id]; exists {
+				return nil, fmt.Errorf("%w: '%s' exists in collections '%s' and '%s'", ErrDuplicateID, id, other, name)
+			}
+			owners[id] = name
+		}
+	}
+	return owners, nil
+}
+
+// rebuildIDIndexLocked recomputes the index after collections are replaced
+// wholesale. Callers must hold db.mu for writing. IDs shared by several
+// collections are attributed to one of them.
+func (db *Database) rebuildIDIndexLocked() {
+	db.ids.mu.Lock()
+	defer db.ids.mu.Unlock()
+
+	if !db.ids.enabled {
+		return
+	}
+
+	db.ids.owners = make(map[string]string)
+	for name, c := range db.Collections {
+		for id := range c.Documents {
+			db.ids.owners[id] = name
+		}
+	}
+}
+
+// claimID records that the collection holds id, failing if another
+// collection already does. Callers must hold c.mu for writing.
+func (c *Collection) claimID(id string) error {
+	if c.db == nil {
+		return nil
+	}
+
+	ids := &c.db.ids
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	if err := c.checkIDLocked(id); err != nil || !ids.enabled {
+		return err
+	}
+	ids.owners[id] = c.Name
+	return nil
+}
+
+// checkIDLocked returns an error if another collection holds id. Callers
+// must hold c.db.ids.mu.
+func (c *Collection) checkIDLocked(id string) error {
+	ids := &c.db.ids
+	if !ids.enabled {
+		return nil
+	}
+	if owner, exists := ids.owners[id]; exists && owner != c.Name {
+		return fmt.Errorf("%w: '%s' already exists in collection '%s'", ErrDuplicateID, id, owner)
+	}
+	return nil
+}
+
+// renameIDs moves the collection's claims from old to new IDs, failing
+// without changes if another collection holds one of the new IDs. Callers
+// must hold c.mu for writing.
+func (c *Collection) renameIDs(renames map[string]string) error {
+	if c.db == nil {
+		return nil
+	}
+
+	ids := &c.db.ids
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	if !ids.enabled {
+		return nil
+	}
+	for _, newID := range renames {
+		if err := c.checkIDLocked(newID); err != nil {
+			return err
+		}
+	}
+	for oldID := range renames {
+		delete(ids.owners, oldID)
+	}
+	for _, newID := range renames {
+		ids.owners[newID] = c.Name
+	}
+	return nil
+}
+
+// releaseID forgets that the collection holds id. Callers must hold c.mu for
+// writing.
+func (c *Collection) releaseID(id string) {
+	if c.db == nil {
+		return
+	}
+
+	ids := &c.db.ids
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+
+	if ids.enabled && ids.owners[id] == c.Name {
+		delete(ids.owners, id)
+	}
+}
+
+// claimIDs claims several IDs, each for the named collection, failing
+// without changes if another collection already holds one of them
+func (db *Database) claimIDs(claims map[string]string) error {
+	db.ids.mu.Lock()
+	defer db.ids.mu.Unlock()
+
+	if !db.ids.enabled {
+		return nil
+	}
+	for id, name := range claims {
+		if owner, exists := db.ids.owners[id]; exists && owner != name {
+			return fmt.Errorf("%w: '%s' already exists in collection '%s'", ErrDuplicateID, id, owner)
+		}
+	}
+	for id, name := range claims {
+		db.ids.owners[id] = name
+	}
+	return nil
+}
+
+// renameCollectionIDs moves every ID held by collection oldName to newName
+func (db *Database) renameCollectionIDs(oldName, newName string) {
+	db.ids.mu.Lock()
+	defer db.ids.mu.Unlock()
+
+	for id, owner := range db.ids.owners {
+		if owner == oldName {
+			db.ids.owners[id] = newName
+		}
+	}
+}
+
+// releaseCollectionIDs forgets every ID held by the named collection
+func (db *Database) releaseCollectionIDs(name string) {
+	db.ids.mu.Lock()
+	defer db.ids.mu.Unlock()
+
+	for id, owner := range db.ids.owners {
+		if owner == name {
+			delete(db.ids.owners, id)
+		}
+	}
+}
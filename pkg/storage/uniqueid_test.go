@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDatabase_GlobalIDUniqueness(t *testing.T) {
+	db := NewDatabase()
+	db.CreateCollection("users")
+	db.CreateCollection("orders")
+	users, _ := db.GetCollection("users")
+	orders, _ := db.GetCollection("orders")
+
+	// Off by default
+	users.Insert("shared", map[string]interface{}{"name": "John"})
+	if err := orders.Insert("shared", map[string]interface{}{"total": 10}); err != nil {
+		t.Fatalf("Expected per-collection uniqueness by default, got %v", err)
+	}
+
+	// Enabling fails while collections already share an ID
+	if err := db.SetGlobalIDUniqueness(true); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID enabling with a shared ID, got %v", err)
+	}
+	orders.Delete("shared")
+
+	if err := db.SetGlobalIDUniqueness(true); err != nil {
+		t.Fatalf("Expected no error enabling global uniqueness, got %v", err)
+	}
+
+	err := orders.Insert("shared", map[string]interface{}{"total": 10})
+	if !errors.Is(err, ErrDuplicateID) || !strings.Contains(err.Error(), "'users'") {
+		t.Fatalf("Expected a conflict naming 'users', got %v", err)
+	}
+
+	// Deleting the document frees its ID for other collections
+	users.Delete("shared")
+	if err := orders.Insert("shared", map[string]interface{}{"total": 10}); err != nil {
+		t.Fatalf("Expected ID to be free after delete, got %v", err)
+	}
+	if err := users.Insert("shared", map[string]interface{}{"name": "John"}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	// Dropping a collection frees all its IDs
+	db.DeleteCollection("orders")
+	if err := users.Insert("shared", map[string]interface{}{"name": "John"}); err != nil {
+		t.Fatalf("Expected ID to be free after dropping its collection, got %v", err)
+	}
+}
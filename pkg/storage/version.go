@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVersionConflict is returned by conditional writes when the stored
+// document is not at the expected version
+var ErrVersionConflict = errors.New("version conflict")
+
+// UpdateIfVersion replaces a document's data only if it is still at
+// expectedVersion, so concurrent writers cannot silently overwrite each
+// other. A mismatch returns an error wrapping ErrVersionConflict.
+func (c *Collection) UpdateIfVersion(id string, data map[string]interface{}, expectedVersion int) error {
+	return c.UpdateIfVersionAs("", id, data, expectedVersion)
+}
+
+// UpdateIfVersionAs is UpdateIfVersion recording principal as the writer
+func (c *Collection) UpdateIfVersionAs(principal, id string, data map[string]interface{}, expectedVersion int) error {
+	return c.write(func() error {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+		if err := c.checkVersionLocked(id, expectedVersion); err != nil {
+			return err
+		}
+
+		return c.updateLocked(id, data, principal)
+	})
+}
+
+// MergeIfVersionAs applies a partial update only if the document is still at
+// expectedVersion
+func (c *Collection) MergeIfVersionAs(principal, id string, patch map[string]interface{}, expectedVersion int) error {
+	return c.write(func() error {
+		if err := c.checkVersionLocked(id, expectedVersion); err != nil {
+			return err
+		}
+
+		return c.mergeLocked(id, patch, principal)
+	})
+}
+
+func (c *Collection) checkVersionLocked(id string, expectedVersion int) error {
+	id = c.normalizeID(id)
+	doc, exists := c.Documents[id]
+	if !exists || doc.expired(time.Now()) {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id)
+	}
+
+	if doc.Version != expectedVersion {
+		return fmt.Errorf("%w: document '%s' is at version %d, expected %d", ErrVersionConflict, id, doc.Version, expectedVersion)
+	}
+
+	return nil
+}